@@ -1,12 +1,18 @@
 package link
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"strings"
 	"time"
 )
 
+// TLSHandshakeTimeout bounds the server-side TLS handshake of an accepted connection.
+var TLSHandshakeTimeout = 10 * time.Second
+
 type Protocol interface {
 	NewCodec(rw io.ReadWriter) (Codec, error)
 }
@@ -23,6 +29,19 @@ type Codec interface {
 	Close() error
 }
 
+// RecoverableError is implemented by codec errors after which the stream is
+// still in sync, e.g. a message that was skipped. Session.Receive keeps the
+// session open for them; the next Receive reads the next message.
+type RecoverableError interface {
+	error
+	Recoverable() bool
+}
+
+func isRecoverable(err error) bool {
+	var re RecoverableError
+	return errors.As(err, &re) && re.Recoverable()
+}
+
 type DeadlineCodec interface {
 	Codec
 	SetReadDeadline(time.Time) error
@@ -46,11 +65,7 @@ func Dial(network, address string, protocol Protocol, sendChanSize int) (*Sessio
 	if err != nil {
 		return nil, err
 	}
-	codec, err := protocol.NewCodec(conn)
-	if err != nil {
-		return nil, err
-	}
-	return NewSession(codec, sendChanSize), nil
+	return NewConnSession(conn, protocol, sendChanSize)
 }
 
 func DialTimeout(network, address string, timeout time.Duration, protocol Protocol, sendChanSize int) (*Session, error) {
@@ -58,11 +73,33 @@ func DialTimeout(network, address string, timeout time.Duration, protocol Protoc
 	if err != nil {
 		return nil, err
 	}
+	return NewConnSession(conn, protocol, sendChanSize)
+}
+
+// NewConnSession wraps an established connection in a Session. The
+// connection is closed if the protocol cannot create a codec for it.
+func NewConnSession(conn net.Conn, protocol Protocol, sendChanSize int) (*Session, error) {
 	codec, err := protocol.NewCodec(conn)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
-	return NewSession(codec, sendChanSize), nil
+	session := NewSession(codec, sendChanSize)
+	session.remoteAddr = conn.RemoteAddr()
+	session.localAddr = conn.LocalAddr()
+	return session, nil
+}
+
+// handshake completes the TLS handshake of an accepted connection, so that
+// certificate errors fail the connection before it is handed to a handler.
+func handshake(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TLSHandshakeTimeout)
+	defer cancel()
+	return tlsConn.HandshakeContext(ctx)
 }
 
 func Accept(listener net.Listener) (net.Conn, error) {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	link "github.com/younglifestyle/secs4go"
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/parser/hsms"
@@ -13,12 +14,86 @@ import (
 var ErrMsgParsing = errors.New("message parsing error")
 var ErrMsgFormat = errors.New("message format error")
 
-type SecsIIProtocol struct{}
+// ErrMsgTooLong is wrapped by MessageTooLongError.
+var ErrMsgTooLong = errors.New("message too long")
+
+// MessageTooLongError is returned by Receive for a message longer than
+// MaxMessageSize. The message was skipped without being buffered, so the
+// session stays usable; Header is its 10 byte header, for S9F11.
+type MessageTooLongError struct {
+	Header []byte
+	Length int
+	Max    int
+}
+
+func (e *MessageTooLongError) Error() string {
+	return fmt.Sprintf("message of %d bytes exceeds the maximum of %d bytes", e.Length, e.Max)
+}
+
+func (e *MessageTooLongError) Unwrap() error { return ErrMsgTooLong }
+
+// Recoverable tells the session that the stream is still in sync.
+func (e *MessageTooLongError) Recoverable() bool { return true }
+
+// maxRawCapture is the number of message text bytes kept for ParseError.Raw.
+const maxRawCapture = 256
+
+// ParseError is returned by Receive for a message whose text is not valid
+// SECS-II. The whole message was consumed, so the session stays usable.
+// Header is its 10 byte header, for S9F7 or Reject.req, and Raw holds up to
+// the first 256 bytes of its text for logging.
+type ParseError struct {
+	Header []byte
+	Length int
+	Raw    []byte
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrMsgParsing, e.Err)
+}
+
+// Unwrap matches both ErrMsgParsing and the decoder error, normally
+// wrapping hsms.ErrMalformed.
+func (e *ParseError) Unwrap() []error { return []error{ErrMsgParsing, e.Err} }
+
+// Recoverable tells the session that the stream is still in sync.
+func (e *ParseError) Recoverable() bool { return true }
+
+// DataMessage reports whether the header is that of a data message, which is
+// answered with S9F7 rather than Reject.req.
+func (e *ParseError) DataMessage() bool {
+	return len(e.Header) == 10 && e.Header[4] == 0 && e.Header[5] == 0
+}
+
+// rawCapture keeps the first bytes written to it.
+type rawCapture struct {
+	buf []byte
+}
+
+func (w *rawCapture) Write(b []byte) (int, error) {
+	if room := cap(w.buf) - len(w.buf); room > 0 {
+		w.buf = append(w.buf, b[:min(room, len(b))]...)
+	}
+	return len(b), nil
+}
+
+type SecsIIProtocol struct {
+	// MaxMessageSize is the largest accepted message length, counting the
+	// header but not the 4 length bytes. Zero means no limit.
+	MaxMessageSize int
+	// LazyItems makes data messages carry an ast.LazyItem over the message
+	// text, which decodes values on access, instead of decoded item nodes.
+	LazyItems bool
+}
 
 func (s *SecsIIProtocol) NewCodec(rw io.ReadWriter) (link.Codec, error) {
 	codec := &secsIICodec{
 		rw:      rw,
-		headBuf: make([]byte, 4),
+		maxSize: s.MaxMessageSize,
+		lazy:    s.LazyItems,
+		headBuf: make([]byte, 14),
+		raw:     rawCapture{buf: make([]byte, 0, maxRawCapture)},
 		headDecoder: func(bytes []byte) uint32 {
 			return binary.BigEndian.Uint32(bytes)
 		},
@@ -34,51 +109,100 @@ func SECSII() *SecsIIProtocol {
 type secsIICodec struct {
 	rw          io.ReadWriter
 	closer      io.Closer
+	maxSize     int
+	lazy        bool
 	headBuf     []byte
-	bodyBuf     []byte
+	raw         rawCapture
 	headDecoder func([]byte) uint32
 	headEncoder func([]byte, uint32)
 }
 
+// Receive reads the length and header of the next message and decodes its
+// items straight from the stream.
 func (c *secsIICodec) Receive() (interface{}, error) {
-	if _, err := io.ReadFull(c.rw, c.headBuf); err != nil {
+	if _, err := io.ReadFull(c.rw, c.headBuf[:4]); err != nil {
 		return nil, err
 	}
 
-	msgLength := c.headDecoder(c.headBuf)
+	msgLength := int(c.headDecoder(c.headBuf))
 	if msgLength < 10 {
 		return nil, ErrMsgFormat
 	}
-
-	required := int(msgLength) + 4
-	if cap(c.bodyBuf) < required {
-		c.bodyBuf = make([]byte, required)
-	} else {
-		c.bodyBuf = c.bodyBuf[:required]
-	}
-
-	binary.BigEndian.PutUint32(c.bodyBuf, msgLength)
-
-	if _, err := io.ReadFull(c.rw, c.bodyBuf[4:required]); err != nil {
+	if _, err := io.ReadFull(c.rw, c.headBuf[4:14]); err != nil {
 		return nil, err
 	}
+	header := c.headBuf[4:14]
+	textLength := msgLength - 10
+
+	if c.maxSize > 0 && msgLength > c.maxSize {
+		if _, err := io.CopyN(io.Discard, c.rw, int64(textLength)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return nil, &MessageTooLongError{
+			Header: append([]byte(nil), header...),
+			Length: msgLength,
+			Max:    c.maxSize,
+		}
+	}
 
-	msg, ok := hsms.Parse(c.bodyBuf[:required])
-	if !ok {
-		fmt.Printf("hsms decode failed, len=%d data=%x\n", required, c.bodyBuf[:required])
-		return nil, ErrMsgParsing
+	c.raw.buf = c.raw.buf[:0]
+	read := hsms.ReadMessage
+	if c.lazy {
+		read = hsms.ReadLazyMessage
+	}
+	msg, err := read(header, io.TeeReader(c.rw, &c.raw), textLength)
+	if err != nil {
+		if !errors.Is(err, hsms.ErrMalformed) {
+			return nil, err
+		}
+		return nil, &ParseError{
+			Header: append([]byte(nil), header...),
+			Length: msgLength,
+			Raw:    append([]byte(nil), c.raw.buf...),
+			Err:    err,
+		}
 	}
 
 	return msg, nil
 }
 
+// maxPooledBuffer is the capacity above which send buffers are not kept.
+const maxPooledBuffer = 64 << 10
+
+var sendBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// byteAppender is implemented by ast.HSMSMessage.
+type byteAppender interface {
+	AppendBytes(dst []byte) []byte
+}
+
+// Send writes an encoded message, or a message that can append its own
+// encoding, which is then written from a pooled buffer.
 func (c *secsIICodec) Send(msg interface{}) error {
-	b, ok := msg.([]byte)
-	if !ok {
+	switch m := msg.(type) {
+	case []byte:
+		_, err := c.rw.Write(m)
+		return err
+	case byteAppender:
+		bp := sendBuffers.Get().(*[]byte)
+		b := m.AppendBytes((*bp)[:0])
+		_, err := c.rw.Write(b)
+		if cap(b) <= maxPooledBuffer {
+			*bp = b[:0]
+			sendBuffers.Put(bp)
+		}
+		return err
+	default:
 		return ErrMsgFormat
 	}
-	_, err := c.rw.Write(b)
-	return err
 }
 
 func (c *secsIICodec) Close() error {
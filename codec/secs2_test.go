@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/parser/hsms"
+)
+
+func Test_SecsIITooLong(t *testing.T) {
+	large := ast.NewHSMSDataMessage("", 7, 3, 1, "H<->E", ast.NewASCIINode(strings.Repeat("x", 100)), 0, []byte{0, 0, 0, 1}).ToBytes()
+	small := ast.NewHSMSDataMessage("", 1, 1, 1, "H<->E", ast.NewEmptyItemNode(), 0, []byte{0, 0, 0, 2}).ToBytes()
+
+	var buf bytes.Buffer
+	buf.Write(large)
+	buf.Write(small)
+
+	codec, _ := (&SecsIIProtocol{MaxMessageSize: 64}).NewCodec(&buf)
+
+	_, err := codec.Receive()
+	var tooLong *MessageTooLongError
+	if !errors.As(err, &tooLong) || !errors.Is(err, ErrMsgTooLong) {
+		t.Fatalf("Receive() error = %v, want MessageTooLongError", err)
+	}
+	if !tooLong.Recoverable() || tooLong.Length != len(large)-4 || !bytes.Equal(tooLong.Header[6:10], []byte{0, 0, 0, 1}) {
+		t.Fatalf("unexpected error %+v", tooLong)
+	}
+
+	msg, err := codec.Receive()
+	if err != nil {
+		t.Fatalf("Receive() after skipped message: %v", err)
+	}
+	if data, ok := msg.(*ast.DataMessage); !ok || data.StreamCode() != 1 || data.FunctionCode() != 1 {
+		t.Fatalf("Receive() = %v, want S1F1", msg)
+	}
+}
+
+func Test_SecsIIMalformed(t *testing.T) {
+	malformed := []byte{0, 0, 0, 14, 0, 0, 6, 11, 0, 0, 0, 0, 0, 3, 0o001, 200, 0o245, 1}
+	small := ast.NewHSMSDataMessage("", 1, 1, 1, "H<->E", ast.NewEmptyItemNode(), 0, []byte{0, 0, 0, 4}).ToBytes()
+
+	var buf bytes.Buffer
+	buf.Write(malformed)
+	buf.Write(small)
+
+	codec, _ := SECSII().NewCodec(&buf)
+
+	_, err := codec.Receive()
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrMsgParsing) || !errors.Is(err, hsms.ErrMalformed) {
+		t.Fatalf("Receive() error = %v, want ParseError", err)
+	}
+	if !parseErr.Recoverable() || !parseErr.DataMessage() || !bytes.Equal(parseErr.Raw, malformed[14:]) {
+		t.Fatalf("unexpected error %+v", parseErr)
+	}
+
+	if _, err := codec.Receive(); err != nil {
+		t.Fatalf("Receive() after malformed message: %v", err)
+	}
+}
+
+func Test_SecsIISendMessage(t *testing.T) {
+	msg := ast.NewHSMSDataMessage("", 6, 11, 1, "H<-E", ast.NewListNode(ast.NewUintNode(4, 1), ast.NewASCIINode("event")), 0, []byte{0, 0, 0, 5})
+
+	var buf bytes.Buffer
+	codec, _ := SECSII().NewCodec(&buf)
+	if err := codec.Send(msg); err != nil {
+		t.Fatalf("Send(message): %v", err)
+	}
+	if err := codec.Send(msg.ToBytes()); err != nil {
+		t.Fatalf("Send(bytes): %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), append(msg.ToBytes(), msg.ToBytes()...)) {
+		t.Fatalf("Send wrote %X", buf.Bytes())
+	}
+	if err := codec.Send(42); !errors.Is(err, ErrMsgFormat) {
+		t.Fatalf("Send(42) error = %v, want ErrMsgFormat", err)
+	}
+}
+
+func Benchmark_SecsIISend(b *testing.B) {
+	values := make([]interface{}, 0, 50)
+	for i := 0; i < 50; i++ {
+		values = append(values, ast.NewListNode(ast.NewUintNode(4, i), ast.NewFloatNode(8, float64(i)/3)))
+	}
+	msg := ast.NewHSMSDataMessage("", 6, 11, 1, "H<-E", ast.NewListNode(ast.NewUintNode(4, 1), ast.NewUintNode(4, 2), ast.NewListNode(values...)), 0, []byte{0, 0, 0, 1})
+	codec, _ := SECSII().NewCodec(discard{})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := codec.Send(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type discard struct{}
+
+func (discard) Read(p []byte) (int, error)  { return 0, io.EOF }
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
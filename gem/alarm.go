@@ -126,7 +126,7 @@ func (g *GemHandler) buildS5F1(alarm Alarm, set bool) *ast.DataMessage {
 	body := ast.NewListNode(
 		ast.NewBinaryNode(alcd),
 		ast.NewUintNode(2, alarm.ID),
-		ast.NewASCIINode(alarm.Text),
+		textNode(alarm.Text),
 	)
 
 	direction := "H<-E"
@@ -180,10 +180,8 @@ func parseAlarmMessage(msg *ast.DataMessage) (AlarmEvent, error) {
 
 	altxNode, err := msg.Get(2)
 	if err == nil {
-		if ascii, ok := altxNode.(*ast.ASCIINode); ok {
-			if text, ok := ascii.Values().(string); ok {
-				event.Text = text
-			}
+		if text, ok := textValue(altxNode); ok {
+			event.Text = text
 		}
 	}
 
@@ -1,6 +1,7 @@
 package gem
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
@@ -11,6 +12,11 @@ import (
 // SendEnableAlarm sends S5F3 to enable or disable alarms on the equipment.
 // ACKC5 codes: 0=Accepted, 1=ALID not exist, 2=Busy, 3=Cannot enable
 func (h *GemHandler) SendEnableAlarm(alarmIDs []int, enable bool) (byte, error) {
+	return h.SendEnableAlarmContext(context.Background(), alarmIDs, enable)
+}
+
+// SendEnableAlarmContext is like SendEnableAlarm but gives up when ctx is done.
+func (h *GemHandler) SendEnableAlarmContext(ctx context.Context, alarmIDs []int, enable bool) (byte, error) {
 	if h.deviceType != DeviceHost {
 		return 0, ErrOperationNotSupported
 	}
@@ -36,7 +42,7 @@ func (h *GemHandler) SendEnableAlarm(alarmIDs []int, enable bool) (byte, error)
 	)
 
 	req := ast.NewDataMessage("EnableAlarmReq", 5, 3, 1, "H->E", body)
-	resp, err := h.protocol.SendAndWait(req)
+	resp, err := h.sendAndWaitContext(ctx, req)
 	if err != nil {
 		return 0, fmt.Errorf("gem: S5F3 failed: %w", err)
 	}
@@ -52,6 +58,11 @@ func (h *GemHandler) SendEnableAlarm(alarmIDs []int, enable bool) (byte, error)
 
 // RequestAlarmList sends S5F5 to request all registered alarms from equipment.
 func (h *GemHandler) RequestAlarmList() ([]AlarmInfo, error) {
+	return h.RequestAlarmListContext(context.Background())
+}
+
+// RequestAlarmListContext is like RequestAlarmList but gives up when ctx is done.
+func (h *GemHandler) RequestAlarmListContext(ctx context.Context) ([]AlarmInfo, error) {
 	if h.deviceType != DeviceHost {
 		return nil, ErrOperationNotSupported
 	}
@@ -60,7 +71,7 @@ func (h *GemHandler) RequestAlarmList() ([]AlarmInfo, error) {
 	}
 
 	req := ast.NewDataMessage("AlarmListReq", 5, 5, 1, "H->E", ast.NewListNode())
-	resp, err := h.protocol.SendAndWait(req)
+	resp, err := h.sendAndWaitContext(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("gem: S5F5 failed: %w", err)
 	}
@@ -71,6 +82,11 @@ func (h *GemHandler) RequestAlarmList() ([]AlarmInfo, error) {
 
 // RequestEnabledAlarmList sends S5F7 to request only enabled alarms from equipment.
 func (h *GemHandler) RequestEnabledAlarmList() ([]AlarmInfo, error) {
+	return h.RequestEnabledAlarmListContext(context.Background())
+}
+
+// RequestEnabledAlarmListContext is like RequestEnabledAlarmList but gives up when ctx is done.
+func (h *GemHandler) RequestEnabledAlarmListContext(ctx context.Context) ([]AlarmInfo, error) {
 	if h.deviceType != DeviceHost {
 		return nil, ErrOperationNotSupported
 	}
@@ -79,7 +95,7 @@ func (h *GemHandler) RequestEnabledAlarmList() ([]AlarmInfo, error) {
 	}
 
 	req := ast.NewDataMessage("EnabledAlarmListReq", 5, 7, 1, "H->E", ast.NewListNode())
-	resp, err := h.protocol.SendAndWait(req)
+	resp, err := h.sendAndWaitContext(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("gem: S5F7 failed: %w", err)
 	}
@@ -149,12 +165,7 @@ func parseAlarmListResponse(msg *ast.DataMessage) ([]AlarmInfo, error) {
 		if err != nil {
 			continue
 		}
-		var text string
-		if asciiNode, ok := altxNode.(*ast.ASCIINode); ok {
-			if str, ok := asciiNode.Values().(string); ok {
-				text = str
-			}
-		}
+		text, _ := textValue(altxNode)
 
 		alarms = append(alarms, AlarmInfo{
 			ID:      alid,
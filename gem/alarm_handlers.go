@@ -141,7 +141,7 @@ func (g *GemHandler) buildS5F6(alarms []AlarmInfo) *ast.DataMessage {
 		items[i] = ast.NewListNode(
 			ast.NewBinaryNode(alcd),
 			ast.NewUintNode(4, a.ID),
-			ast.NewASCIINode(a.Text),
+			textNode(a.Text),
 		)
 	}
 
@@ -164,7 +164,7 @@ func (g *GemHandler) buildS5F8(alarms []AlarmInfo) *ast.DataMessage {
 		items[i] = ast.NewListNode(
 			ast.NewBinaryNode(alcd),
 			ast.NewUintNode(4, a.ID),
-			ast.NewASCIINode(a.Text),
+			textNode(a.Text),
 		)
 	}
 
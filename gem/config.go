@@ -11,7 +11,7 @@ import (
 
 // Options describes configurable parameters when creating a GEM handler.
 type Options struct {
-	Protocol                   *hsms.HsmsProtocol
+	Protocol                   Transport // *hsms.HsmsProtocol, *secs1.Protocol or any other Transport.
 	DeviceType                 DeviceType
 	DeviceID                   uint16
 	MDLN                       string
@@ -20,7 +20,8 @@ type Options struct {
 	InitialControlState        ControlState
 	InitialOnlineMode          OnlineControlMode
 	Logging                    LoggingOptions
-	Logger                     Logger // Optional: custom structured logger. Defaults to NopLogger().
+	Logger                     Logger               // Optional: custom structured logger. Defaults to NopLogger().
+	Dispatch                   *hsms.DispatchConfig // Optional: handler dispatch mode. Nil keeps inline dispatch.
 }
 
 // LoggingOptions configures HSMS/GEM message logging.
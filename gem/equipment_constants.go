@@ -1,12 +1,21 @@
 package gem
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"sync"
 
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
 )
 
+var (
+	// ErrEquipmentConstantFormat indicates a value whose format does not match the constant's default value.
+	ErrEquipmentConstantFormat = errors.New("gem: equipment constant value has wrong format")
+	// ErrEquipmentConstantRange indicates a value outside the constant's configured min/max.
+	ErrEquipmentConstantRange = errors.New("gem: equipment constant value out of range")
+)
+
 // EquipmentConstantValueProvider returns the current value of an equipment constant.
 type EquipmentConstantValueProvider func() (ast.ItemNode, error)
 
@@ -71,14 +80,14 @@ func WithEquipmentConstantUnit(unit string) EquipmentConstantOption {
 	}
 }
 
-// WithEquipmentConstantMin registers the minimum permitted value (for informational purposes).
+// WithEquipmentConstantMin registers the minimum permitted value. Numeric updates below it are rejected.
 func WithEquipmentConstantMin(min ast.ItemNode) EquipmentConstantOption {
 	return func(ec *EquipmentConstant) {
 		ec.MinValue = min
 	}
 }
 
-// WithEquipmentConstantMax registers the maximum permitted value (for informational purposes).
+// WithEquipmentConstantMax registers the maximum permitted value. Numeric updates above it are rejected.
 func WithEquipmentConstantMax(max ast.ItemNode) EquipmentConstantOption {
 	return func(ec *EquipmentConstant) {
 		ec.MaxValue = max
@@ -135,16 +144,22 @@ func (ec *EquipmentConstant) Value() (ast.ItemNode, error) {
 	return ec.DefaultValue, nil
 }
 
-// ApplyValue stores or forwards a new value.
-func (ec *EquipmentConstant) ApplyValue(node ast.ItemNode) error {
+// Validate checks a candidate value against the default value's format, the
+// configured min/max and any custom validator, without applying it.
+func (ec *EquipmentConstant) Validate(node ast.ItemNode) error {
 	if node == nil {
 		return fmt.Errorf("nil value provided for equipment constant %v", ec.ID())
 	}
 
+	if err := ec.checkFormat(node); err != nil {
+		return err
+	}
+	if err := ec.checkRange(node); err != nil {
+		return err
+	}
+
 	ec.mu.RLock()
 	validator := ec.validator
-	updater := ec.updater
-	provider := ec.provider
 	ec.mu.RUnlock()
 
 	if validator != nil {
@@ -152,6 +167,23 @@ func (ec *EquipmentConstant) ApplyValue(node ast.ItemNode) error {
 			return err
 		}
 	}
+	return nil
+}
+
+// ApplyValue validates and then stores or forwards a new value.
+func (ec *EquipmentConstant) ApplyValue(node ast.ItemNode) error {
+	if err := ec.Validate(node); err != nil {
+		return err
+	}
+	return ec.store(node)
+}
+
+// store forwards an already validated value to the updater and caches it.
+func (ec *EquipmentConstant) store(node ast.ItemNode) error {
+	ec.mu.RLock()
+	updater := ec.updater
+	provider := ec.provider
+	ec.mu.RUnlock()
 
 	if updater != nil {
 		if err := updater(node); err != nil {
@@ -168,6 +200,70 @@ func (ec *EquipmentConstant) ApplyValue(node ast.ItemNode) error {
 	return nil
 }
 
+func (ec *EquipmentConstant) checkFormat(node ast.ItemNode) error {
+	if ec.DefaultValue == nil {
+		return nil
+	}
+
+	// The value is stored as sent, so it must have the exact item type of the
+	// default value, e.g. a U2 constant does not accept U4.
+	want := ec.DefaultValue.Type()
+	if node.Type() != want {
+		return fmt.Errorf("%w: ecid %v expects %s, got %s", ErrEquipmentConstantFormat, ec.ID(), want, node.Type())
+	}
+
+	switch want {
+	case "list", "ascii", "jis8", "unicode", "binary", "empty":
+	default:
+		if ec.DefaultValue.Size() == 1 && node.Size() != 1 {
+			return fmt.Errorf("%w: ecid %v expects a single value, got %d", ErrEquipmentConstantFormat, ec.ID(), node.Size())
+		}
+	}
+	return nil
+}
+
+func (ec *EquipmentConstant) checkRange(node ast.ItemNode) error {
+	value, ok := numericItemValue(node)
+	if !ok {
+		return nil
+	}
+
+	if min, ok := numericItemValue(ec.MinValue); ok && value.Cmp(min) < 0 {
+		return fmt.Errorf("%w: ecid %v value %s below minimum %s", ErrEquipmentConstantRange, ec.ID(), value.String(), min.String())
+	}
+	if max, ok := numericItemValue(ec.MaxValue); ok && value.Cmp(max) > 0 {
+		return fmt.Errorf("%w: ecid %v value %s above maximum %s", ErrEquipmentConstantRange, ec.ID(), value.String(), max.String())
+	}
+	return nil
+}
+
+// numericItemValue extracts the first value of a numeric item without losing
+// precision on 64-bit integers.
+func numericItemValue(node ast.ItemNode) (*big.Float, bool) {
+	if node == nil {
+		return nil, false
+	}
+	switch values := node.Values().(type) {
+	case []uint64:
+		if len(values) == 0 {
+			return nil, false
+		}
+		return new(big.Float).SetUint64(values[0]), true
+	case []int64:
+		if len(values) == 0 {
+			return nil, false
+		}
+		return new(big.Float).SetInt64(values[0]), true
+	case []float64:
+		if len(values) == 0 {
+			return nil, false
+		}
+		return big.NewFloat(values[0]), true
+	default:
+		return nil, false
+	}
+}
+
 // EquipmentConstantValue represents an ECID and its associated value payload.
 type EquipmentConstantValue struct {
 	ID    interface{}
@@ -189,3 +285,13 @@ type EquipmentConstantUpdate struct {
 	ID    interface{}
 	Value ast.ItemNode
 }
+
+// EquipmentConstantChangeSource identifies who changed an equipment constant.
+type EquipmentConstantChangeSource string
+
+const (
+	// EquipmentConstantChangeHost marks a change requested by the host via S2F15.
+	EquipmentConstantChangeHost EquipmentConstantChangeSource = "host"
+	// EquipmentConstantChangeOperator marks a change made locally on the equipment.
+	EquipmentConstantChangeOperator EquipmentConstantChangeSource = "operator"
+)
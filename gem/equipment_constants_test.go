@@ -0,0 +1,157 @@
+package gem
+
+import (
+	"testing"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func newTestEquipmentConstant(t *testing.T, handler *GemHandler) *EquipmentConstant {
+	t.Helper()
+	constant, err := NewEquipmentConstant(2001, "Delay", ast.NewUintNode(2, 10),
+		WithEquipmentConstantMin(ast.NewUintNode(2, 5)),
+		WithEquipmentConstantMax(ast.NewUintNode(2, 30)),
+	)
+	if err != nil {
+		t.Fatalf("NewEquipmentConstant: %v", err)
+	}
+	if err := handler.RegisterEquipmentConstant(constant); err != nil {
+		t.Fatalf("RegisterEquipmentConstant: %v", err)
+	}
+	return constant
+}
+
+func sendS2F15(t *testing.T, handler *GemHandler, updates ...EquipmentConstantUpdate) int {
+	t.Helper()
+	msg, err := handler.buildS2F15(updates)
+	if err != nil {
+		t.Fatalf("buildS2F15: %v", err)
+	}
+	resp, err := handler.onS2F15(msg)
+	if err != nil {
+		t.Fatalf("onS2F15: %v", err)
+	}
+	item, err := resp.Get()
+	if err != nil {
+		t.Fatalf("read EAC: %v", err)
+	}
+	ack, err := readSingleBinaryValue(item)
+	if err != nil {
+		t.Fatalf("read EAC: %v", err)
+	}
+	return ack
+}
+
+func TestEquipmentConstantS2F15Validation(t *testing.T) {
+	handler := newTestGemHandler(t, DeviceEquipment, ControlStateEquipmentOffline)
+	constant := newTestEquipmentConstant(t, handler)
+
+	var changes []map[string]interface{}
+	handler.Events().EquipmentConstantChanged.AddCallback(func(data map[string]interface{}) {
+		changes = append(changes, data)
+	})
+
+	cases := []struct {
+		name  string
+		value ast.ItemNode
+		want  ECACKCode
+	}{
+		{"below minimum", ast.NewUintNode(2, 4), ECACKValidationError},
+		{"above maximum", ast.NewUintNode(2, 31), ECACKValidationError},
+		{"wrong format", ast.NewASCIINode("20"), ECACKInvalidData},
+		{"2-byte text", ast.NewUnicodeNode("20"), ECACKInvalidData},
+		{"wider type", ast.NewUintNode(4, 20), ECACKInvalidData},
+		{"array for scalar", ast.NewUintNode(2, 10, 11), ECACKInvalidData},
+		{"accepted", ast.NewUintNode(2, 20), ECACKAccepted},
+	}
+	for _, tc := range cases {
+		ack := sendS2F15(t, handler, EquipmentConstantUpdate{ID: 2001, Value: tc.value})
+		if ack != tc.want.Int() {
+			t.Fatalf("%s: expected EAC %d, got %d", tc.name, tc.want, ack)
+		}
+	}
+
+	value, _ := constant.Value()
+	if got := value.Values().([]uint64)[0]; got != 20 {
+		t.Fatalf("expected stored value 20, got %d", got)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change event, got %d", len(changes))
+	}
+	if changes[0]["source"] != EquipmentConstantChangeHost {
+		t.Fatalf("unexpected change source %v", changes[0]["source"])
+	}
+}
+
+func TestEquipmentConstantS2F15AllOrNothing(t *testing.T) {
+	handler := newTestGemHandler(t, DeviceEquipment, ControlStateEquipmentOffline)
+	first := newTestEquipmentConstant(t, handler)
+	second, err := NewEquipmentConstant(2002, "Speed", ast.NewFloatNode(8, 1.5),
+		WithEquipmentConstantMax(ast.NewFloatNode(8, 2.0)),
+	)
+	if err != nil {
+		t.Fatalf("NewEquipmentConstant: %v", err)
+	}
+	if err := handler.RegisterEquipmentConstant(second); err != nil {
+		t.Fatalf("RegisterEquipmentConstant: %v", err)
+	}
+
+	ack := sendS2F15(t, handler,
+		EquipmentConstantUpdate{ID: 2001, Value: ast.NewUintNode(2, 25)},
+		EquipmentConstantUpdate{ID: 2002, Value: ast.NewFloatNode(8, 2.5)},
+	)
+	if ack != ECACKValidationError.Int() {
+		t.Fatalf("expected EAC 3, got %d", ack)
+	}
+
+	value, _ := first.Value()
+	if got := value.Values().([]uint64)[0]; got != 10 {
+		t.Fatalf("first constant should be unchanged, got %d", got)
+	}
+}
+
+func TestSetEquipmentConstantLocal(t *testing.T) {
+	handler := newTestGemHandler(t, DeviceEquipment, ControlStateEquipmentOffline)
+	constant := newTestEquipmentConstant(t, handler)
+
+	ce, err := NewCollectionEvent(300, "OperatorEquipmentConstantChange")
+	if err != nil {
+		t.Fatalf("NewCollectionEvent: %v", err)
+	}
+	if err := handler.RegisterCollectionEvent(ce); err != nil {
+		t.Fatalf("RegisterCollectionEvent: %v", err)
+	}
+	if err := handler.SetOperatorEquipmentConstantChangeEvent(300); err != nil {
+		t.Fatalf("SetOperatorEquipmentConstantChangeEvent: %v", err)
+	}
+
+	var changes []map[string]interface{}
+	handler.Events().EquipmentConstantChanged.AddCallback(func(data map[string]interface{}) {
+		changes = append(changes, data)
+	})
+
+	if err := handler.SetEquipmentConstantLocal(2001, ast.NewUintNode(2, 50)); err == nil {
+		t.Fatal("expected out of range error")
+	}
+	if err := handler.SetEquipmentConstantLocal(9999, ast.NewUintNode(2, 10)); err == nil {
+		t.Fatal("expected unknown ECID error")
+	}
+	// Not communicating: the value still changes, the CE report is simply skipped.
+	if err := handler.SetEquipmentConstantLocal(2001, ast.NewUintNode(2, 15)); err != nil {
+		t.Fatalf("SetEquipmentConstantLocal: %v", err)
+	}
+
+	value, _ := constant.Value()
+	if got := value.Values().([]uint64)[0]; got != 15 {
+		t.Fatalf("expected stored value 15, got %d", got)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change event, got %d", len(changes))
+	}
+	if changes[0]["source"] != EquipmentConstantChangeOperator {
+		t.Fatalf("unexpected change source %v", changes[0]["source"])
+	}
+	if prev := changes[0]["previous"].(ast.ItemNode).Values().([]uint64)[0]; prev != 10 {
+		t.Fatalf("unexpected previous value %d", prev)
+	}
+}
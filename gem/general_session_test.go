@@ -0,0 +1,81 @@
+package gem_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/gem"
+	"github.com/younglifestyle/secs4go/hsms"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func TestGemHandlersOnGeneralSession(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	port := 7900 + rand.Intn(400)
+
+	newEntityHandler := func(g *hsms.GeneralSession, sessionID int, deviceType gem.DeviceType) *gem.GemHandler {
+		t.Helper()
+		entity, err := g.NewEntity(sessionID, "module")
+		if err != nil {
+			t.Fatalf("NewEntity(%d): %v", sessionID, err)
+		}
+		handler, err := gem.NewGemHandler(gem.Options{
+			Protocol:   entity,
+			DeviceType: deviceType,
+			DeviceID:   uint16(sessionID),
+		})
+		if err != nil {
+			t.Fatalf("NewGemHandler(%d): %v", sessionID, err)
+		}
+		return handler
+	}
+
+	equipment := hsms.NewGeneralSession("127.0.0.1", port, false, "cluster")
+	equipment.Timeouts().SetLinktest(60)
+	for _, sessionID := range []int{1, 2} {
+		handler := newEntityHandler(equipment, sessionID, gem.DeviceEquipment)
+		sv, err := gem.NewStatusVariable(1001, "Module", "",
+			gem.WithStatusValueProvider(func() (ast.ItemNode, error) {
+				return ast.NewUintNode(4, uint64(sessionID)), nil
+			}),
+		)
+		if err != nil {
+			t.Fatalf("create status variable: %v", err)
+		}
+		if err := handler.RegisterStatusVariable(sv); err != nil {
+			t.Fatalf("register status variable: %v", err)
+		}
+		handler.Enable()
+		t.Cleanup(handler.Disable)
+	}
+	equipment.Enable()
+	t.Cleanup(equipment.Disable)
+	time.Sleep(200 * time.Millisecond)
+
+	host := hsms.NewGeneralSession("127.0.0.1", port, true, "host")
+	host.Timeouts().SetLinktest(60)
+	hosts := make(map[int]*gem.GemHandler)
+	for _, sessionID := range []int{1, 2} {
+		handler := newEntityHandler(host, sessionID, gem.DeviceHost)
+		handler.Enable()
+		t.Cleanup(handler.Disable)
+		hosts[sessionID] = handler
+	}
+	host.Enable()
+	t.Cleanup(host.Disable)
+
+	for sessionID, handler := range hosts {
+		if !handler.WaitForCommunicating(5 * time.Second) {
+			t.Fatalf("session %d failed to reach communicating state", sessionID)
+		}
+		values, err := handler.RequestStatusVariables(1001)
+		if err != nil {
+			t.Fatalf("session %d S1F3: %v", sessionID, err)
+		}
+		if len(values) != 1 {
+			t.Fatalf("session %d: expected one value, got %d", sessionID, len(values))
+		}
+		assertUintValue(t, values[0].Value, sessionID)
+	}
+}
@@ -1,6 +1,7 @@
 package gem
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -33,11 +34,41 @@ type Events struct {
 	EventReportReceived   *common.Event
 	ControlStateChanged   *common.Event
 	S9ErrorReceived       *common.Event
+	// EquipmentConstantChanged fires after an equipment constant is changed by the host (S2F15)
+	// or locally by the operator. Payload keys: handler, ecid, previous, value, source.
+	EquipmentConstantChanged *common.Event
 }
 
-// GemHandler orchestrates GEM handshake and selected services on top of HSMS protocol.
+func newEvents() Events {
+	return Events{
+		HandlerCommunicating:     &common.Event{},
+		AlarmReceived:            &common.Event{},
+		AlarmAckReceived:         &common.Event{},
+		RemoteCommandReceived:    &common.Event{},
+		EventReportReceived:      &common.Event{},
+		ControlStateChanged:      &common.Event{},
+		S9ErrorReceived:          &common.Event{},
+		EquipmentConstantChanged: &common.Event{},
+	}
+}
+
+// pairs returns each event of e next to the matching event of other, in field order.
+func (e Events) pairs(other Events) [][2]*common.Event {
+	return [][2]*common.Event{
+		{e.HandlerCommunicating, other.HandlerCommunicating},
+		{e.AlarmReceived, other.AlarmReceived},
+		{e.AlarmAckReceived, other.AlarmAckReceived},
+		{e.RemoteCommandReceived, other.RemoteCommandReceived},
+		{e.EventReportReceived, other.EventReportReceived},
+		{e.ControlStateChanged, other.ControlStateChanged},
+		{e.S9ErrorReceived, other.S9ErrorReceived},
+		{e.EquipmentConstantChanged, other.EquipmentConstantChanged},
+	}
+}
+
+// GemHandler orchestrates GEM handshake and selected services on top of a Transport.
 type GemHandler struct {
-	protocol   *hsms.HsmsProtocol
+	protocol   Transport
 	deviceType DeviceType
 	deviceID   uint16
 	mdln       string
@@ -69,6 +100,8 @@ type GemHandler struct {
 	ecMu               sync.RWMutex
 	equipmentConstants map[string]*EquipmentConstant
 	ecOrder            []string
+	// operatorECChangeCEID is the CEID reported on operator EC changes; nil disables it.
+	operatorECChangeCEID interface{}
 
 	dataVarMu    sync.RWMutex
 	dataVars     map[string]*DataVariable
@@ -95,7 +128,7 @@ type GemHandler struct {
 	controlAttemptInProgress *atomic.Bool
 }
 
-// NewGemHandler creates a GEM handler backed by the provided HSMS protocol.
+// NewGemHandler creates a GEM handler backed by the provided transport.
 func NewGemHandler(opts Options) (*GemHandler, error) {
 	if opts.Protocol == nil {
 		return nil, errors.New("gem: protocol is required")
@@ -114,17 +147,9 @@ func NewGemHandler(opts Options) (*GemHandler, error) {
 			InitialState:      opts.InitialControlState,
 			InitialOnlineMode: opts.InitialOnlineMode,
 		}),
-		enabled:             atomic.NewBool(false),
-		handshakeInProgress: atomic.NewBool(false),
-		events: Events{
-			HandlerCommunicating:  &common.Event{},
-			AlarmReceived:         &common.Event{},
-			AlarmAckReceived:      &common.Event{},
-			RemoteCommandReceived: &common.Event{},
-			EventReportReceived:   &common.Event{},
-			ControlStateChanged:   &common.Event{},
-			S9ErrorReceived:       &common.Event{},
-		},
+		enabled:                  atomic.NewBool(false),
+		handshakeInProgress:      atomic.NewBool(false),
+		events:                   newEvents(),
 		alarms:                   make(map[int]Alarm),
 		statusVars:               make(map[string]*StatusVariable),
 		equipmentConstants:       make(map[string]*EquipmentConstant),
@@ -140,45 +165,56 @@ func NewGemHandler(opts Options) (*GemHandler, error) {
 
 	handler.setCommunicationState(CommunicationStateNotCommunicating)
 
-	handler.protocol.OnS9Error = func(errorInfo *hsms.S9ErrorInfo) {
-		handler.events.S9ErrorReceived.Fire(map[string]interface{}{
-			"handler": handler,
-			"error":   errorInfo,
-		})
+	if protocol, ok := handler.protocol.(*hsms.HsmsProtocol); ok {
+		protocol.OnS9Error = func(errorInfo *hsms.S9ErrorInfo) {
+			handler.events.S9ErrorReceived.Fire(map[string]interface{}{
+				"handler": handler,
+				"error":   errorInfo,
+			})
+		}
 	}
 
 	handler.protocol.SetLogger(handler.logger)
-	handler.protocol.ConfigureLogging(opts.Logging.toConfig(nil))
+	if configurer, ok := handler.protocol.(loggingConfigurer); ok {
+		configurer.ConfigureLogging(opts.Logging.toConfig(nil))
+	}
+	if opts.Dispatch != nil {
+		if configurer, ok := handler.protocol.(dispatchConfigurer); ok {
+			configurer.SetDispatch(*opts.Dispatch)
+		} else {
+			handler.logger.Warn("transport does not support dispatch configuration, ignoring Options.Dispatch")
+		}
+	}
 
-	handler.protocol.RegisterHandler(1, 1, handler.onS1F1)
-	handler.protocol.RegisterHandler(1, 13, handler.onS1F13)
-	handler.protocol.RegisterHandler(1, 14, handler.onS1F14)
+	handler.registerHandler(1, 1, handler.onS1F1)
+	handler.registerHandler(1, 13, handler.onS1F13)
+	handler.registerHandler(1, 14, handler.onS1F14)
 	if handler.deviceType == DeviceEquipment {
-		handler.protocol.RegisterHandler(1, 15, handler.onS1F15)
-		handler.protocol.RegisterHandler(1, 17, handler.onS1F17)
+		handler.registerHandler(1, 15, handler.onS1F15)
+		handler.registerHandler(1, 17, handler.onS1F17)
 	}
 
 	if handler.deviceType == DeviceHost {
-		handler.protocol.RegisterHandler(5, 1, handler.onS5F1)
-		handler.protocol.RegisterHandler(6, 11, handler.onS6F11)
+		handler.registerHandler(5, 1, handler.onS5F1)
+		handler.registerHandler(6, 11, handler.onS6F11)
 	} else {
-		handler.protocol.RegisterHandler(2, 17, handler.onS2F17)
-		handler.protocol.RegisterHandler(2, 31, handler.onS2F31)
-		handler.protocol.RegisterHandler(2, 41, handler.onS2F41)
-		handler.protocol.RegisterHandler(1, 3, handler.onS1F3)
-		handler.protocol.RegisterHandler(1, 11, handler.onS1F11)
-		handler.protocol.RegisterHandler(2, 13, handler.onS2F13)
-		handler.protocol.RegisterHandler(2, 15, handler.onS2F15)
-		handler.protocol.RegisterHandler(2, 29, handler.onS2F29)
-		handler.protocol.RegisterHandler(2, 33, handler.onS2F33)
-		handler.protocol.RegisterHandler(2, 35, handler.onS2F35)
-		handler.protocol.RegisterHandler(2, 37, handler.onS2F37)
-		handler.protocol.RegisterHandler(5, 3, handler.onS5F3)
-		handler.protocol.RegisterHandler(5, 5, handler.onS5F5)
-		handler.protocol.RegisterHandler(5, 7, handler.onS5F7)
-		handler.protocol.RegisterHandler(6, 15, handler.onS6F15)
-		handler.protocol.RegisterHandler(7, 3, handler.onS7F3)
-		handler.protocol.RegisterHandler(7, 5, handler.onS7F5)
+		handler.registerHandler(2, 17, handler.onS2F17)
+		handler.registerHandler(2, 31, handler.onS2F31)
+		handler.registerHandler(2, 41, handler.onS2F41)
+		handler.registerHandler(1, 3, handler.onS1F3)
+		handler.registerHandler(1, 11, handler.onS1F11)
+		handler.registerHandler(2, 13, handler.onS2F13)
+		handler.registerHandler(2, 15, handler.onS2F15)
+		handler.registerHandler(2, 29, handler.onS2F29)
+		handler.registerHandler(2, 33, handler.onS2F33)
+		handler.registerHandler(2, 35, handler.onS2F35)
+		handler.registerHandler(2, 37, handler.onS2F37)
+		handler.registerHandler(5, 3, handler.onS5F3)
+		handler.registerHandler(5, 5, handler.onS5F5)
+		handler.registerHandler(5, 7, handler.onS5F7)
+		handler.registerHandler(6, 15, handler.onS6F15)
+		handler.registerHandler(7, 3, handler.onS7F3)
+		handler.registerHandler(7, 5, handler.onS7F5)
 	}
 
 	//handler.protocol.RegisterHandler(5, 2, handler.onS5F2)
@@ -228,7 +264,11 @@ func (g *GemHandler) Enable() {
 	go g.monitorLoop(stopCh)
 }
 
-// Disable stops monitoring and disables the HSMS protocol.
+// Disable stops monitoring and disables the transport. The handler leaves
+// COMMUNICATING first, so no new GEM requests are started; the transport then
+// closes the connection. An *hsms.HsmsProtocol drains the transactions already
+// in flight, deselects the link and sends Separate.req, so the peer can tell
+// it apart from a failure.
 func (g *GemHandler) Disable() {
 	if !g.enabled.CompareAndSwap(true, false) {
 		return
@@ -316,8 +356,20 @@ func (g *GemHandler) SwitchControlOnlineRemote() error {
 
 // WaitForCommunicating blocks until the handler reaches communicating state or timeout is hit.
 func (g *GemHandler) WaitForCommunicating(timeout time.Duration) bool {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return g.WaitForCommunicatingContext(ctx) == nil
+}
+
+// WaitForCommunicatingContext blocks until the handler reaches communicating state.
+// It returns ctx.Err() if ctx is done first.
+func (g *GemHandler) WaitForCommunicatingContext(ctx context.Context) error {
 	if g.State() == CommunicationStateCommunicating {
-		return true
+		return nil
 	}
 
 	waiter := make(chan struct{}, 1)
@@ -325,25 +377,17 @@ func (g *GemHandler) WaitForCommunicating(timeout time.Duration) bool {
 	g.waitersMu.Lock()
 	if g.State() == CommunicationStateCommunicating {
 		g.waitersMu.Unlock()
-		return true
+		return nil
 	}
 	g.waiters = append(g.waiters, waiter)
 	g.waitersMu.Unlock()
 
-	if timeout <= 0 {
-		<-waiter
-		return true
-	}
-
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
 	select {
 	case <-waiter:
-		return true
-	case <-timer.C:
+		return nil
+	case <-ctx.Done():
 		g.removeWaiter(waiter)
-		return false
+		return ctx.Err()
 	}
 }
 
@@ -479,7 +523,7 @@ func (g *GemHandler) initiateAttemptOnline() {
 			return
 		}
 
-		resp, err := g.protocol.SendAndWait(g.buildS1F1())
+		resp, err := g.sendAndWait(g.buildS1F1())
 		if err != nil {
 			g.logger.Error("S1F1 request failed", "error", err)
 			_ = g.transitionControl(func(sm *ControlStateMachine) error {
@@ -520,7 +564,7 @@ func (g *GemHandler) initiateEstablishCommunication() {
 			return
 		}
 
-		resp, err := g.protocol.SendAndWait(g.buildS1F13Equipment())
+		resp, err := g.sendAndWait(g.buildS1F13Equipment())
 		if err != nil {
 			g.logger.Error("S1F13 request failed", "error", err)
 			return
@@ -613,7 +657,7 @@ func (g *GemHandler) initiateHandshake() {
 
 		g.state.setStateWithWaitCRA(CommunicationStateWaitCRA, waitCRA, g.onWaitCRATimeout)
 
-		dataMsg, err := g.protocol.SendAndWait(g.buildS1F13())
+		dataMsg, err := g.sendAndWait(g.buildS1F13())
 		if err != nil {
 			g.logger.Error("establish communication request failed", "error", err)
 			g.scheduleRetry()
@@ -907,6 +951,11 @@ func readCommAck(msg *ast.DataMessage) int {
 
 // SendRemoteCommand issues an S2F41 command (host only).
 func (g *GemHandler) SendRemoteCommand(command interface{}, params []RemoteCommandParameterValue) (RemoteCommandResult, error) {
+	return g.SendRemoteCommandContext(context.Background(), command, params)
+}
+
+// SendRemoteCommandContext is like SendRemoteCommand but gives up when ctx is done.
+func (g *GemHandler) SendRemoteCommandContext(ctx context.Context, command interface{}, params []RemoteCommandParameterValue) (RemoteCommandResult, error) {
 	if g.deviceType != DeviceHost {
 		return RemoteCommandResult{}, ErrOperationNotSupported
 	}
@@ -919,7 +968,7 @@ func (g *GemHandler) SendRemoteCommand(command interface{}, params []RemoteComma
 		return RemoteCommandResult{}, err
 	}
 
-	resp, err := g.protocol.SendAndWait(msg)
+	resp, err := g.sendAndWaitContext(ctx, msg)
 	if err != nil {
 		return RemoteCommandResult{}, err
 	}
@@ -947,11 +996,68 @@ func (g *GemHandler) getRemoteCommandHandler() RemoteCommandHandler {
 	return g.remoteCommandHandler
 }
 
-// Protocol returns the underlying HSMS protocol instance.
-func (g *GemHandler) Protocol() *hsms.HsmsProtocol {
+// Protocol returns the underlying transport, e.g. the *hsms.HsmsProtocol
+// passed in Options.Protocol.
+func (g *GemHandler) Protocol() Transport {
 	return g.protocol
 }
 
+// registerHandler registers a GEM handler for a stream/function. The handlers
+// type-assert the message items, so lazily decoded bodies are decoded first.
+func (g *GemHandler) registerHandler(stream, function int, handler hsms.DataMessageHandler) {
+	g.protocol.RegisterHandler(stream, function, func(msg *ast.DataMessage) (*ast.DataMessage, error) {
+		msg, err := materialize(msg)
+		if err != nil {
+			return nil, err
+		}
+		return handler(msg)
+	})
+}
+
+// sendAndWait sends a primary message and returns its reply, with a lazily
+// decoded body decoded into regular item nodes.
+func (g *GemHandler) sendAndWait(msg *ast.DataMessage) (*ast.DataMessage, error) {
+	resp, err := g.protocol.SendAndWait(msg)
+	if err != nil {
+		return nil, err
+	}
+	return materialize(resp)
+}
+
+// sendAndWaitContext is like sendAndWait but gives up when ctx is done.
+func (g *GemHandler) sendAndWaitContext(ctx context.Context, msg *ast.DataMessage) (*ast.DataMessage, error) {
+	resp, err := g.protocol.SendAndWaitContext(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	return materialize(resp)
+}
+
+// materialize returns msg with an ast.LazyItem body, as received with
+// SetLazyDecoding(true), decoded into regular item nodes. Other messages are
+// returned as is.
+func materialize(msg *ast.DataMessage) (*ast.DataMessage, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	item, _ := msg.Get()
+	lazy, ok := item.(*ast.LazyItem)
+	if !ok {
+		return msg, nil
+	}
+	decoded, err := lazy.Item()
+	if err != nil {
+		return nil, fmt.Errorf("gem: decode %s: %w", msg.Header(), err)
+	}
+
+	waitBit := 0
+	if msg.WaitBit() == "true" {
+		waitBit = 1
+	}
+	return ast.NewHSMSDataMessage(msg.Name(), msg.StreamCode(), msg.FunctionCode(), waitBit,
+		msg.Direction(), decoded, msg.SessionID(), msg.SystemBytes()), nil
+}
+
 func resolveLogger(l Logger) common.Logger {
 	if l != nil {
 		return l
@@ -0,0 +1,369 @@
+package gem
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/younglifestyle/secs4go/hsms"
+)
+
+var (
+	// ErrUnknownTool is returned when a HostManager operation references a tool that is not managed.
+	ErrUnknownTool = errors.New("gem: unknown tool")
+)
+
+// HostToolConfig describes a single equipment connection managed by a HostManager.
+type HostToolConfig struct {
+	// Name identifies the tool in events, health reports and fan-out results. It must be unique.
+	Name string
+	// Address and Port locate the equipment. They are ignored when Options.Protocol is set.
+	Address string
+	Port    int
+	// Passive makes the host listen for the equipment instead of connecting to it.
+	Passive   bool
+	SessionID int
+	// Options supplies the GEM settings for this tool. DeviceType is always forced to DeviceHost.
+	Options Options
+}
+
+// ToolHealth is a snapshot of one managed connection.
+type ToolHealth struct {
+	Name               string
+	Enabled            bool
+	Connected          bool
+	ConnectionState    string
+	CommunicationState CommunicationState
+	ControlState       ControlState
+}
+
+// ToolResult carries the outcome of a fan-out call for one tool.
+type ToolResult struct {
+	Tool  string
+	Value interface{}
+	Err   error
+}
+
+// StatusValuesResult carries the S1F4 answer of one tool for RequestStatusVariables.
+type StatusValuesResult struct {
+	Tool   string
+	Values []StatusValue
+	Err    error
+}
+
+// ToolConnectionEvent is a connection event of one managed tool.
+type ToolConnectionEvent struct {
+	Tool string
+	hsms.ConnectionEvent
+}
+
+// ToolFunc is invoked once per tool by HostManager.FanOut.
+type ToolFunc func(tool string, handler *GemHandler) (interface{}, error)
+
+type managedTool struct {
+	name    string
+	handler *GemHandler
+	enabled bool
+}
+
+// HostManager runs many host-side GEM handlers from one process.
+//
+// Events raised by any tool are re-fired on the manager's Events with the
+// originating tool name added to the payload under the "tool" key. Connection
+// events of the tools' transports reach AddConnectionListener.
+type HostManager struct {
+	mu    sync.RWMutex
+	tools map[string]*managedTool
+	order []string
+
+	events Events
+
+	listenerMu sync.RWMutex
+	listeners  []func(ToolConnectionEvent)
+}
+
+// NewHostManager creates a manager for the supplied tools. Connections are not
+// opened until Start or StartTool is called.
+func NewHostManager(configs []HostToolConfig) (*HostManager, error) {
+	m := &HostManager{
+		tools:  make(map[string]*managedTool),
+		events: newEvents(),
+	}
+	for _, cfg := range configs {
+		if err := m.AddTool(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Events returns the aggregated event hooks of all managed tools.
+func (m *HostManager) Events() Events {
+	return m.events
+}
+
+// AddConnectionListener registers fn to receive the connection events
+// (Connected, Disconnected with its reason, ReconnectScheduled, ...) of every
+// managed tool, tagged with the tool name. Listeners run synchronously on the
+// tool's connection goroutine and must not block.
+func (m *HostManager) AddConnectionListener(fn func(ToolConnectionEvent)) {
+	if fn == nil {
+		return
+	}
+	m.listenerMu.Lock()
+	m.listeners = append(m.listeners, fn)
+	m.listenerMu.Unlock()
+}
+
+// AddTool creates the GEM handler for a new tool. The tool is not started.
+func (m *HostManager) AddTool(cfg HostToolConfig) error {
+	if cfg.Name == "" {
+		return errors.New("gem: tool name is required")
+	}
+
+	opts := cfg.Options
+	opts.DeviceType = DeviceHost
+	if opts.Protocol == nil {
+		opts.Protocol = hsms.NewHsmsProtocol(cfg.Address, cfg.Port, !cfg.Passive, cfg.SessionID, cfg.Name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tools[cfg.Name]; exists {
+		return fmt.Errorf("gem: tool %s already registered", cfg.Name)
+	}
+
+	handler, err := NewGemHandler(opts)
+	if err != nil {
+		return fmt.Errorf("gem: tool %s: %w", cfg.Name, err)
+	}
+	m.forwardEvents(cfg.Name, handler)
+	m.forwardConnectionEvents(cfg.Name, handler)
+
+	m.tools[cfg.Name] = &managedTool{name: cfg.Name, handler: handler}
+	m.order = append(m.order, cfg.Name)
+	return nil
+}
+
+// RemoveTool stops and forgets a tool.
+func (m *HostManager) RemoveTool(name string) error {
+	m.mu.Lock()
+	tool, ok := m.tools[name]
+	if ok {
+		delete(m.tools, name)
+		for idx, key := range m.order {
+			if key == name {
+				m.order = append(m.order[:idx], m.order[idx+1:]...)
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTool, name)
+	}
+	tool.handler.Disable()
+	return nil
+}
+
+// Tools returns the managed tool names in registration order.
+func (m *HostManager) Tools() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.order...)
+}
+
+// Handler returns the GEM handler of a tool.
+func (m *HostManager) Handler(name string) (*GemHandler, error) {
+	tool, err := m.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return tool.handler, nil
+}
+
+// Start enables every managed tool.
+func (m *HostManager) Start() {
+	for _, tool := range m.snapshot(nil) {
+		m.setEnabled(tool, true)
+	}
+}
+
+// Stop disables every managed tool in parallel.
+func (m *HostManager) Stop() {
+	var wg sync.WaitGroup
+	for _, tool := range m.snapshot(nil) {
+		wg.Add(1)
+		go func(tool *managedTool) {
+			defer wg.Done()
+			m.setEnabled(tool, false)
+		}(tool)
+	}
+	wg.Wait()
+}
+
+// StartTool enables a single tool.
+func (m *HostManager) StartTool(name string) error {
+	tool, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	m.setEnabled(tool, true)
+	return nil
+}
+
+// StopTool disables a single tool.
+func (m *HostManager) StopTool(name string) error {
+	tool, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	m.setEnabled(tool, false)
+	return nil
+}
+
+// Health returns the health snapshot of a tool.
+func (m *HostManager) Health(name string) (ToolHealth, error) {
+	tool, err := m.lookup(name)
+	if err != nil {
+		return ToolHealth{}, err
+	}
+	return m.health(tool), nil
+}
+
+// HealthAll returns the health snapshots of all tools in registration order.
+func (m *HostManager) HealthAll() []ToolHealth {
+	tools := m.snapshot(nil)
+	result := make([]ToolHealth, 0, len(tools))
+	for _, tool := range tools {
+		result = append(result, m.health(tool))
+	}
+	return result
+}
+
+// FanOut calls fn for every tool (or only the named tools) in parallel and
+// collects one result per tool, in registration order. Unknown names produce
+// a result carrying ErrUnknownTool.
+func (m *HostManager) FanOut(fn ToolFunc, tools ...string) []ToolResult {
+	targets := m.snapshot(tools)
+	results := make([]ToolResult, len(targets))
+
+	var wg sync.WaitGroup
+	for idx, tool := range targets {
+		results[idx].Tool = tool.name
+		if tool.handler == nil {
+			results[idx].Err = fmt.Errorf("%w: %s", ErrUnknownTool, tool.name)
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, tool *managedTool) {
+			defer wg.Done()
+			results[idx].Value, results[idx].Err = fn(tool.name, tool.handler)
+		}(idx, tool)
+	}
+	wg.Wait()
+	return results
+}
+
+// RequestStatusVariables queries the supplied SVIDs from every tool (or the
+// tools listed in tools) in parallel. Each tool reports its own error.
+func (m *HostManager) RequestStatusVariables(ids []interface{}, tools ...string) []StatusValuesResult {
+	results := m.FanOut(func(_ string, handler *GemHandler) (interface{}, error) {
+		return handler.RequestStatusVariables(ids...)
+	}, tools...)
+
+	out := make([]StatusValuesResult, 0, len(results))
+	for _, res := range results {
+		values, _ := res.Value.([]StatusValue)
+		out = append(out, StatusValuesResult{Tool: res.Tool, Values: values, Err: res.Err})
+	}
+	return out
+}
+
+func (m *HostManager) lookup(name string) (*managedTool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tool, ok := m.tools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTool, name)
+	}
+	return tool, nil
+}
+
+// snapshot returns the named tools, or all tools when names is empty. Unknown
+// names are returned as placeholders with a nil handler.
+func (m *HostManager) snapshot(names []string) []*managedTool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(names) == 0 {
+		names = m.order
+	}
+	result := make([]*managedTool, 0, len(names))
+	for _, name := range names {
+		if tool, ok := m.tools[name]; ok {
+			result = append(result, tool)
+		} else {
+			result = append(result, &managedTool{name: name})
+		}
+	}
+	return result
+}
+
+func (m *HostManager) setEnabled(tool *managedTool, enabled bool) {
+	if tool.handler == nil {
+		return
+	}
+	m.mu.Lock()
+	tool.enabled = enabled
+	m.mu.Unlock()
+
+	if enabled {
+		tool.handler.Enable()
+	} else {
+		tool.handler.Disable()
+	}
+}
+
+func (m *HostManager) health(tool *managedTool) ToolHealth {
+	m.mu.RLock()
+	enabled := tool.enabled
+	m.mu.RUnlock()
+
+	protocol := tool.handler.Protocol()
+	return ToolHealth{
+		Name:               tool.name,
+		Enabled:            enabled,
+		Connected:          protocol.Connected(),
+		ConnectionState:    protocol.CurrentState(),
+		CommunicationState: tool.handler.State(),
+		ControlState:       tool.handler.ControlState(),
+	}
+}
+
+func (m *HostManager) forwardEvents(name string, handler *GemHandler) {
+	for _, pair := range handler.Events().pairs(m.events) {
+		src, dst := pair[0], pair[1]
+		src.AddCallback(func(data map[string]interface{}) {
+			payload := make(map[string]interface{}, len(data)+1)
+			for key, value := range data {
+				payload[key] = value
+			}
+			payload["tool"] = name
+			dst.Fire(payload)
+		})
+	}
+}
+
+func (m *HostManager) forwardConnectionEvents(name string, handler *GemHandler) {
+	handler.Protocol().AddConnectionListener(func(event hsms.ConnectionEvent) {
+		m.listenerMu.RLock()
+		listeners := m.listeners
+		m.listenerMu.RUnlock()
+		for _, fn := range listeners {
+			fn(ToolConnectionEvent{Tool: name, ConnectionEvent: event})
+		}
+	})
+}
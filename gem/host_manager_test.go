@@ -0,0 +1,161 @@
+package gem_test
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/gem"
+	"github.com/younglifestyle/secs4go/hsms"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func newManagedEquipment(t *testing.T, port int, temperature uint64) *gem.GemHandler {
+	t.Helper()
+	protocol := hsms.NewHsmsProtocol("127.0.0.1", port, false, 0x0100, "equipment")
+	protocol.Timeouts().SetLinktest(60)
+
+	handler, err := gem.NewGemHandler(gem.Options{
+		Protocol:   protocol,
+		DeviceType: gem.DeviceEquipment,
+	})
+	if err != nil {
+		t.Fatalf("create equipment handler: %v", err)
+	}
+	sv, err := gem.NewStatusVariable(1001, "Temperature", "C",
+		gem.WithStatusValueProvider(func() (ast.ItemNode, error) {
+			return ast.NewUintNode(4, temperature), nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("create status variable: %v", err)
+	}
+	if err := handler.RegisterStatusVariable(sv); err != nil {
+		t.Fatalf("register status variable: %v", err)
+	}
+	handler.Enable()
+	t.Cleanup(handler.Disable)
+	return handler
+}
+
+func TestHostManagerFanOut(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	basePort := 7500 + rand.Intn(400)
+
+	newManagedEquipment(t, basePort, 25)
+	newManagedEquipment(t, basePort+1, 40)
+	time.Sleep(200 * time.Millisecond)
+
+	manager, err := gem.NewHostManager([]gem.HostToolConfig{
+		{Name: "etch-1", Address: "127.0.0.1", Port: basePort, SessionID: 0x0100},
+		{Name: "etch-2", Address: "127.0.0.1", Port: basePort + 1, SessionID: 0x0100},
+		{Name: "offline", Address: "127.0.0.1", Port: basePort + 2, SessionID: 0x0100},
+	})
+	if err != nil {
+		t.Fatalf("NewHostManager: %v", err)
+	}
+	defer manager.Stop()
+
+	var mu sync.Mutex
+	communicating := make(map[string]bool)
+	manager.Events().HandlerCommunicating.AddCallback(func(data map[string]interface{}) {
+		mu.Lock()
+		communicating[data["tool"].(string)] = true
+		mu.Unlock()
+	})
+	var connMu sync.Mutex
+	connEvents := make(map[string][]hsms.ConnectionEvent)
+	manager.AddConnectionListener(func(event gem.ToolConnectionEvent) {
+		connMu.Lock()
+		connEvents[event.Tool] = append(connEvents[event.Tool], event.ConnectionEvent)
+		connMu.Unlock()
+	})
+	waitConnEvent := func(tool string, typ hsms.ConnectionEventType) hsms.ConnectionEvent {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			connMu.Lock()
+			for _, event := range connEvents[tool] {
+				if event.Type == typ {
+					connMu.Unlock()
+					return event
+				}
+			}
+			connMu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s: no %v connection event", tool, typ)
+		return hsms.ConnectionEvent{}
+	}
+
+	manager.Start()
+	for _, name := range []string{"etch-1", "etch-2"} {
+		handler, err := manager.Handler(name)
+		if err != nil {
+			t.Fatalf("Handler(%s): %v", name, err)
+		}
+		if !handler.WaitForCommunicating(5 * time.Second) {
+			t.Fatalf("%s failed to reach communicating state", name)
+		}
+	}
+
+	mu.Lock()
+	if !communicating["etch-1"] || !communicating["etch-2"] || communicating["offline"] {
+		t.Fatalf("unexpected aggregated communicating events: %v", communicating)
+	}
+	mu.Unlock()
+
+	waitConnEvent("etch-1", hsms.EventConnected)
+	waitConnEvent("etch-2", hsms.EventConnected)
+	waitConnEvent("offline", hsms.EventReconnectScheduled)
+
+	results := manager.RequestStatusVariables([]interface{}{uint16(1001)})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for idx, want := range []int{25, 40} {
+		res := results[idx]
+		if res.Err != nil {
+			t.Fatalf("%s: RequestStatusVariables: %v", res.Tool, res.Err)
+		}
+		if len(res.Values) != 1 {
+			t.Fatalf("%s: expected 1 status value, got %d", res.Tool, len(res.Values))
+		}
+		assertUintValue(t, res.Values[0].Value, want)
+	}
+	if results[2].Tool != "offline" || results[2].Err == nil {
+		t.Fatalf("expected error for offline tool, got %+v", results[2])
+	}
+
+	missing := manager.FanOut(func(string, *gem.GemHandler) (interface{}, error) {
+		return nil, nil
+	}, "unknown")
+	if !errors.Is(missing[0].Err, gem.ErrUnknownTool) {
+		t.Fatalf("expected ErrUnknownTool, got %v", missing[0].Err)
+	}
+
+	health, err := manager.Health("etch-1")
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if !health.Enabled || !health.Connected || health.CommunicationState != gem.CommunicationStateCommunicating {
+		t.Fatalf("unexpected health for etch-1: %+v", health)
+	}
+	offline, _ := manager.Health("offline")
+	if offline.Connected {
+		t.Fatalf("offline tool should not be connected: %+v", offline)
+	}
+
+	if err := manager.StopTool("etch-2"); err != nil {
+		t.Fatalf("StopTool: %v", err)
+	}
+	stopped, _ := manager.Health("etch-2")
+	if stopped.Enabled || stopped.Connected {
+		t.Fatalf("etch-2 should be stopped: %+v", stopped)
+	}
+	if event := waitConnEvent("etch-2", hsms.EventDisconnected); event.Reason != hsms.DisconnectReasonLocal {
+		t.Fatalf("unexpected disconnect reason for etch-2: %v", event.Reason)
+	}
+}
@@ -2,6 +2,7 @@ package gem
 
 import (
 	"fmt"
+	"unicode"
 
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
 )
@@ -67,10 +68,10 @@ func newIDInfoFromNode(node ast.ItemNode) (idInfo, error) {
 	}
 
 	switch node.Type() {
-	case "ascii":
-		str, ok := node.Values().(string)
+	case "ascii", "jis8", "unicode":
+		str, ok := textValue(node)
 		if !ok {
-			return idInfo{}, fmt.Errorf("unexpected ascii value type %T", node.Values())
+			return idInfo{}, fmt.Errorf("unexpected %s value type %T", node.Type(), node.Values())
 		}
 		return idInfo{raw: str, node: node, key: fmt.Sprintf("S:%s", str)}, nil
 	case "u1", "u2", "u4", "u8":
@@ -95,6 +96,28 @@ func newIDInfoFromNode(node ast.ItemNode) (idInfo, error) {
 	}
 }
 
+// textValue returns the string of an ASCII, JIS-8 or 2-byte character item.
+func textValue(node ast.ItemNode) (string, bool) {
+	switch node.Type() {
+	case "ascii", "jis8", "unicode":
+		str, ok := node.Values().(string)
+		return str, ok
+	default:
+		return "", false
+	}
+}
+
+// textNode returns an ASCII item for str, or a 2-byte character item when str
+// has non-ASCII characters.
+func textNode(str string) ast.ItemNode {
+	for i := 0; i < len(str); i++ {
+		if str[i] > unicode.MaxASCII {
+			return ast.NewUnicodeNode(str)
+		}
+	}
+	return ast.NewASCIINode(str)
+}
+
 func byteSizeForUint(value uint64) int {
 	switch {
 	case value <= 0xFF:
@@ -267,7 +267,7 @@ func itemNodeFromValue(value interface{}) (ast.ItemNode, error) {
 	case ast.ItemNode:
 		return v, nil
 	case string:
-		return ast.NewASCIINode(v), nil
+		return textNode(v), nil
 	case []byte:
 		ints := make([]interface{}, len(v))
 		for i, b := range v {
@@ -0,0 +1,47 @@
+package gem_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/gem"
+	"github.com/younglifestyle/secs4go/hsms"
+)
+
+func TestDisableSeparatesFromPeer(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	port := 8300 + rand.Intn(400)
+
+	equipment := newManagedEquipment(t, port, 25)
+	separated := make(chan hsms.ConnectionEvent, 1)
+	equipment.Protocol().AddConnectionListener(func(event hsms.ConnectionEvent) {
+		if event.Type == hsms.EventSeparated {
+			separated <- event
+		}
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	protocol := hsms.NewHsmsProtocol("127.0.0.1", port, true, 0x0100, "host")
+	protocol.Timeouts().SetLinktest(60)
+	host, err := gem.NewGemHandler(gem.Options{Protocol: protocol, DeviceType: gem.DeviceHost})
+	if err != nil {
+		t.Fatalf("create host handler: %v", err)
+	}
+	host.Enable()
+	t.Cleanup(host.Disable)
+	if !host.WaitForCommunicating(5 * time.Second) {
+		t.Fatal("host failed to reach communicating state")
+	}
+
+	host.Disable()
+
+	select {
+	case event := <-separated:
+		if !event.Remote {
+			t.Fatal("expected the host to initiate the separate")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("equipment did not receive Separate.req")
+	}
+}
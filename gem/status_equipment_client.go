@@ -1,6 +1,7 @@
 package gem
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
@@ -21,6 +22,11 @@ type EventReportLinkRequest struct {
 // RequestStatusVariables queries the equipment for the current value of the supplied SVIDs.
 // ids must be non-empty and contain non-negative integers or ASCII strings.
 func (g *GemHandler) RequestStatusVariables(ids ...interface{}) ([]StatusValue, error) {
+	return g.RequestStatusVariablesContext(context.Background(), ids...)
+}
+
+// RequestStatusVariablesContext is like RequestStatusVariables but gives up when ctx is done.
+func (g *GemHandler) RequestStatusVariablesContext(ctx context.Context, ids ...interface{}) ([]StatusValue, error) {
 	if g.deviceType != DeviceHost {
 		return nil, ErrOperationNotSupported
 	}
@@ -41,7 +47,7 @@ func (g *GemHandler) RequestStatusVariables(ids ...interface{}) ([]StatusValue,
 	}
 
 	request := g.buildS1F3(idInfos)
-	response, err := g.protocol.SendAndWait(request)
+	response, err := g.sendAndWaitContext(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +62,11 @@ func (g *GemHandler) RequestStatusVariables(ids ...interface{}) ([]StatusValue,
 // RequestStatusVariableInfo retrieves status variable name/unit metadata via S1F11/S1F12.
 // When ids is empty the equipment returns the complete namelist.
 func (g *GemHandler) RequestStatusVariableInfo(ids ...interface{}) ([]StatusVariableInfo, error) {
+	return g.RequestStatusVariableInfoContext(context.Background(), ids...)
+}
+
+// RequestStatusVariableInfoContext is like RequestStatusVariableInfo but gives up when ctx is done.
+func (g *GemHandler) RequestStatusVariableInfoContext(ctx context.Context, ids ...interface{}) ([]StatusVariableInfo, error) {
 	if g.deviceType != DeviceHost {
 		return nil, ErrOperationNotSupported
 	}
@@ -73,7 +84,7 @@ func (g *GemHandler) RequestStatusVariableInfo(ids ...interface{}) ([]StatusVari
 	}
 
 	request := g.buildS1F11(idInfos)
-	response, err := g.protocol.SendAndWait(request)
+	response, err := g.sendAndWaitContext(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +98,11 @@ func (g *GemHandler) RequestStatusVariableInfo(ids ...interface{}) ([]StatusVari
 
 // RequestEquipmentConstants fetches equipment constant values via S2F13/S2F14.
 func (g *GemHandler) RequestEquipmentConstants(ids ...interface{}) ([]EquipmentConstantValue, error) {
+	return g.RequestEquipmentConstantsContext(context.Background(), ids...)
+}
+
+// RequestEquipmentConstantsContext is like RequestEquipmentConstants but gives up when ctx is done.
+func (g *GemHandler) RequestEquipmentConstantsContext(ctx context.Context, ids ...interface{}) ([]EquipmentConstantValue, error) {
 	if g.deviceType != DeviceHost {
 		return nil, ErrOperationNotSupported
 	}
@@ -107,7 +123,7 @@ func (g *GemHandler) RequestEquipmentConstants(ids ...interface{}) ([]EquipmentC
 	}
 
 	request := g.buildS2F13(idInfos)
-	response, err := g.protocol.SendAndWait(request)
+	response, err := g.sendAndWaitContext(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -122,6 +138,11 @@ func (g *GemHandler) RequestEquipmentConstants(ids ...interface{}) ([]EquipmentC
 // RequestEquipmentConstantInfo retrieves EC metadata via S2F29/S2F30.
 // When ids is empty the full namelist is returned.
 func (g *GemHandler) RequestEquipmentConstantInfo(ids ...interface{}) ([]EquipmentConstantInfo, error) {
+	return g.RequestEquipmentConstantInfoContext(context.Background(), ids...)
+}
+
+// RequestEquipmentConstantInfoContext is like RequestEquipmentConstantInfo but gives up when ctx is done.
+func (g *GemHandler) RequestEquipmentConstantInfoContext(ctx context.Context, ids ...interface{}) ([]EquipmentConstantInfo, error) {
 	if g.deviceType != DeviceHost {
 		return nil, ErrOperationNotSupported
 	}
@@ -139,7 +160,7 @@ func (g *GemHandler) RequestEquipmentConstantInfo(ids ...interface{}) ([]Equipme
 	}
 
 	request := g.buildS2F29(idInfos)
-	response, err := g.protocol.SendAndWait(request)
+	response, err := g.sendAndWaitContext(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -153,6 +174,11 @@ func (g *GemHandler) RequestEquipmentConstantInfo(ids ...interface{}) ([]Equipme
 
 // DefineReports installs or clears report definitions on the equipment using S2F33.
 func (g *GemHandler) DefineReports(defs ...ReportDefinitionRequest) (int, error) {
+	return g.DefineReportsContext(context.Background(), defs...)
+}
+
+// DefineReportsContext is like DefineReports but gives up when ctx is done.
+func (g *GemHandler) DefineReportsContext(ctx context.Context, defs ...ReportDefinitionRequest) (int, error) {
 	if g.deviceType != DeviceHost {
 		return -1, ErrOperationNotSupported
 	}
@@ -165,7 +191,7 @@ func (g *GemHandler) DefineReports(defs ...ReportDefinitionRequest) (int, error)
 		return -1, err
 	}
 
-	resp, err := g.protocol.SendAndWait(msg)
+	resp, err := g.sendAndWaitContext(ctx, msg)
 	if err != nil {
 		return -1, err
 	}
@@ -178,6 +204,11 @@ func (g *GemHandler) DefineReports(defs ...ReportDefinitionRequest) (int, error)
 
 // LinkEventReports associates collection events with existing reports using S2F35.
 func (g *GemHandler) LinkEventReports(links ...EventReportLinkRequest) (int, error) {
+	return g.LinkEventReportsContext(context.Background(), links...)
+}
+
+// LinkEventReportsContext is like LinkEventReports but gives up when ctx is done.
+func (g *GemHandler) LinkEventReportsContext(ctx context.Context, links ...EventReportLinkRequest) (int, error) {
 	if g.deviceType != DeviceHost {
 		return -1, ErrOperationNotSupported
 	}
@@ -190,7 +221,7 @@ func (g *GemHandler) LinkEventReports(links ...EventReportLinkRequest) (int, err
 		return -1, err
 	}
 
-	resp, err := g.protocol.SendAndWait(msg)
+	resp, err := g.sendAndWaitContext(ctx, msg)
 	if err != nil {
 		return -1, err
 	}
@@ -203,6 +234,11 @@ func (g *GemHandler) LinkEventReports(links ...EventReportLinkRequest) (int, err
 
 // EnableEventReports toggles event reporting through S2F37.
 func (g *GemHandler) EnableEventReports(enable bool, ceids ...interface{}) (int, error) {
+	return g.EnableEventReportsContext(context.Background(), enable, ceids...)
+}
+
+// EnableEventReportsContext is like EnableEventReports but gives up when ctx is done.
+func (g *GemHandler) EnableEventReportsContext(ctx context.Context, enable bool, ceids ...interface{}) (int, error) {
 	if g.deviceType != DeviceHost {
 		return -1, ErrOperationNotSupported
 	}
@@ -219,7 +255,7 @@ func (g *GemHandler) EnableEventReports(enable bool, ceids ...interface{}) (int,
 		infoSlice = append(infoSlice, info)
 	}
 
-	resp, err := g.protocol.SendAndWait(g.buildS2F37(enable, infoSlice))
+	resp, err := g.sendAndWaitContext(ctx, g.buildS2F37(enable, infoSlice))
 	if err != nil {
 		return -1, err
 	}
@@ -232,6 +268,11 @@ func (g *GemHandler) EnableEventReports(enable bool, ceids ...interface{}) (int,
 
 // RequestCollectionEventReport requests current data for a CEID via S6F15/S6F16.
 func (g *GemHandler) RequestCollectionEventReport(ceid interface{}) (EventReport, error) {
+	return g.RequestCollectionEventReportContext(context.Background(), ceid)
+}
+
+// RequestCollectionEventReportContext is like RequestCollectionEventReport but gives up when ctx is done.
+func (g *GemHandler) RequestCollectionEventReportContext(ctx context.Context, ceid interface{}) (EventReport, error) {
 	var report EventReport
 	if g.deviceType != DeviceHost {
 		return report, ErrOperationNotSupported
@@ -245,7 +286,7 @@ func (g *GemHandler) RequestCollectionEventReport(ceid interface{}) (EventReport
 		return report, err
 	}
 
-	resp, err := g.protocol.SendAndWait(g.buildS6F15(info))
+	resp, err := g.sendAndWaitContext(ctx, g.buildS6F15(info))
 	if err != nil {
 		return report, err
 	}
@@ -255,6 +296,11 @@ func (g *GemHandler) RequestCollectionEventReport(ceid interface{}) (EventReport
 
 // UploadProcessProgram sends an S7F3 to store a process program on the equipment.
 func (g *GemHandler) UploadProcessProgram(ppid interface{}, body string) (int, error) {
+	return g.UploadProcessProgramContext(context.Background(), ppid, body)
+}
+
+// UploadProcessProgramContext is like UploadProcessProgram but gives up when ctx is done.
+func (g *GemHandler) UploadProcessProgramContext(ctx context.Context, ppid interface{}, body string) (int, error) {
 	if g.deviceType != DeviceHost {
 		return -1, ErrOperationNotSupported
 	}
@@ -267,7 +313,7 @@ func (g *GemHandler) UploadProcessProgram(ppid interface{}, body string) (int, e
 		return -1, err
 	}
 
-	resp, err := g.protocol.SendAndWait(g.buildS7F3(info, body))
+	resp, err := g.sendAndWaitContext(ctx, g.buildS7F3(info, body))
 	if err != nil {
 		return -1, err
 	}
@@ -280,6 +326,11 @@ func (g *GemHandler) UploadProcessProgram(ppid interface{}, body string) (int, e
 
 // RequestProcessProgram retrieves a process program via S7F5/S7F6.
 func (g *GemHandler) RequestProcessProgram(ppid interface{}) (string, int, error) {
+	return g.RequestProcessProgramContext(context.Background(), ppid)
+}
+
+// RequestProcessProgramContext is like RequestProcessProgram but gives up when ctx is done.
+func (g *GemHandler) RequestProcessProgramContext(ctx context.Context, ppid interface{}) (string, int, error) {
 	if g.deviceType != DeviceHost {
 		return "", -1, ErrOperationNotSupported
 	}
@@ -292,7 +343,7 @@ func (g *GemHandler) RequestProcessProgram(ppid interface{}) (string, int, error
 		return "", -1, err
 	}
 
-	resp, err := g.protocol.SendAndWait(g.buildS7F5(info))
+	resp, err := g.sendAndWaitContext(ctx, g.buildS7F5(info))
 	if err != nil {
 		return "", -1, err
 	}
@@ -302,6 +353,11 @@ func (g *GemHandler) RequestProcessProgram(ppid interface{}) (string, int, error
 
 // SendEquipmentConstantValues issues an S2F15 update and returns the received acknowledgement code.
 func (g *GemHandler) SendEquipmentConstantValues(updates []EquipmentConstantUpdate) (int, error) {
+	return g.SendEquipmentConstantValuesContext(context.Background(), updates)
+}
+
+// SendEquipmentConstantValuesContext is like SendEquipmentConstantValues but gives up when ctx is done.
+func (g *GemHandler) SendEquipmentConstantValuesContext(ctx context.Context, updates []EquipmentConstantUpdate) (int, error) {
 	if g.deviceType != DeviceHost {
 		return -1, ErrOperationNotSupported
 	}
@@ -317,7 +373,7 @@ func (g *GemHandler) SendEquipmentConstantValues(updates []EquipmentConstantUpda
 		return -1, err
 	}
 
-	response, err := g.protocol.SendAndWait(msg)
+	response, err := g.sendAndWaitContext(ctx, msg)
 	if err != nil {
 		return -1, err
 	}
@@ -404,19 +460,8 @@ func parseStatusInfoResponse(msg *ast.DataMessage) ([]StatusVariableInfo, error)
 			return nil, err
 		}
 
-		name := ""
-		if nameNode.Type() == "ascii" {
-			if v, ok := nameNode.Values().(string); ok {
-				name = v
-			}
-		}
-
-		unit := ""
-		if unitNode.Type() == "ascii" {
-			if v, ok := unitNode.Values().(string); ok {
-				unit = v
-			}
-		}
+		name, _ := textValue(nameNode)
+		unit, _ := textValue(unitNode)
 
 		infos = append(infos, StatusVariableInfo{ID: info.raw, Name: name, Unit: unit})
 	}
@@ -491,17 +536,13 @@ func parseEquipmentConstantInfoResponse(msg *ast.DataMessage) ([]EquipmentConsta
 		}
 
 		name := ""
-		if nameNode, err := entry.Get(1); err == nil && nameNode.Type() == "ascii" {
-			if v, ok := nameNode.Values().(string); ok {
-				name = v
-			}
+		if nameNode, err := entry.Get(1); err == nil {
+			name, _ = textValue(nameNode)
 		}
 
 		unit := ""
-		if unitNode, err := entry.Get(5); err == nil && unitNode.Type() == "ascii" {
-			if v, ok := unitNode.Values().(string); ok {
-				unit = v
-			}
+		if unitNode, err := entry.Get(5); err == nil {
+			unit, _ = textValue(unitNode)
 		}
 
 		minNode, _ := entry.Get(2)
@@ -585,7 +626,7 @@ func parseProcessProgramResponse(msg *ast.DataMessage) (string, int, error) {
 	// entries[0] = PPID（我们目前不使用它的值）
 	// _, _ = entries.Get(0)
 
-	// entries[1] = PPBODY（ASCII 或 Binary）
+	// entries[1] = PPBODY（ASCII、JIS-8、Unicode 或 Binary）
 	bodyNode, err := entries.Get(1)
 	if err != nil {
 		return "", -1, err
@@ -599,6 +640,8 @@ func parseProcessProgramResponse(msg *ast.DataMessage) (string, int, error) {
 		} else {
 			return "", -1, fmt.Errorf("invalid ASCII PPBODY payload type %T", v.Values())
 		}
+	case *ast.JIS8Node, *ast.UnicodeNode:
+		bodyStr, _ = textValue(v)
 	case *ast.BinaryNode:
 		ints, ok := v.Values().([]int)
 		if !ok {
@@ -638,6 +681,11 @@ func parseProcessProgramResponse(msg *ast.DataMessage) (string, int, error) {
 // RequestDateTime sends S2F17 to query equipment time.
 // Returns parsed equipment time.
 func (g *GemHandler) RequestDateTime() (string, error) {
+	return g.RequestDateTimeContext(context.Background())
+}
+
+// RequestDateTimeContext is like RequestDateTime but gives up when ctx is done.
+func (g *GemHandler) RequestDateTimeContext(ctx context.Context) (string, error) {
 	if g.deviceType != DeviceHost {
 		return "", ErrOperationNotSupported
 	}
@@ -648,7 +696,7 @@ func (g *GemHandler) RequestDateTime() (string, error) {
 	// Build and send S2F17 (empty body)
 	request := ast.NewDataMessage("DateTimeRequest", 2, 17, 1, "H->E", ast.NewListNode())
 
-	response, err := g.protocol.SendAndWait(request)
+	response, err := g.sendAndWaitContext(ctx, request)
 	if err != nil {
 		return "", fmt.Errorf("gem: S2F17 failed: %w", err)
 	}
@@ -675,6 +723,11 @@ func (g *GemHandler) RequestDateTime() (string, error) {
 // SetDateTime sends S2F31 to set equipment time.
 // Returns TIACK code: 0=Accepted, 1=Not allowed, 2=Out of sync limit.
 func (g *GemHandler) SetDateTime(timeStr string) (byte, error) {
+	return g.SetDateTimeContext(context.Background(), timeStr)
+}
+
+// SetDateTimeContext is like SetDateTime but gives up when ctx is done.
+func (g *GemHandler) SetDateTimeContext(ctx context.Context, timeStr string) (byte, error) {
 	if g.deviceType != DeviceHost {
 		return 0, ErrOperationNotSupported
 	}
@@ -690,7 +743,7 @@ func (g *GemHandler) SetDateTime(timeStr string) (byte, error) {
 	body := ast.NewASCIINode(timeStr)
 	request := ast.NewDataMessage("DateTimeSetRequest", 2, 31, 1, "H->E", body)
 
-	response, err := g.protocol.SendAndWait(request)
+	response, err := g.sendAndWaitContext(ctx, request)
 	if err != nil {
 		return 0, fmt.Errorf("gem: S2F31 failed: %w", err)
 	}
@@ -381,25 +381,132 @@ func (g *GemHandler) applyEquipmentConstantUpdates(updates []equipmentConstantUp
 		return ECACKAccepted
 	}
 
-	g.ecMu.RLock()
-	defer g.ecMu.RUnlock()
+	type appliedChange struct {
+		constant *EquipmentConstant
+		previous ast.ItemNode
+		value    ast.ItemNode
+	}
 
+	g.ecMu.RLock()
+	constants := make([]*EquipmentConstant, 0, len(updates))
 	for _, upd := range updates {
 		if !upd.ok {
+			g.ecMu.RUnlock()
 			return ECACKInvalidData
 		}
-		if _, ok := g.equipmentConstants[upd.id.key]; !ok {
+		constant, ok := g.equipmentConstants[upd.id.key]
+		if !ok {
+			g.ecMu.RUnlock()
 			return ECACKDoesNotExist
 		}
+		constants = append(constants, constant)
 	}
+	g.ecMu.RUnlock()
 
-	for _, upd := range updates {
-		constant := g.equipmentConstants[upd.id.key]
-		if err := constant.ApplyValue(upd.value); err != nil {
+	// Validate every value before applying any so that S2F15 is all-or-nothing.
+	for i, upd := range updates {
+		if err := constants[i].Validate(upd.value); err != nil {
+			g.logger.Warn("equipment constant update rejected", "ecid", constants[i].ID(), "error", err)
+			return ecackForError(err)
+		}
+	}
+
+	changes := make([]appliedChange, 0, len(updates))
+	for i, upd := range updates {
+		constant := constants[i]
+		previous := safeEquipmentConstantValue(constant, g.logger)
+		if err := constant.store(upd.value); err != nil {
 			g.logger.Warn("equipment constant update rejected", "ecid", constant.ID(), "error", err)
 			return ECACKValidationError
 		}
+		changes = append(changes, appliedChange{constant: constant, previous: previous, value: upd.value})
+	}
+
+	for _, change := range changes {
+		g.fireEquipmentConstantChanged(change.constant, change.previous, change.value, EquipmentConstantChangeHost)
 	}
 
 	return ECACKAccepted
 }
+
+// ecackForError maps equipment constant validation errors onto S2F16 EAC codes.
+func ecackForError(err error) ECACKCode {
+	if errors.Is(err, ErrEquipmentConstantFormat) {
+		return ECACKInvalidData
+	}
+	return ECACKValidationError
+}
+
+// SetEquipmentConstantLocal applies an operator-side change to an equipment constant.
+//
+// The value is validated like a host S2F15 update. On success the EquipmentConstantChanged
+// event fires and, when configured via SetOperatorEquipmentConstantChangeEvent, the
+// OperatorEquipmentConstantChange collection event is reported to the host.
+func (g *GemHandler) SetEquipmentConstantLocal(id interface{}, value ast.ItemNode) error {
+	if g.deviceType != DeviceEquipment {
+		return ErrOperationNotSupported
+	}
+
+	info, err := newIDInfo(id)
+	if err != nil {
+		return err
+	}
+
+	g.ecMu.RLock()
+	constant, ok := g.equipmentConstants[info.key]
+	ceid := g.operatorECChangeCEID
+	g.ecMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("gem: equipment constant %v not registered", id)
+	}
+
+	previous := safeEquipmentConstantValue(constant, g.logger)
+	if err := constant.ApplyValue(value); err != nil {
+		return err
+	}
+
+	g.fireEquipmentConstantChanged(constant, previous, value, EquipmentConstantChangeOperator)
+
+	if ceid != nil && g.State() == CommunicationStateCommunicating {
+		if err := g.TriggerCollectionEvent(ceid); err != nil {
+			g.logger.Warn("operator equipment constant change event failed", "ceid", ceid, "error", err)
+		}
+	}
+	return nil
+}
+
+// SetOperatorEquipmentConstantChangeEvent configures the CEID reported when an
+// operator changes an equipment constant through SetEquipmentConstantLocal.
+// Passing nil disables the report.
+func (g *GemHandler) SetOperatorEquipmentConstantChangeEvent(ceid interface{}) error {
+	if g.deviceType != DeviceEquipment {
+		return ErrOperationNotSupported
+	}
+
+	var raw interface{}
+	if ceid != nil {
+		info, err := newIDInfo(ceid)
+		if err != nil {
+			return err
+		}
+		raw = info.raw
+	}
+
+	g.ecMu.Lock()
+	g.operatorECChangeCEID = raw
+	g.ecMu.Unlock()
+	return nil
+}
+
+func (g *GemHandler) fireEquipmentConstantChanged(constant *EquipmentConstant, previous, value ast.ItemNode, source EquipmentConstantChangeSource) {
+	if g.events.EquipmentConstantChanged == nil {
+		return
+	}
+	g.events.EquipmentConstantChanged.Fire(map[string]interface{}{
+		"handler":  g,
+		"ecid":     constant.ID(),
+		"previous": previous,
+		"value":    value,
+		"source":   source,
+	})
+}
@@ -209,7 +209,7 @@ func (g *GemHandler) buildS6F16(dataID int, ceNode ast.ItemNode, reports []ast.I
 }
 
 func (g *GemHandler) buildS7F3(ppid idInfo, programBody string) *ast.DataMessage {
-	payload := ast.NewListNode(ppid.node, ast.NewASCIINode(programBody))
+	payload := ast.NewListNode(ppid.node, textNode(programBody))
 	return ast.NewDataMessage("ProcessProgramSend", 7, 3, 1, "H->E", payload)
 }
 
@@ -230,7 +230,7 @@ func (g *GemHandler) buildS7F6(ppid ast.ItemNode, programBody string, ack int) *
 	if ppidNode == nil {
 		ppidNode = ast.NewEmptyItemNode()
 	}
-	bodyNode := ast.NewASCIINode(programBody)
+	bodyNode := textNode(programBody)
 	if ack != 0 {
 		bodyNode = ast.NewASCIINode("")
 	}
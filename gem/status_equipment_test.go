@@ -152,6 +152,46 @@ func TestStatusVariableAndEquipmentConstantFlows(t *testing.T) {
 	assertUintValue(t, ecInfo[0].Default, 10)
 }
 
+func TestRequestStatusVariableInfoToleratesExtraItems(t *testing.T) {
+	// Some equipment send S1F12 entries with more than L[SVID, SVNAME, UNITS],
+	// or a SVNAME that is not text; they are accepted with the text left empty.
+	equipment, hostTransport := newLoopbackPair()
+	equipment.RegisterHandler(1, 13, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 14, 0, "H<-E", ast.NewListNode(ast.NewBinaryNode(0), ast.NewListNode())), nil
+	})
+	equipment.RegisterHandler(1, 11, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 12, 0, "H<-E", ast.NewListNode(
+			ast.NewListNode(ast.NewUintNode(4, 1001), ast.NewASCIINode("Temperature"), ast.NewASCIINode("C"), ast.NewASCIINode("extra")),
+			ast.NewListNode(ast.NewUintNode(4, 1002), ast.NewUintNode(4, 7), ast.NewASCIINode("mm")),
+		)), nil
+	})
+	equipment.Enable()
+
+	host, err := gem.NewGemHandler(gem.Options{Protocol: hostTransport, DeviceType: gem.DeviceHost})
+	if err != nil {
+		t.Fatalf("create host handler: %v", err)
+	}
+	host.Enable()
+	t.Cleanup(host.Disable)
+	if !host.WaitForCommunicating(5 * time.Second) {
+		t.Fatal("host failed to reach communicating state")
+	}
+
+	infos, err := host.RequestStatusVariableInfo(1001, 1002)
+	if err != nil {
+		t.Fatalf("S1F11: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected two entries, got %d", len(infos))
+	}
+	if infos[0].Name != "Temperature" || infos[0].Unit != "C" {
+		t.Fatalf("unexpected first entry: %+v", infos[0])
+	}
+	if infos[1].Name != "" || infos[1].Unit != "mm" {
+		t.Fatalf("unexpected second entry: %+v", infos[1])
+	}
+}
+
 func assertUintValue(t *testing.T, node ast.ItemNode, want int) {
 	t.Helper()
 	if node == nil {
@@ -343,6 +383,21 @@ func TestCollectionEventsAndProcessPrograms(t *testing.T) {
 		t.Fatalf("unexpected process program body %q", body)
 	}
 
+	// Non-ASCII bodies are sent as 2-byte character items.
+	const localizedBody = "레시피 温度=200"
+	if ack, err := hostHandler.UploadProcessProgram("PP2", localizedBody); err != nil {
+		t.Fatalf("UploadProcessProgram localized: %v", err)
+	} else if ack != 0 {
+		t.Fatalf("unexpected localized process program ack %d", ack)
+	}
+	body, _, err = hostHandler.RequestProcessProgram("PP2")
+	if err != nil {
+		t.Fatalf("RequestProcessProgram localized: %v", err)
+	}
+	if body != localizedBody {
+		t.Fatalf("unexpected localized process program body %q", body)
+	}
+
 	_, missingAck, err := hostHandler.RequestProcessProgram("UNKNOWN")
 	if err != nil {
 		t.Fatalf("RequestProcessProgram missing: %v", err)
@@ -0,0 +1,47 @@
+package gem
+
+import (
+	"context"
+
+	"github.com/younglifestyle/secs4go/common"
+	"github.com/younglifestyle/secs4go/hsms"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// Transport is the message layer a GemHandler runs on. *hsms.HsmsProtocol
+// and *secs1.Protocol implement it; tests can supply their own.
+//
+// CurrentState reports hsms.StateConnectedSelected once data messages can
+// be exchanged. The handler polls Connected and CurrentState to drive the
+// communication state machine.
+type Transport interface {
+	Enable()
+	Disable()
+
+	SendAndWait(message *ast.DataMessage) (*ast.DataMessage, error)
+	SendAndWaitContext(ctx context.Context, message *ast.DataMessage) (*ast.DataMessage, error)
+	SendDataMessage(message *ast.DataMessage) error
+	RegisterHandler(stream, function int, handler hsms.DataMessageHandler)
+	RegisterDefaultHandler(handler hsms.DataMessageHandler)
+
+	Connected() bool
+	CurrentState() string
+	AddConnectionListener(fn func(hsms.ConnectionEvent))
+
+	// Timeouts supplies T3, which bounds the wait for S1F14.
+	Timeouts() *hsms.SecsTimeout
+	SetLogger(logger common.Logger)
+}
+
+// The handler applies Options.Logging and Options.Dispatch only to
+// transports that support them.
+type (
+	loggingConfigurer interface {
+		ConfigureLogging(cfg hsms.LoggingConfig)
+	}
+	dispatchConfigurer interface {
+		SetDispatch(cfg hsms.DispatchConfig)
+	}
+)
+
+var _ Transport = (*hsms.HsmsProtocol)(nil)
@@ -0,0 +1,189 @@
+package gem_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/common"
+	"github.com/younglifestyle/secs4go/gem"
+	"github.com/younglifestyle/secs4go/hsms"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/secs1"
+	"go.uber.org/atomic"
+)
+
+var _ gem.Transport = (*secs1.Protocol)(nil)
+
+// loopback is an in-process gem.Transport: messages sent on one end are
+// handled synchronously by the handlers registered on the other.
+type loopback struct {
+	peer     *loopback
+	enabled  atomic.Bool
+	timeouts *hsms.SecsTimeout
+
+	mu             sync.RWMutex
+	handlers       map[[2]int]hsms.DataMessageHandler
+	defaultHandler hsms.DataMessageHandler
+}
+
+func newLoopbackPair() (*loopback, *loopback) {
+	a := &loopback{timeouts: hsms.NewSecsTimeout(), handlers: make(map[[2]int]hsms.DataMessageHandler)}
+	b := &loopback{timeouts: hsms.NewSecsTimeout(), handlers: make(map[[2]int]hsms.DataMessageHandler)}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (l *loopback) Enable()  { l.enabled.Store(true) }
+func (l *loopback) Disable() { l.enabled.Store(false) }
+
+func (l *loopback) SendAndWait(message *ast.DataMessage) (*ast.DataMessage, error) {
+	return l.SendAndWaitContext(context.Background(), message)
+}
+
+func (l *loopback) SendAndWaitContext(_ context.Context, message *ast.DataMessage) (*ast.DataMessage, error) {
+	if !l.Connected() {
+		return nil, errors.New("loopback: not connected")
+	}
+	handler := l.peer.lookup(message.StreamCode(), message.FunctionCode())
+	if handler == nil {
+		return nil, errors.New("loopback: no handler")
+	}
+	return handler(message)
+}
+
+func (l *loopback) SendDataMessage(message *ast.DataMessage) error {
+	_, err := l.SendAndWait(message)
+	return err
+}
+
+func (l *loopback) RegisterHandler(stream, function int, handler hsms.DataMessageHandler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers[[2]int{stream, function}] = handler
+}
+
+func (l *loopback) RegisterDefaultHandler(handler hsms.DataMessageHandler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.defaultHandler = handler
+}
+
+func (l *loopback) lookup(stream, function int) hsms.DataMessageHandler {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if handler, ok := l.handlers[[2]int{stream, function}]; ok {
+		return handler
+	}
+	return l.defaultHandler
+}
+
+func (l *loopback) Connected() bool {
+	return l.enabled.Load() && l.peer.enabled.Load()
+}
+
+func (l *loopback) CurrentState() string {
+	if l.Connected() {
+		return hsms.StateConnectedSelected
+	}
+	return hsms.StateNotConnected
+}
+
+func (l *loopback) AddConnectionListener(func(hsms.ConnectionEvent)) {}
+func (l *loopback) Timeouts() *hsms.SecsTimeout                      { return l.timeouts }
+func (l *loopback) SetLogger(common.Logger)                          {}
+
+// requestStatusOver runs an equipment and a host handler over the given
+// transports and reads a status variable.
+func requestStatusOver(t *testing.T, equipmentTransport, hostTransport gem.Transport) {
+	t.Helper()
+	newHandler := func(transport gem.Transport, deviceType gem.DeviceType) *gem.GemHandler {
+		t.Helper()
+		handler, err := gem.NewGemHandler(gem.Options{
+			Protocol:   transport,
+			DeviceType: deviceType,
+		})
+		if err != nil {
+			t.Fatalf("create %s handler: %v", deviceType, err)
+		}
+		return handler
+	}
+
+	equipment := newHandler(equipmentTransport, gem.DeviceEquipment)
+	sv, err := gem.NewStatusVariable(1001, "Temperature", "C",
+		gem.WithStatusValueProvider(func() (ast.ItemNode, error) {
+			return ast.NewUintNode(4, 42), nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("create status variable: %v", err)
+	}
+	if err := equipment.RegisterStatusVariable(sv); err != nil {
+		t.Fatalf("register status variable: %v", err)
+	}
+	equipment.Enable()
+	t.Cleanup(equipment.Disable)
+	time.Sleep(100 * time.Millisecond)
+
+	host := newHandler(hostTransport, gem.DeviceHost)
+	host.Enable()
+	t.Cleanup(host.Disable)
+
+	if !host.WaitForCommunicating(5 * time.Second) {
+		t.Fatal("host failed to reach communicating state")
+	}
+	values, err := host.RequestStatusVariables(1001)
+	if err != nil {
+		t.Fatalf("S1F3: %v", err)
+	}
+	if len(values) != 1 {
+		t.Fatalf("expected one value, got %d", len(values))
+	}
+	assertUintValue(t, values[0].Value, 42)
+}
+
+func TestGemHandlersOverMemoryTransport(t *testing.T) {
+	transport := hsms.NewMemoryTransport()
+	newProtocol := func(active bool, name string) *hsms.HsmsProtocol {
+		protocol := hsms.NewHsmsProtocol("tool", 5000, active, 0x0100, name)
+		protocol.Timeouts().SetLinktest(60)
+		protocol.SetTransport(transport)
+		return protocol
+	}
+	requestStatusOver(t, newProtocol(false, "equipment"), newProtocol(true, "host"))
+}
+
+func TestGemHandlersWithLazyDecoding(t *testing.T) {
+	// Both ends receive ast.LazyItem bodies, in requests and in replies
+	transport := hsms.NewMemoryTransport()
+	newProtocol := func(active bool, name string) *hsms.HsmsProtocol {
+		protocol := hsms.NewHsmsProtocol("tool", 5000, active, 0x0100, name)
+		protocol.Timeouts().SetLinktest(60)
+		protocol.SetTransport(transport)
+		protocol.SetLazyDecoding(true)
+		return protocol
+	}
+	requestStatusOver(t, newProtocol(false, "equipment"), newProtocol(true, "host"))
+}
+
+func TestGemHandlersOverLoopback(t *testing.T) {
+	equipment, host := newLoopbackPair()
+	requestStatusOver(t, equipment, host)
+}
+
+func TestGemHandlersOverSECSIOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	requestStatusOver(t,
+		secs1.NewTCPProtocol("127.0.0.1", port, false, true, 0x0100, "equipment"),
+		secs1.NewTCPProtocol("127.0.0.1", port, true, false, 0x0100, "host"),
+	)
+}
@@ -8,6 +8,7 @@ require (
 	github.com/looplab/fsm v1.0.1
 	github.com/stretchr/testify v1.8.4
 	go.uber.org/atomic v1.11.0
+	golang.org/x/text v0.28.0
 )
 
 require (
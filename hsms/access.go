@@ -0,0 +1,276 @@
+package hsms
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/younglifestyle/secs4go/common"
+	"go.uber.org/atomic"
+)
+
+var (
+	// ErrAddressNotAllowed is reported for a connection from outside the allow-list.
+	ErrAddressNotAllowed = errors.New("hsms: remote address not allowed")
+	// ErrRateLimited is reported for a connection over the per-IP rate limit.
+	ErrRateLimited = errors.New("hsms: connection rate limit exceeded")
+	// ErrConnectionBusy is reported for a connection refused by ConnectionPolicyReject.
+	ErrConnectionBusy = errors.New("hsms: connection already established")
+)
+
+// AccessPolicy restricts the connections a passive protocol or a Server
+// accepts. It is checked before an HSMS session is created for the
+// connection; refused connections are closed, logged and counted.
+type AccessPolicy struct {
+	// Allow lists the remote networks that may connect, as CIDRs
+	// ("10.1.0.0/16") or single IPs. An empty list allows every address.
+	Allow []string
+	// RateLimit is the number of connections one IP may open within
+	// RatePeriod. Zero disables the limit.
+	RateLimit  int
+	RatePeriod time.Duration
+}
+
+// ConnectionPolicy decides what a passive protocol does with a valid
+// connection that arrives while it already has one.
+type ConnectionPolicy int
+
+const (
+	// ConnectionPolicyWait leaves the new connection unanswered until the
+	// current one ends. It is the default.
+	ConnectionPolicyWait ConnectionPolicy = iota
+	// ConnectionPolicyReject closes the new connection.
+	ConnectionPolicyReject
+	// ConnectionPolicyReplace closes the current connection, e.g. one the
+	// peer abandoned without closing, and serves the new one.
+	ConnectionPolicyReplace
+)
+
+func (c ConnectionPolicy) String() string {
+	switch c {
+	case ConnectionPolicyWait:
+		return "wait"
+	case ConnectionPolicyReject:
+		return "reject"
+	case ConnectionPolicyReplace:
+		return "replace"
+	default:
+		return "unknown"
+	}
+}
+
+// AccessStats counts refused connections.
+type AccessStats struct {
+	NotAllowed  uint64
+	RateLimited uint64
+	Busy        uint64
+}
+
+// accessFilter checks remote addresses against an AccessPolicy. It outlives
+// single listeners, so rate limits hold across the listener a passive
+// protocol opens for each connection.
+type accessFilter struct {
+	mu       sync.Mutex
+	networks []*net.IPNet
+	limit    int
+	period   time.Duration
+	recent   map[string][]time.Time
+
+	notAllowed  *atomic.Uint64
+	rateLimited *atomic.Uint64
+	busy        *atomic.Uint64
+}
+
+func newAccessFilter() *accessFilter {
+	return &accessFilter{
+		recent:      make(map[string][]time.Time),
+		notAllowed:  atomic.NewUint64(0),
+		rateLimited: atomic.NewUint64(0),
+		busy:        atomic.NewUint64(0),
+	}
+}
+
+// configure replaces the policy. Invalid entries leave the filter unchanged.
+func (f *accessFilter) configure(policy AccessPolicy) error {
+	networks := make([]*net.IPNet, 0, len(policy.Allow))
+	for _, entry := range policy.Allow {
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return err
+		}
+		networks = append(networks, network)
+	}
+	if policy.RateLimit > 0 && policy.RatePeriod <= 0 {
+		return fmt.Errorf("hsms: rate limit %d needs a positive rate period", policy.RateLimit)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.networks = networks
+	f.limit = policy.RateLimit
+	f.period = policy.RatePeriod
+	f.recent = make(map[string][]time.Time)
+	return nil
+}
+
+func parseNetwork(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("hsms: invalid allow-list entry %q: %w", entry, err)
+		}
+		return network, nil
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("hsms: invalid allow-list entry %q", entry)
+	}
+	bits := 8 * net.IPv6len
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// check reports why a connection from addr must be refused, or nil. An
+// allowed connection counts against the rate limit of its IP.
+func (f *accessFilter) check(addr net.Addr, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.networks) == 0 && f.limit == 0 {
+		return nil
+	}
+
+	ip := addrIP(addr)
+	if len(f.networks) > 0 {
+		allowed := false
+		for _, network := range f.networks {
+			if ip != nil && network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			f.notAllowed.Inc()
+			return ErrAddressNotAllowed
+		}
+	}
+
+	if f.limit > 0 && ip != nil {
+		key := ip.String()
+		since := now.Add(-f.period)
+		for host, times := range f.recent {
+			// Drop hosts that have been quiet for a whole period.
+			if len(times) > 0 && !times[len(times)-1].After(since) {
+				delete(f.recent, host)
+			}
+		}
+		times := f.recent[key]
+		for len(times) > 0 && !times[0].After(since) {
+			times = times[1:]
+		}
+		if len(times) >= f.limit {
+			f.recent[key] = times
+			f.rateLimited.Inc()
+			return ErrRateLimited
+		}
+		f.recent[key] = append(times, now)
+	}
+	return nil
+}
+
+func (f *accessFilter) stats() AccessStats {
+	return AccessStats{
+		NotAllowed:  f.notAllowed.Load(),
+		RateLimited: f.rateLimited.Load(),
+		Busy:        f.busy.Load(),
+	}
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// accessListener closes the connections its filter refuses before Accept
+// returns them.
+type accessListener struct {
+	net.Listener
+	filter   *accessFilter
+	logger   common.Logger
+	onRefuse func(addr net.Addr, err error)
+}
+
+func (l *accessListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := l.filter.check(conn.RemoteAddr(), time.Now()); err != nil {
+			l.logger.Warn("connection refused", "remote", conn.RemoteAddr(), "error", err)
+			_ = conn.Close()
+			if l.onRefuse != nil {
+				l.onRefuse(conn.RemoteAddr(), err)
+			}
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// SetAccessPolicy restricts the remote addresses that may connect to a
+// passive protocol. It applies to the next accepted connection.
+func (p *HsmsProtocol) SetAccessPolicy(policy AccessPolicy) error {
+	return p.access.configure(policy)
+}
+
+// SetConnectionPolicy decides what a passive protocol does with a connection
+// that arrives while it is connected. The default is ConnectionPolicyWait.
+// Changes apply from the next Enable.
+func (p *HsmsProtocol) SetConnectionPolicy(policy ConnectionPolicy) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.connectionPolicy = policy
+}
+
+func (p *HsmsProtocol) getConnectionPolicy() ConnectionPolicy {
+	p.transportMu.RLock()
+	defer p.transportMu.RUnlock()
+	return p.connectionPolicy
+}
+
+// AccessStats returns the number of connections refused so far.
+func (p *HsmsProtocol) AccessStats() AccessStats {
+	return p.access.stats()
+}
+
+// refuseConnection publishes a connection refused by the access policy or
+// the connection policy.
+func (p *HsmsProtocol) refuseConnection(addr net.Addr, err error) {
+	p.publish(ConnectionEvent{Type: EventConnectionRefused, RemoteAddr: addr, Err: err})
+}
+
+// SetAccessPolicy restricts the remote addresses that may connect to the
+// server. It applies to the next accepted connection.
+func (s *Server) SetAccessPolicy(policy AccessPolicy) error {
+	return s.access.configure(policy)
+}
+
+// AccessStats returns the number of connections the server refused so far.
+func (s *Server) AccessStats() AccessStats {
+	return s.access.stats()
+}
@@ -0,0 +1,152 @@
+package hsms
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestPassive(t *testing.T, configure func(*HsmsProtocol)) (*HsmsProtocol, int, *eventRecorder) {
+	t.Helper()
+	port := freePort(t)
+	p := NewHsmsProtocol("127.0.0.1", port, false, 1, "equipment")
+	p.Timeouts().SetLinktest(60)
+	configure(p)
+	recorder := &eventRecorder{}
+	p.AddConnectionListener(recorder.record)
+	p.Enable()
+	t.Cleanup(p.Disable)
+	waitForListening(t, p)
+	return p, port, recorder
+}
+
+// expectClosed dials port and waits for the passive side to close the connection.
+func expectClosed(t *testing.T, port int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("connection not closed: %v", err)
+	}
+}
+
+func TestAccessPolicyAllowList(t *testing.T) {
+	passive, port, recorder := newTestPassive(t, func(p *HsmsProtocol) {
+		if err := p.SetAccessPolicy(AccessPolicy{Allow: []string{"10.0.0.0/8"}}); err != nil {
+			t.Fatalf("SetAccessPolicy: %v", err)
+		}
+	})
+
+	expectClosed(t, port)
+	refused := recorder.waitFor(t, EventConnectionRefused, time.Second)
+	if !errors.Is(refused.Err, ErrAddressNotAllowed) || refused.RemoteAddr == nil {
+		t.Fatalf("unexpected refusal event %+v", refused)
+	}
+	if stats := passive.AccessStats(); stats.NotAllowed != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if err := passive.SetAccessPolicy(AccessPolicy{Allow: []string{"10.0.0.0/8", "127.0.0.1"}}); err != nil {
+		t.Fatalf("SetAccessPolicy: %v", err)
+	}
+	active := newTestActive(t, port, 1, "host")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+}
+
+func TestAccessPolicyRateLimitAndReject(t *testing.T) {
+	passive, port, _ := newTestPassive(t, func(p *HsmsProtocol) {
+		p.SetConnectionPolicy(ConnectionPolicyReject)
+		if err := p.SetAccessPolicy(AccessPolicy{RateLimit: 2, RatePeriod: time.Minute}); err != nil {
+			t.Fatalf("SetAccessPolicy: %v", err)
+		}
+	})
+
+	active := newTestActive(t, port, 1, "host")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	expectClosed(t, port) // second connection: busy
+	expectClosed(t, port) // third connection: over the rate limit
+	if stats := passive.AccessStats(); stats.Busy != 1 || stats.RateLimited != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if active.CurrentState() != StateConnectedSelected {
+		t.Fatalf("first connection lost: %s", active.CurrentState())
+	}
+}
+
+func TestConnectionPolicyReplace(t *testing.T) {
+	passive, port, recorder := newTestPassive(t, func(p *HsmsProtocol) {
+		p.SetConnectionPolicy(ConnectionPolicyReplace)
+	})
+
+	stale := newTestActive(t, port, 1, "stale")
+	waitForState(t, passive, StateConnectedSelected, 3*time.Second)
+
+	fresh := newTestActive(t, port, 1, "fresh")
+	waitForState(t, fresh, StateConnectedSelected, 3*time.Second)
+	waitForState(t, stale, StateNotConnected, 3*time.Second)
+
+	if event := recorder.waitFor(t, EventDisconnected, time.Second); event.Reason != DisconnectReasonReplaced {
+		t.Fatalf("unexpected disconnect reason %s", event.Reason)
+	}
+}
+
+func TestAccessFilter(t *testing.T) {
+	f := newAccessFilter()
+	for _, bad := range []string{"10.0.0.0/33", "host", ""} {
+		if err := f.configure(AccessPolicy{Allow: []string{bad}}); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+	if err := f.configure(AccessPolicy{RateLimit: 1}); err == nil {
+		t.Fatal("expected an error for a rate limit without period")
+	}
+
+	if err := f.configure(AccessPolicy{Allow: []string{"192.168.1.0/24", "::1"}, RateLimit: 1, RatePeriod: time.Second}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	now := time.Now()
+	addr := func(ip string) net.Addr { return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1000} }
+
+	if err := f.check(addr("192.168.2.1"), now); !errors.Is(err, ErrAddressNotAllowed) {
+		t.Fatalf("expected ErrAddressNotAllowed, got %v", err)
+	}
+	if err := f.check(addr("::1"), now); err != nil {
+		t.Fatalf("::1: %v", err)
+	}
+	if err := f.check(addr("192.168.1.7"), now); err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	if err := f.check(addr("192.168.1.7"), now.Add(500*time.Millisecond)); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if err := f.check(addr("192.168.1.7"), now.Add(2*time.Second)); err != nil {
+		t.Fatalf("after the period: %v", err)
+	}
+	if stats := f.stats(); stats.NotAllowed != 1 || stats.RateLimited != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestServerAccessPolicy(t *testing.T) {
+	server := NewServer("127.0.0.1", 0)
+	if err := server.SetAccessPolicy(AccessPolicy{Allow: []string{"10.0.0.0/8"}}); err != nil {
+		t.Fatalf("SetAccessPolicy: %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	expectClosed(t, server.Addr().(*net.TCPAddr).Port)
+	if stats := server.AccessStats(); stats.NotAllowed != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -1,17 +1,55 @@
 package hsms
 
+import "fmt"
+
 // ControlStatus encodes HSMS select/deselect response statuses.
 type ControlStatus byte
 
 const (
-	ControlStatusAccepted ControlStatus = 0
-	ControlStatusDenied   ControlStatus = 1
+	ControlStatusAccepted      ControlStatus = 0
+	ControlStatusDenied        ControlStatus = 1
+	ControlStatusNotReady      ControlStatus = 2
+	ControlStatusEntityUnknown ControlStatus = 4
 )
 
 // RejectReason enumerates HSMS reject codes used by the stack.
 type RejectReason byte
 
 const (
+	RejectReasonSTypeNotSupported  RejectReason = 1
+	RejectReasonPTypeNotSupported  RejectReason = 2
+	RejectReasonTransactionNotOpen RejectReason = 3
+	RejectReasonEntityNotSelected  RejectReason = 4
+
+	// RejectReasonBusyOrAlreadyActive is an old name of reason 2.
+	//
+	// Deprecated: E37 defines 2 as "PType not supported"; use
+	// RejectReasonPTypeNotSupported, or RejectReasonQueueFull for a full
+	// dispatch queue.
 	RejectReasonBusyOrAlreadyActive RejectReason = 2
-	RejectReasonNotReady            RejectReason = 4
+	// RejectReasonNotReady is an old name of reason 4.
+	//
+	// Deprecated: use RejectReasonEntityNotSelected, which has the same value.
+	RejectReasonNotReady RejectReason = 4
+
+	// RejectReasonQueueFull is a subsidiary reason (128 and up): a data message
+	// was refused because the dispatch queue was full, see DispatchConfig.
+	RejectReasonQueueFull RejectReason = 128
 )
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectReasonSTypeNotSupported:
+		return "SType not supported"
+	case RejectReasonPTypeNotSupported:
+		return "PType not supported"
+	case RejectReasonTransactionNotOpen:
+		return "transaction not open"
+	case RejectReasonEntityNotSelected:
+		return "entity not selected"
+	case RejectReasonQueueFull:
+		return "dispatch queue full"
+	default:
+		return fmt.Sprintf("reason %d", byte(r))
+	}
+}
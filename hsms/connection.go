@@ -1,10 +1,14 @@
 package hsms
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	link "github.com/younglifestyle/secs4go"
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/utils"
 )
 
 var HSMSSTYPES = map[int]string{
@@ -25,7 +29,9 @@ type HsmsConnection struct {
 	remotePort    int
 	sessionID     int
 	hp            *HsmsProtocol
-	connection    *link.Session
+
+	mu         sync.RWMutex
+	connection *link.Session
 }
 
 func NewHsmsConnection(active bool, address string, port int, sessionID int, delegate *HsmsProtocol) *HsmsConnection {
@@ -40,56 +46,93 @@ func NewHsmsConnection(active bool, address string, port int, sessionID int, del
 }
 
 func (c *HsmsConnection) Session() *link.Session {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.connection
 }
 
 func (c *HsmsConnection) SetSession(session *link.Session) {
+	c.mu.Lock()
 	c.connection = session
+	c.mu.Unlock()
 }
 
 func (c *HsmsConnection) Send(msg interface{}) error {
-	if c.connection == nil {
+	session := c.Session()
+	if session == nil {
 		return ErrNotConnected
 	}
-	return c.connection.Send(msg)
+	return session.Send(msg)
 }
 
+// Close closes the connection. Session entities of a general session only
+// detach from the shared connection.
 func (c *HsmsConnection) Close() error {
-	if c.connection == nil {
+	if c.hp.owner != nil {
+		c.hp.owner.detach(c.hp)
+		return nil
+	}
+	session := c.Session()
+	if session == nil {
 		return nil
 	}
-	return c.connection.Close()
+	return session.Close()
 }
 
 func (c *HsmsConnection) sendRejectRsp(packet ast.HSMSMessage, reasonCode byte) {
 	rejectReq := ast.NewHSMSMessageRejectReqFromMsg(packet, reasonCode)
 	c.hp.logControlMessage("TX", rejectReq)
-	if err := c.connection.Send(rejectReq.ToBytes()); err != nil {
+	if err := c.Send(rejectReq); err != nil {
 		c.hp.logger.Error("send reject rsp failed", "error", err)
 	}
 }
 
-func (c *HsmsConnection) sendLinktestReq() {
+func (c *HsmsConnection) sendLinktestReq() error {
 	systemID := c.hp.getNextSystemCounter()
 	queue := c.hp.createQueue(systemID)
 	defer c.hp.removeQueue(systemID)
 
 	message := ast.NewHSMSMessageLinktestReq(c.hp.encodeSystemID(systemID))
 	c.hp.logControlMessage("TX", message)
-	if err := c.connection.Send(message.ToBytes()); err != nil {
+	if err := c.Send(message); err != nil {
 		c.hp.logger.Error("send linktest.req failed", "error", err)
-		return
+		return err
+	}
+
+	_, err := c.awaitControlRsp(context.Background(), queue, "linktest.req", DisconnectReasonLinktest)
+	return err
+}
+
+// awaitControlRsp waits T6 for the response to a control request. The standard
+// treats an expired T6 as a communication failure, so the connection is closed.
+// When ctx is done first, ctx.Err() is returned and the connection is kept.
+func (c *HsmsConnection) awaitControlRsp(ctx context.Context, queue *utils.Deque, request string, reason DisconnectReason) (interface{}, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(c.hp.timeouts.T6ControlTransTimeout())*time.Second)
+	defer cancel()
+
+	resp, err := queue.GetContext(waitCtx)
+	if err == nil {
+		if rejectErr, ok := resp.(error); ok {
+			return nil, rejectErr
+		}
+		return resp, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
 
-	if _, err := queue.Get(c.hp.timeouts.T6ControlTransTimeout()); err != nil {
-		c.hp.logger.Warn("timeout waiting linktest.rsp", "error", err)
+	c.hp.logger.Warn("T6 timeout, closing connection", "request", request, "t6", c.hp.timeouts.T6ControlTransTimeout())
+	c.hp.setDisconnectReason(reason, ErrT6Timeout)
+	if closeErr := c.Close(); closeErr != nil {
+		c.hp.logger.Error("close session after T6 timeout", "error", closeErr)
 	}
+	return nil, fmt.Errorf("%w: no response to %s", ErrT6Timeout, request)
 }
 
 func (c *HsmsConnection) sendDeselectRsp(message ast.HSMSMessage, status ControlStatus) {
 	response := ast.NewHSMSMessageDeselectRsp(message, byte(status))
 	c.hp.logControlMessage("TX", response)
-	if err := c.connection.Send(response.ToBytes()); err != nil {
+	if err := c.Send(response); err != nil {
 		c.hp.logger.Error("send deselect.rsp failed", "error", err)
 	}
 }
@@ -97,7 +140,7 @@ func (c *HsmsConnection) sendDeselectRsp(message ast.HSMSMessage, status Control
 func (c *HsmsConnection) sendSelectRsp(message ast.HSMSMessage, status ControlStatus) {
 	response := ast.NewHSMSMessageSelectRsp(message, byte(status))
 	c.hp.logControlMessage("TX", response)
-	if err := c.connection.Send(response.ToBytes()); err != nil {
+	if err := c.Send(response); err != nil {
 		c.hp.logger.Error("send select.rsp failed", "error", err)
 	}
 }
@@ -105,7 +148,7 @@ func (c *HsmsConnection) sendSelectRsp(message ast.HSMSMessage, status ControlSt
 func (c *HsmsConnection) sendLinkTestRsp(message ast.HSMSMessage) {
 	response := ast.NewHSMSMessageLinktestRsp(message)
 	c.hp.logControlMessage("TX", response)
-	if err := c.connection.Send(response.ToBytes()); err != nil {
+	if err := c.Send(response); err != nil {
 		c.hp.logger.Error("send linktest.rsp failed", "error", err)
 	}
 }
@@ -113,7 +156,7 @@ func (c *HsmsConnection) sendLinkTestRsp(message ast.HSMSMessage) {
 func (c *HsmsConnection) sendReject(message ast.HSMSMessage, reason RejectReason) {
 	reject := ast.NewHSMSMessageRejectReqFromMsg(message, byte(reason))
 	c.hp.logControlMessage("TX", reject)
-	if err := c.connection.Send(reject.ToBytes()); err != nil {
+	if err := c.Send(reject); err != nil {
 		c.hp.logger.Error("send reject.req failed", "error", err)
 	}
 }
@@ -125,14 +168,13 @@ func (c *HsmsConnection) sendSelectReq() error {
 
 	request := ast.NewHSMSMessageSelectReq(uint16(c.hp.sessionID), c.hp.encodeSystemID(systemID))
 	c.hp.logControlMessage("TX", request)
-	if err := c.connection.Send(request.ToBytes()); err != nil {
+	if err := c.Send(request); err != nil {
 		c.hp.logger.Error("send select.req failed", "error", err)
 		return err
 	}
 
-	resp, err := queue.Get(c.hp.timeouts.T6ControlTransTimeout())
+	resp, err := c.awaitControlRsp(context.Background(), queue, "select.req", DisconnectReasonT6)
 	if err != nil {
-		c.hp.logger.Warn("timeout waiting select.rsp", "error", err)
 		return err
 	}
 
@@ -151,21 +193,20 @@ func (c *HsmsConnection) sendSelectReq() error {
 	return nil
 }
 
-func (c *HsmsConnection) sendDeselectReq() error {
+func (c *HsmsConnection) sendDeselectReq(ctx context.Context) error {
 	systemID := c.hp.getNextSystemCounter()
 	queue := c.hp.createQueue(systemID)
 	defer c.hp.removeQueue(systemID)
 
 	request := ast.NewHSMSMessageDeselectReq(uint16(c.hp.sessionID), c.hp.encodeSystemID(systemID))
 	c.hp.logControlMessage("TX", request)
-	if err := c.connection.Send(request.ToBytes()); err != nil {
+	if err := c.Send(request); err != nil {
 		c.hp.logger.Error("send deselect.req failed", "error", err)
 		return err
 	}
 
-	resp, err := queue.Get(c.hp.timeouts.T6ControlTransTimeout())
+	resp, err := c.awaitControlRsp(ctx, queue, "deselect.req", DisconnectReasonT6)
 	if err != nil {
-		c.hp.logger.Warn("timeout waiting deselect.rsp", "error", err)
 		return err
 	}
 
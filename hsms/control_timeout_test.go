@@ -0,0 +1,126 @@
+package hsms
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/parser/hsms"
+)
+
+// startScriptedPeer accepts HSMS connections and writes whatever respond
+// returns for each received message.
+func startScriptedPeer(t *testing.T, respond func(msg ast.HSMSMessage) []ast.HSMSMessage) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					length := make([]byte, 4)
+					if _, err := io.ReadFull(conn, length); err != nil {
+						return
+					}
+					frame := make([]byte, 4+binary.BigEndian.Uint32(length))
+					copy(frame, length)
+					if _, err := io.ReadFull(conn, frame[4:]); err != nil {
+						return
+					}
+					msg, ok := hsms.Parse(frame)
+					if !ok {
+						continue
+					}
+					for _, reply := range respond(msg) {
+						_, _ = conn.Write(reply.ToBytes())
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// startSilentPeer answers Select.req only when answerSelect is set and
+// ignores every other control request.
+func startSilentPeer(t *testing.T, answerSelect bool) int {
+	t.Helper()
+	return startScriptedPeer(t, func(msg ast.HSMSMessage) []ast.HSMSMessage {
+		if answerSelect && msg.Type() == hsms.SelectReqStr {
+			return []ast.HSMSMessage{ast.NewHSMSMessageSelectRsp(msg, byte(ControlStatusAccepted))}
+		}
+		return nil
+	})
+}
+
+func TestLinktestT6TimeoutReconnects(t *testing.T) {
+	port := startSilentPeer(t, true)
+
+	active := NewHsmsProtocol("127.0.0.1", port, true, 1, "active")
+	active.Timeouts().SetT6ControlTransTimeout(1)
+	active.Timeouts().SetT5ConnSeparateTimeout(1)
+	active.Timeouts().SetLinktest(60)
+	events := &eventRecorder{}
+	active.AddConnectionListener(events.record)
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	disconnected := events.waitFor(t, EventDisconnected, 3*time.Second)
+	if disconnected.Reason != DisconnectReasonLinktest || !errors.Is(disconnected.Err, ErrT6Timeout) {
+		t.Fatalf("expected linktest T6 failure, got %s (%v)", disconnected.Reason, disconnected.Err)
+	}
+	if failures := active.LinktestFailures(); failures < 1 {
+		t.Fatalf("expected linktest failures to be counted, got %d", failures)
+	}
+
+	events.waitFor(t, EventReconnectScheduled, time.Second)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		connects := 0
+		for _, typ := range events.types() {
+			if typ == EventConnected {
+				connects++
+			}
+		}
+		if connects >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected a reconnect after the linktest failure")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSelectT6Timeout(t *testing.T) {
+	port := startSilentPeer(t, false)
+
+	active := NewHsmsProtocol("127.0.0.1", port, true, 1, "active")
+	active.Timeouts().SetT6ControlTransTimeout(1)
+	active.Timeouts().SetT5ConnSeparateTimeout(60)
+	events := &eventRecorder{}
+	active.AddConnectionListener(events.record)
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	disconnected := events.waitFor(t, EventDisconnected, 3*time.Second)
+	if disconnected.Reason != DisconnectReasonT6 || !errors.Is(disconnected.Err, ErrT6Timeout) {
+		t.Fatalf("expected select T6 failure, got %s (%v)", disconnected.Reason, disconnected.Err)
+	}
+	if failures := active.LinktestFailures(); failures != 0 {
+		t.Fatalf("select timeout must not count as linktest failure, got %d", failures)
+	}
+}
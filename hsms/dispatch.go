@@ -0,0 +1,172 @@
+package hsms
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// DispatchMode selects how received primary messages reach their handlers.
+type DispatchMode int
+
+const (
+	// DispatchInline runs handlers on the receive loop, one message at a time.
+	DispatchInline DispatchMode = iota
+	// DispatchGoroutine runs every handler on its own goroutine. No ordering is guaranteed.
+	DispatchGoroutine
+	// DispatchWorkerPool runs handlers on a fixed set of workers. Messages with
+	// the same key always go to the same worker and are handled in order.
+	DispatchWorkerPool
+)
+
+// OverflowPolicy decides how a message is refused when the dispatch queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowRejectHSMS answers with an HSMS Reject.req with reason
+	// RejectReasonQueueFull.
+	OverflowRejectHSMS OverflowPolicy = iota
+	// OverflowRejectS9 answers with the S9 error in DispatchConfig.S9Function.
+	OverflowRejectS9
+)
+
+const defaultDispatchQueueDepth = 64
+
+// DispatchConfig configures handler dispatch. The zero value is inline dispatch.
+type DispatchConfig struct {
+	Mode DispatchMode
+	// Workers is the worker count for DispatchWorkerPool. Defaults to 4.
+	Workers int
+	// QueueDepth limits pending messages per worker for DispatchWorkerPool
+	// (default 64), or handlers running at once for DispatchGoroutine
+	// (default unlimited).
+	QueueDepth int
+	// Key groups messages that must be handled in order. Defaults to the stream code.
+	Key func(msg *ast.DataMessage) string
+	// Overflow selects how messages beyond QueueDepth are refused.
+	Overflow OverflowPolicy
+	// S9Function is the S9 error sent with OverflowRejectS9, e.g.
+	// S9F9TransactionTimeout if the host retries on it. No S9 error means
+	// "busy", so there is no default; without it, OverflowRejectS9 falls back
+	// to the HSMS Reject.req.
+	S9Function int
+}
+
+// StreamKey is the default dispatch key: messages are ordered per stream.
+func StreamKey(msg *ast.DataMessage) string {
+	return strconv.Itoa(msg.StreamCode())
+}
+
+// CollectionEventKey orders S6F11 event reports per CEID and all other
+// messages per stream.
+func CollectionEventKey(msg *ast.DataMessage) string {
+	if msg.StreamCode() == 6 && msg.FunctionCode() == 11 {
+		if ceid, err := msg.Get(1); err == nil {
+			return fmt.Sprintf("CE:%v", ceid.Values())
+		}
+	}
+	return StreamKey(msg)
+}
+
+// SetDispatch changes how received primary messages are dispatched to
+// handlers. The new configuration applies from the next connection.
+func (p *HsmsProtocol) SetDispatch(cfg DispatchConfig) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueDepth <= 0 && cfg.Mode == DispatchWorkerPool {
+		cfg.QueueDepth = defaultDispatchQueueDepth
+	}
+	if cfg.Key == nil {
+		cfg.Key = StreamKey
+	}
+	p.dispatchMu.Lock()
+	p.dispatchCfg = cfg
+	p.dispatchMu.Unlock()
+}
+
+// dispatcher delivers the primary messages of one connection to handlers.
+type dispatcher struct {
+	p      *HsmsProtocol
+	cfg    DispatchConfig
+	queues []chan *ast.DataMessage
+	slots  chan struct{}
+}
+
+func (p *HsmsProtocol) newDispatcher() *dispatcher {
+	p.dispatchMu.RLock()
+	cfg := p.dispatchCfg
+	p.dispatchMu.RUnlock()
+
+	d := &dispatcher{p: p, cfg: cfg}
+	switch cfg.Mode {
+	case DispatchWorkerPool:
+		d.queues = make([]chan *ast.DataMessage, cfg.Workers)
+		for idx := range d.queues {
+			queue := make(chan *ast.DataMessage, cfg.QueueDepth)
+			d.queues[idx] = queue
+			go d.work(queue)
+		}
+	case DispatchGoroutine:
+		if cfg.QueueDepth > 0 {
+			d.slots = make(chan struct{}, cfg.QueueDepth)
+		}
+	}
+	return d
+}
+
+func (d *dispatcher) dispatch(msg *ast.DataMessage) {
+	switch d.cfg.Mode {
+	case DispatchWorkerPool:
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(d.cfg.Key(msg)))
+		select {
+		case d.queues[hash.Sum32()%uint32(len(d.queues))] <- msg:
+		default:
+			d.overflow(msg)
+		}
+
+	case DispatchGoroutine:
+		if d.slots != nil {
+			select {
+			case d.slots <- struct{}{}:
+			default:
+				d.overflow(msg)
+				return
+			}
+		}
+		go func() {
+			d.p.handleDataMessage(msg)
+			if d.slots != nil {
+				<-d.slots
+			}
+		}()
+
+	default:
+		d.p.handleDataMessage(msg)
+	}
+}
+
+func (d *dispatcher) work(queue chan *ast.DataMessage) {
+	for msg := range queue {
+		d.p.handleDataMessage(msg)
+	}
+}
+
+func (d *dispatcher) overflow(msg *ast.DataMessage) {
+	d.p.logger.Warn("dispatch queue full, refusing message", "stream", msg.StreamCode(), "function", msg.FunctionCode())
+	if d.cfg.Overflow == OverflowRejectS9 && d.cfg.S9Function != 0 {
+		d.p.sendS9(d.cfg.S9Function, msg)
+		return
+	}
+	d.p.hsmsConnection.sendReject(msg, RejectReasonQueueFull)
+}
+
+// stop lets workers finish queued messages in the background.
+func (d *dispatcher) stop() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+}
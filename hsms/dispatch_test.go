@@ -0,0 +1,149 @@
+package hsms
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func TestWorkerPoolDispatch(t *testing.T) {
+	server, port := startTestServer(t)
+
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.SetDispatch(DispatchConfig{Mode: DispatchWorkerPool, Workers: 4})
+
+	release := make(chan struct{})
+	passive.RegisterHandler(7, 3, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		<-release
+		return ast.NewDataMessage("", 7, 4, 0, "H<-E", ast.NewBinaryNode(0)), nil
+	})
+	passive.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewListNode()), nil
+	})
+	var mu sync.Mutex
+	var order []uint64
+	passive.RegisterHandler(6, 11, func(msg *ast.DataMessage) (*ast.DataMessage, error) {
+		item, _ := msg.Get()
+		mu.Lock()
+		order = append(order, item.Values().([]uint64)[0])
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return ast.NewDataMessage("", 6, 12, 0, "H<-E", ast.NewBinaryNode(0)), nil
+	})
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	upload := active.SendAsync(ast.NewDataMessage("", 7, 3, 1, "H->E", ast.NewListNode()))
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("S1F1 blocked behind slow S7F3 handler: %v", err)
+	}
+	close(release)
+	if _, err := upload.Wait(); err != nil {
+		t.Fatalf("S7F3: %v", err)
+	}
+
+	const count = 30
+	pending := make([]*Transaction, 0, count)
+	for i := 0; i < count; i++ {
+		pending = append(pending, active.SendAsync(ast.NewDataMessage("", 6, 11, 1, "H<-E", ast.NewUintNode(4, uint64(i)))))
+	}
+	for _, tx := range pending {
+		if _, err := tx.Wait(); err != nil {
+			t.Fatalf("S6F11: %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, got := range order {
+		if got != uint64(i) {
+			t.Fatalf("stream 6 handled out of order: %v", order)
+		}
+	}
+}
+
+func TestDispatchOverflow(t *testing.T) {
+	var tests = []struct {
+		description string // Test case description
+		overflow    OverflowPolicy
+		s9Function  int
+	}{
+		{"HSMS reject", OverflowRejectHSMS, 0},
+		{"S9 error", OverflowRejectS9, S9F9TransactionTimeout},
+		{"S9 error without function", OverflowRejectS9, 0},
+	}
+	for i, test := range tests {
+		t.Logf("Test #%d: %s", i, test.description)
+		testDispatchOverflow(t, test.overflow, test.s9Function)
+	}
+}
+
+func testDispatchOverflow(t *testing.T, overflow OverflowPolicy, s9Function int) {
+	server, port := startTestServer(t)
+
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.SetDispatch(DispatchConfig{
+		Mode:       DispatchWorkerPool,
+		Workers:    1,
+		QueueDepth: 1,
+		Overflow:   overflow,
+		S9Function: s9Function,
+	})
+	release := make(chan struct{})
+	passive.RegisterHandler(7, 3, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		<-release
+		return ast.NewDataMessage("", 7, 4, 0, "H<-E", ast.NewBinaryNode(0)), nil
+	})
+	passive.Enable()
+	defer passive.Disable()
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	// One message runs, one waits in the queue, the rest overflow.
+	pending := make([]*Transaction, 0, 4)
+	for i := 0; i < 4; i++ {
+		pending = append(pending, active.SendAsync(ast.NewDataMessage("", 7, 3, 1, "H->E", ast.NewListNode())))
+		time.Sleep(50 * time.Millisecond)
+	}
+	rejected := 0
+	for _, tx := range pending[2:] {
+		reply, err := tx.Wait()
+		var rejectErr *RejectError
+		switch {
+		case s9Function != 0:
+			if err != nil {
+				t.Fatalf("overflowed S7F3: %v", err)
+			}
+			if reply.StreamCode() == 9 && reply.FunctionCode() == s9Function {
+				rejected++
+			}
+		case errors.As(err, &rejectErr) && rejectErr.Reason == RejectReasonQueueFull:
+			rejected++
+		default:
+			t.Fatalf("overflowed S7F3 should be rejected, got %v %v", reply, err)
+		}
+	}
+	close(release)
+	if rejected != 2 {
+		t.Fatalf("expected 2 rejected messages, got %d", rejected)
+	}
+	for _, tx := range pending[:2] {
+		if reply, err := tx.Wait(); err != nil || reply.FunctionCode() != 4 {
+			t.Fatalf("queued S7F3 should complete, got %v %v", reply, err)
+		}
+	}
+}
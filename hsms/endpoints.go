@@ -0,0 +1,141 @@
+package hsms
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrLocalBindUnsupported is returned when a local address is set and the
+// transport is not a TCPTransport.
+var ErrLocalBindUnsupported = errors.New("hsms: local address requires the TCP transport")
+
+// Endpoint is a remote address an active protocol connects to.
+type Endpoint struct {
+	Address string
+	Port    int
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Address, strconv.Itoa(e.Port))
+}
+
+// FailoverPolicy decides which endpoint an active protocol tries first.
+// Whatever the policy, a failed endpoint is followed by the next one in the
+// list; the reconnect backoff applies once all of them failed.
+type FailoverPolicy int
+
+const (
+	// FailoverPrimaryFirst starts every connection attempt at the first
+	// endpoint, so the protocol returns to the primary when it comes back.
+	FailoverPrimaryFirst FailoverPolicy = iota
+	// FailoverSticky starts at the endpoint of the last connection and keeps
+	// using a standby until it fails.
+	FailoverSticky
+)
+
+func (f FailoverPolicy) String() string {
+	switch f {
+	case FailoverPrimaryFirst:
+		return "primary-first"
+	case FailoverSticky:
+		return "sticky"
+	default:
+		return "unknown"
+	}
+}
+
+// SetEndpoints sets the remote endpoints of an active protocol, primary
+// first. It replaces the address and port given to NewHsmsProtocol; an empty
+// list restores them. Changes apply to the next connection attempt.
+func (p *HsmsProtocol) SetEndpoints(endpoints ...Endpoint) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.endpoints = append([]Endpoint(nil), endpoints...)
+	p.lastEndpoint = 0
+}
+
+// Endpoints returns the remote endpoints in failover order.
+func (p *HsmsProtocol) Endpoints() []Endpoint {
+	p.transportMu.RLock()
+	defer p.transportMu.RUnlock()
+	if len(p.endpoints) == 0 {
+		return []Endpoint{{Address: p.remoteAddress, Port: p.remotePort}}
+	}
+	return append([]Endpoint(nil), p.endpoints...)
+}
+
+// SetFailoverPolicy sets where the next connection attempt starts in the
+// endpoint list. The default is FailoverPrimaryFirst.
+func (p *HsmsProtocol) SetFailoverPolicy(policy FailoverPolicy) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.failover = policy
+}
+
+// SetLocalAddress binds outgoing connections to a local IP address, e.g. to
+// pick the interface of a multi-homed host. An empty address lets the system
+// choose. It applies to the TCP transport only.
+func (p *HsmsProtocol) SetLocalAddress(address string) error {
+	var local net.Addr
+	if address != "" {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return fmt.Errorf("hsms: invalid local address %q", address)
+		}
+		local = &net.TCPAddr{IP: ip}
+	}
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.localAddr = local
+	return nil
+}
+
+// SetConnectTimeout limits each connection attempt of an active protocol,
+// so an unreachable primary fails over without waiting for the operating
+// system's connect timeout. Zero, the default, uses T5.
+func (p *HsmsProtocol) SetConnectTimeout(timeout time.Duration) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.connectTimeout = timeout
+}
+
+// ActiveEndpoint returns the endpoint of the current connection of an
+// active protocol.
+func (p *HsmsProtocol) ActiveEndpoint() (Endpoint, bool) {
+	if !p.active || !p.connected.Load() {
+		return Endpoint{}, false
+	}
+	p.transportMu.RLock()
+	defer p.transportMu.RUnlock()
+	return p.activeEndpoint, true
+}
+
+// endpointOrder returns the endpoints in the order of the next attempt.
+func (p *HsmsProtocol) endpointOrder() []Endpoint {
+	endpoints := p.Endpoints()
+
+	p.transportMu.RLock()
+	defer p.transportMu.RUnlock()
+	start := 0
+	if p.failover == FailoverSticky && p.lastEndpoint < len(endpoints) {
+		start = p.lastEndpoint
+	}
+	return append(endpoints[start:], endpoints[:start]...)
+}
+
+func (p *HsmsProtocol) setActiveEndpoint(endpoint Endpoint) {
+	endpoints := p.Endpoints()
+
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.activeEndpoint = endpoint
+	for idx, candidate := range endpoints {
+		if candidate == endpoint {
+			p.lastEndpoint = idx
+			break
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package hsms
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestActiveFailsOverToStandby(t *testing.T) {
+	server, port := startTestServer(t)
+	standby, err := server.NewSession(1, "standby")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	standby.Timeouts().SetLinktest(60)
+	standby.Enable()
+	t.Cleanup(standby.Disable)
+
+	primary := Endpoint{Address: "127.0.0.1", Port: freePort(t)}
+	secondary := Endpoint{Address: "127.0.0.1", Port: port}
+
+	active := NewHsmsProtocol(primary.Address, primary.Port, true, 1, "host")
+	active.Timeouts().SetLinktest(60)
+	active.Timeouts().SetAutoReconnect(false)
+	active.SetEndpoints(primary, secondary)
+	active.SetConnectTimeout(time.Second)
+	if err := active.SetLocalAddress("127.0.0.1"); err != nil {
+		t.Fatalf("SetLocalAddress: %v", err)
+	}
+	recorder := &eventRecorder{}
+	active.AddConnectionListener(recorder.record)
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	failed := recorder.waitFor(t, EventConnectFailed, time.Second)
+	if failed.Endpoint != primary || failed.Err == nil {
+		t.Fatalf("unexpected connect failure event %+v", failed)
+	}
+	connected := recorder.waitFor(t, EventConnected, time.Second)
+	if connected.Endpoint != secondary {
+		t.Fatalf("connected to %s, want %s", connected.Endpoint, secondary)
+	}
+	if ip := connected.LocalAddr.(*net.TCPAddr).IP; !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Fatalf("unexpected local address %s", connected.LocalAddr)
+	}
+	if endpoint, ok := active.ActiveEndpoint(); !ok || endpoint != secondary {
+		t.Fatalf("ActiveEndpoint = %s, %v", endpoint, ok)
+	}
+}
+
+// hangingTransport never connects; Dial returns when its context is done.
+type hangingTransport struct {
+	TCPTransport
+	dialing chan time.Time
+}
+
+func (h *hangingTransport) Dial(ctx context.Context, address string, port int) (net.Conn, error) {
+	deadline, _ := ctx.Deadline()
+	h.dialing <- deadline
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestDialTimeoutAndDisable(t *testing.T) {
+	transport := &hangingTransport{dialing: make(chan time.Time, 1)}
+	active := NewHsmsProtocol("127.0.0.1", 1, true, 1, "host")
+	active.Timeouts().SetT5ConnSeparateTimeout(7)
+	active.Timeouts().SetAutoReconnect(false)
+	active.SetTransport(transport)
+	active.Enable()
+
+	var deadline time.Time
+	select {
+	case deadline = <-transport.dialing:
+	case <-time.After(time.Second):
+		t.Fatal("no connection attempt")
+	}
+	if left := time.Until(deadline); left < 6*time.Second || left > 7*time.Second {
+		t.Fatalf("connect timeout should default to T5, deadline in %v", left)
+	}
+
+	start := time.Now()
+	active.Disable()
+	deadlineWait := time.Now().Add(time.Second)
+	for active.connectThreadRunning.Load() && time.Now().Before(deadlineWait) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if active.connectThreadRunning.Load() {
+		t.Fatalf("Disable did not abort the connection attempt after %v", time.Since(start))
+	}
+}
+
+func TestEndpointOrder(t *testing.T) {
+	p := NewHsmsProtocol("primary", 5000, true, 1, "host")
+	if got := p.endpointOrder(); len(got) != 1 || got[0] != (Endpoint{"primary", 5000}) {
+		t.Fatalf("default endpoints %v", got)
+	}
+
+	a, b, c := Endpoint{"a", 1}, Endpoint{"b", 1}, Endpoint{"c", 1}
+	p.SetEndpoints(a, b, c)
+	p.setActiveEndpoint(b)
+	if got := p.endpointOrder(); got[0] != a || got[1] != b || got[2] != c {
+		t.Fatalf("primary-first order %v", got)
+	}
+
+	p.SetFailoverPolicy(FailoverSticky)
+	if got := p.endpointOrder(); got[0] != b || got[1] != c || got[2] != a {
+		t.Fatalf("sticky order %v", got)
+	}
+}
+
+func TestLocalAddressValidation(t *testing.T) {
+	p := NewHsmsProtocol("equipment", 5000, true, 1, "host")
+	if err := p.SetLocalAddress("not-an-ip"); err == nil {
+		t.Fatal("expected an error for an invalid local address")
+	}
+
+	if err := p.SetLocalAddress("127.0.0.1"); err != nil {
+		t.Fatalf("SetLocalAddress: %v", err)
+	}
+	p.SetTransport(NewMemoryTransport())
+	if _, err := p.connector().dial(context.Background(), "equipment", 5000); !errors.Is(err, ErrLocalBindUnsupported) {
+		t.Fatalf("expected ErrLocalBindUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package hsms
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	link "github.com/younglifestyle/secs4go"
+	"github.com/younglifestyle/secs4go/common"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/parser/hsms"
+)
+
+// generalSessionID is the session ID of the carrier protocol. It is never
+// selected and only answers messages that are not addressed to an entity.
+const generalSessionID = 0xFFFF
+
+// GeneralSession implements HSMS-GS: several session entities share one TCP
+// connection. The carrier protocol owns the connection (connect, reconnect,
+// linktest, T7, T8); each entity is an HsmsProtocol with its own select state,
+// handlers and transactions, and can be wrapped by its own GemHandler.
+//
+// The shared connection counts as selected while at least one entity is
+// selected, so T7 closes it only when no entity gets selected in time.
+type GeneralSession struct {
+	carrier *HsmsProtocol
+
+	mu       sync.RWMutex
+	entities map[uint16]*sessionEntity
+	conn     *link.Session
+
+	selectMu sync.Mutex
+}
+
+type sessionEntity struct {
+	p          *HsmsProtocol
+	dispatcher *dispatcher
+}
+
+// NewGeneralSession creates an HSMS-GS connection to (active) or on (passive)
+// address:port. Add entities with NewEntity, then call Enable.
+func NewGeneralSession(address string, port int, active bool, name string) *GeneralSession {
+	g := &GeneralSession{
+		carrier:  NewHsmsProtocol(address, port, active, generalSessionID, name),
+		entities: make(map[uint16]*sessionEntity),
+	}
+	g.carrier.sessionTable = g
+	return g
+}
+
+// Protocol returns the carrier protocol. Use it for connection events,
+// logging configuration and the connection state; it does not send data
+// messages itself.
+func (g *GeneralSession) Protocol() *HsmsProtocol {
+	return g.carrier
+}
+
+// Timeouts returns the timeouts shared by the connection and all entities.
+func (g *GeneralSession) Timeouts() *SecsTimeout {
+	return g.carrier.timeouts
+}
+
+// SetLogger replaces the logger of the carrier protocol.
+func (g *GeneralSession) SetLogger(logger common.Logger) {
+	g.carrier.SetLogger(logger)
+}
+
+// Enable starts connecting (active) or listening (passive).
+func (g *GeneralSession) Enable() {
+	g.carrier.Enable()
+}
+
+// Disable closes the shared connection. Entities stay enabled and are
+// attached again when the general session is enabled again.
+func (g *GeneralSession) Disable() {
+	g.carrier.Disable()
+}
+
+// NewEntity creates the session entity sessionID. The entity is an
+// HsmsProtocol: register handlers on it or pass it as gem.Options.Protocol,
+// and enable it to take part in the shared connection.
+func (g *GeneralSession) NewEntity(sessionID int, name string) (*HsmsProtocol, error) {
+	if sessionID < 0 || sessionID >= generalSessionID {
+		return nil, fmt.Errorf("hsms: invalid session ID %d", sessionID)
+	}
+
+	p := NewHsmsProtocol(g.carrier.remoteAddress, g.carrier.remotePort, g.carrier.active, sessionID, name)
+	p.timeouts = g.carrier.timeouts
+	p.owner = g
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := uint16(sessionID)
+	if _, exists := g.entities[key]; exists {
+		return nil, fmt.Errorf("%w: session %d", ErrSessionExists, key)
+	}
+	g.entities[key] = &sessionEntity{p: p}
+	return p, nil
+}
+
+// RemoveEntity detaches the session entity sessionID and drops it from the table.
+func (g *GeneralSession) RemoveEntity(sessionID int) error {
+	p := g.Entity(sessionID)
+	if p == nil {
+		return errors.New("hsms: unknown session entity")
+	}
+	p.Disable()
+	g.detach(p)
+
+	g.mu.Lock()
+	delete(g.entities, uint16(sessionID))
+	g.mu.Unlock()
+	return nil
+}
+
+// Entity returns the session entity sessionID, or nil.
+func (g *GeneralSession) Entity(sessionID int) *HsmsProtocol {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if entity, ok := g.entities[uint16(sessionID)]; ok {
+		return entity.p
+	}
+	return nil
+}
+
+// SessionIDs returns the session IDs in the table in ascending order.
+func (g *GeneralSession) SessionIDs() []int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	ids := make([]int, 0, len(g.entities))
+	for id := range g.entities {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// connected is called by the carrier once a connection is established.
+func (g *GeneralSession) connected(conn *link.Session) {
+	g.mu.Lock()
+	g.conn = conn
+	entities := make([]*HsmsProtocol, 0, len(g.entities))
+	for _, entity := range g.entities {
+		entities = append(entities, entity.p)
+	}
+	g.mu.Unlock()
+
+	for _, p := range entities {
+		g.attach(p)
+	}
+}
+
+// disconnected is called by the carrier when the shared connection is lost.
+func (g *GeneralSession) disconnected(event ConnectionEvent) {
+	g.mu.Lock()
+	g.conn = nil
+	entities := make([]*HsmsProtocol, 0, len(g.entities))
+	for _, entity := range g.entities {
+		entities = append(entities, entity.p)
+	}
+	g.mu.Unlock()
+
+	for _, p := range entities {
+		p.setDisconnectReason(event.Reason, event.Err)
+		g.detach(p)
+	}
+}
+
+// attach puts an enabled entity on the current connection.
+func (g *GeneralSession) attach(p *HsmsProtocol) {
+	g.mu.Lock()
+	entity, ok := g.entities[uint16(p.sessionID)]
+	conn := g.conn
+	if !ok || entity.p != p || conn == nil || entity.dispatcher != nil || !p.enabled.Load() {
+		g.mu.Unlock()
+		return
+	}
+	entity.dispatcher = p.newDispatcher()
+	g.mu.Unlock()
+
+	p.hsmsConnection.SetSession(conn)
+	p.publish(ConnectionEvent{
+		Type:       EventConnected,
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+	})
+	p.OnConnectionEstablished()
+}
+
+// detach takes an entity off the connection without closing it.
+func (g *GeneralSession) detach(p *HsmsProtocol) {
+	g.mu.Lock()
+	var dispatcher *dispatcher
+	if entity, ok := g.entities[uint16(p.sessionID)]; ok && entity.p == p {
+		dispatcher = entity.dispatcher
+		entity.dispatcher = nil
+	}
+	g.mu.Unlock()
+
+	if dispatcher != nil {
+		dispatcher.stop()
+	}
+	p.connected.Store(false)
+	if p.connectionState.CurrentState() != StateNotConnected {
+		p.setDisconnectReason(DisconnectReasonLocal, nil)
+		if err := p.connectionState.Disconnect(); err != nil {
+			p.logger.Error("change state to NOT-CONNECTED failed", "error", err)
+		}
+	}
+	p.hsmsConnection.SetSession(nil)
+	p.failTransactions(ErrNotConnected)
+}
+
+// updateSelected keeps the carrier selected while any entity is selected.
+func (g *GeneralSession) updateSelected() {
+	g.selectMu.Lock()
+	defer g.selectMu.Unlock()
+
+	selected := false
+	g.mu.RLock()
+	for _, entity := range g.entities {
+		if entity.p.connectionState.CurrentState() == StateConnectedSelected {
+			selected = true
+			break
+		}
+	}
+	g.mu.RUnlock()
+
+	switch g.carrier.connectionState.CurrentState() {
+	case StateConnectedNotSelected:
+		if selected {
+			if err := g.carrier.connectionState.Select(); err != nil {
+				g.carrier.logger.Error("change state to SELECTED failed", "error", err)
+			}
+		}
+	case StateConnectedSelected:
+		if !selected {
+			if err := g.carrier.connectionState.Deselect(); err != nil {
+				g.carrier.logger.Error("change state to NOT-SELECTED failed", "error", err)
+			}
+		}
+	}
+}
+
+// route hands message to the entity it is addressed to. It reports false for
+// linktest messages, which the carrier handles for the whole connection.
+func (g *GeneralSession) route(message ast.HSMSMessage) bool {
+	var sessionID uint16
+	switch msg := message.(type) {
+	case *ast.DataMessage:
+		sessionID = uint16(msg.SessionID())
+	case *ast.ControlMessage:
+		switch msg.Type() {
+		case hsms.LinktestReqStr, hsms.LinktestRspStr:
+			return false
+		}
+		sessionID = msg.SessionID()
+	default:
+		return false
+	}
+
+	g.mu.RLock()
+	entity, ok := g.entities[sessionID]
+	var p *HsmsProtocol
+	if ok {
+		p = entity.p
+	}
+	g.mu.RUnlock()
+
+	// A separated entity is attached again when the peer selects it.
+	if ok && message.Type() == hsms.SelectReqStr && p.enabled.Load() && p.connectionState.CurrentState() == StateNotConnected {
+		g.attach(p)
+	}
+
+	g.mu.RLock()
+	var dispatcher *dispatcher
+	if ok {
+		dispatcher = entity.dispatcher
+	}
+	g.mu.RUnlock()
+
+	if dispatcher == nil {
+		g.refuse(message, ok)
+		return true
+	}
+	p.receive(message, dispatcher)
+	return true
+}
+
+// refuse answers a message for an unknown or disabled session entity.
+func (g *GeneralSession) refuse(message ast.HSMSMessage, known bool) {
+	carrier := g.carrier
+
+	switch message.Type() {
+	case hsms.SelectReqStr:
+		carrier.logControlMessage("RX", message)
+		status := ControlStatusEntityUnknown
+		if known {
+			status = ControlStatusNotReady
+		}
+		carrier.hsmsConnection.sendSelectRsp(message, status)
+	case hsms.DeselectReqStr:
+		carrier.logControlMessage("RX", message)
+		carrier.hsmsConnection.sendReject(message, RejectReasonEntityNotSelected)
+	case hsms.DataMessageStr:
+		dataMessage, ok := message.(*ast.DataMessage)
+		if !ok || dataMessage.FunctionCode()%2 == 0 {
+			return
+		}
+		carrier.logDataMessage("IN", dataMessage)
+		carrier.sendS9(S9F1UnrecognizedDeviceID, dataMessage)
+	default:
+		carrier.logger.Warn("dropping message for unknown session entity", "type", message.Type())
+	}
+}
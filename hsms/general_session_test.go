@@ -0,0 +1,138 @@
+package hsms
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func newTestGeneralSession(t *testing.T, port int, active bool, sessionIDs ...int) (*GeneralSession, []*HsmsProtocol) {
+	t.Helper()
+	g := NewGeneralSession("127.0.0.1", port, active, "gs")
+	g.Timeouts().SetLinktest(60)
+	g.Timeouts().SetAutoReconnect(false)
+
+	entities := make([]*HsmsProtocol, len(sessionIDs))
+	for idx, sessionID := range sessionIDs {
+		entity, err := g.NewEntity(sessionID, "entity")
+		if err != nil {
+			t.Fatalf("NewEntity(%d): %v", sessionID, err)
+		}
+		entities[idx] = entity
+	}
+	return g, entities
+}
+
+// waitForListening waits until a passive protocol has opened its listener.
+func waitForListening(t *testing.T, p *HsmsProtocol) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		p.serverMu.Lock()
+		listening := p.server != nil
+		p.serverMu.Unlock()
+		if listening {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s: listener not started", p.name)
+}
+
+func TestGeneralSessionRoutesBySessionID(t *testing.T) {
+	port := freePort(t)
+
+	passive, equipment := newTestGeneralSession(t, port, false, 1, 2)
+	for _, entity := range equipment {
+		id := entity.sessionID
+		entity.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+			return ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewUintNode(4, uint64(id))), nil
+		})
+		entity.Enable()
+		t.Cleanup(entity.Disable)
+	}
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+	waitForListening(t, passive.Protocol())
+
+	active, hosts := newTestGeneralSession(t, port, true, 1, 2, 3)
+	for _, entity := range hosts {
+		entity.Enable()
+		t.Cleanup(entity.Disable)
+	}
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	waitForState(t, hosts[0], StateConnectedSelected, 3*time.Second)
+	waitForState(t, hosts[1], StateConnectedSelected, 3*time.Second)
+	// Session 3 is unknown to the equipment, so its Select.req is refused.
+	waitForState(t, hosts[2], StateNotConnected, 3*time.Second)
+	waitForState(t, active.Protocol(), StateConnectedSelected, time.Second)
+
+	for _, entity := range hosts[:2] {
+		reply, err := entity.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+		if err != nil {
+			t.Fatalf("session %d: %v", entity.sessionID, err)
+		}
+		item, _ := reply.Get()
+		if got := item.Values().([]uint64)[0]; got != uint64(entity.sessionID) {
+			t.Fatalf("session %d answered by entity %d", entity.sessionID, got)
+		}
+	}
+
+	// Disabling one entity separates only that session.
+	hosts[0].Disable()
+	waitForState(t, equipment[0], StateNotConnected, 3*time.Second)
+	if state := equipment[1].CurrentState(); state != StateConnectedSelected {
+		t.Fatalf("expected session 2 to stay selected, got %s", state)
+	}
+	if _, err := hosts[1].SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("session 2 after separate: %v", err)
+	}
+
+	// The separated entity can be selected again on the same connection.
+	hosts[0].Enable()
+	waitForState(t, hosts[0], StateConnectedSelected, 3*time.Second)
+	waitForState(t, equipment[0], StateConnectedSelected, 3*time.Second)
+}
+
+func TestGeneralSessionDisconnectDetachesEntities(t *testing.T) {
+	port := freePort(t)
+
+	passive, equipment := newTestGeneralSession(t, port, false, 1)
+	equipment[0].Enable()
+	t.Cleanup(equipment[0].Disable)
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+	waitForListening(t, passive.Protocol())
+
+	active, hosts := newTestGeneralSession(t, port, true, 1)
+	hosts[0].Enable()
+	t.Cleanup(hosts[0].Disable)
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	waitForState(t, hosts[0], StateConnectedSelected, 3*time.Second)
+
+	events := &eventRecorder{}
+	hosts[0].AddConnectionListener(events.record)
+	active.Disable()
+
+	waitForState(t, hosts[0], StateNotConnected, 3*time.Second)
+	waitForState(t, equipment[0], StateNotConnected, 3*time.Second)
+	if disconnected := events.waitFor(t, EventDisconnected, time.Second); disconnected.Reason != DisconnectReasonLocal {
+		t.Fatalf("expected local reason, got %s", disconnected.Reason)
+	}
+}
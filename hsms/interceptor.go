@@ -0,0 +1,195 @@
+package hsms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// ErrMessageRejected is returned when an interceptor rejects a message.
+var ErrMessageRejected = errors.New("hsms: message rejected by interceptor")
+
+// MessageDirection tells interceptors which way a data message is travelling.
+type MessageDirection int
+
+const (
+	DirectionInbound MessageDirection = iota
+	DirectionOutbound
+)
+
+func (d MessageDirection) String() string {
+	if d == DirectionOutbound {
+		return "OUT"
+	}
+	return "IN"
+}
+
+// MessageContext describes one data message passing through the interceptor chain.
+type MessageContext struct {
+	Direction MessageDirection
+	// Message is the data message. Interceptors may replace it; session ID and
+	// system bytes are restored after the chain runs.
+	Message *ast.DataMessage
+	// Request is the correlated primary message when Message is a reply: the
+	// request sent by SendAndWait/SendAsync for inbound replies, or the
+	// request being answered for outbound handler replies.
+	Request *ast.DataMessage
+
+	reply      *ast.DataMessage
+	rejectWith int
+}
+
+// Respond short-circuits the chain with reply. For an inbound primary message
+// the reply is sent instead of invoking the handler; for an inbound reply it
+// replaces the reply. For an outbound SendAndWait/SendAsync request the reply is
+// returned without transmitting, and for an outbound handler reply it is sent
+// instead; other outbound messages are dropped.
+func (mc *MessageContext) Respond(reply *ast.DataMessage) {
+	mc.reply = reply
+}
+
+// Reject stops the chain and discards the message. Inbound messages are
+// answered with S9F<function> (1, 3, 5, 7, 9, 11 or 13); outbound messages are
+// not sent and the caller gets ErrMessageRejected.
+func (mc *MessageContext) Reject(function int) {
+	mc.rejectWith = function
+}
+
+func (mc *MessageContext) stopped() bool {
+	return mc.reply != nil || mc.rejectWith != 0
+}
+
+// Interceptor observes or alters data messages entering and leaving a protocol.
+type Interceptor interface {
+	Intercept(mc *MessageContext)
+}
+
+// InterceptorFunc adapts a function to the Interceptor interface.
+type InterceptorFunc func(mc *MessageContext)
+
+// Intercept calls f(mc).
+func (f InterceptorFunc) Intercept(mc *MessageContext) {
+	f(mc)
+}
+
+// Use appends interceptors to the chain. They run in registration order, for
+// inbound and outbound data messages alike, until one responds or rejects.
+func (p *HsmsProtocol) Use(interceptors ...Interceptor) {
+	p.interceptorMu.Lock()
+	defer p.interceptorMu.Unlock()
+	for _, interceptor := range interceptors {
+		if interceptor != nil {
+			p.interceptors = append(p.interceptors, interceptor)
+		}
+	}
+}
+
+func (p *HsmsProtocol) runInterceptors(mc *MessageContext) {
+	p.interceptorMu.RLock()
+	chain := p.interceptors
+	p.interceptorMu.RUnlock()
+
+	if len(chain) == 0 {
+		return
+	}
+
+	original := mc.Message
+	for _, interceptor := range chain {
+		interceptor.Intercept(mc)
+		if mc.stopped() {
+			break
+		}
+	}
+	if mc.Message == nil {
+		mc.Message = original
+	} else if mc.Message != original {
+		mc.Message = mc.Message.SetSessionIDAndSystemBytes(original.SessionID(), original.SystemBytes())
+	}
+}
+
+// interceptOutbound runs the chain for a message about to be sent. It returns
+// the message to send, or a local reply when an interceptor responded.
+func (p *HsmsProtocol) interceptOutbound(message, request *ast.DataMessage) (*ast.DataMessage, *ast.DataMessage, error) {
+	mc := &MessageContext{Direction: DirectionOutbound, Message: message, Request: request}
+	p.runInterceptors(mc)
+
+	if mc.rejectWith != 0 {
+		return nil, nil, fmt.Errorf("%w: S%02dF%02d (S9F%d)", ErrMessageRejected, message.StreamCode(), message.FunctionCode(), mc.rejectWith)
+	}
+	if mc.reply != nil {
+		return nil, mc.reply, nil
+	}
+	return mc.Message, nil, nil
+}
+
+// interceptInbound runs the chain for a received primary message. It reports
+// false when an interceptor already answered or rejected it.
+func (p *HsmsProtocol) interceptInbound(message *ast.DataMessage) (*ast.DataMessage, bool) {
+	mc := &MessageContext{Direction: DirectionInbound, Message: message}
+	p.runInterceptors(mc)
+
+	if mc.rejectWith != 0 {
+		p.sendS9(mc.rejectWith, message)
+		return nil, false
+	}
+	if mc.reply != nil {
+		p.sendInterceptorReply(mc.reply, message)
+		return nil, false
+	}
+	return mc.Message, true
+}
+
+// interceptReply runs the chain for a reply correlated with request.
+func (p *HsmsProtocol) interceptReply(reply, request *ast.DataMessage) (*ast.DataMessage, error) {
+	mc := &MessageContext{Direction: DirectionInbound, Message: reply, Request: request}
+	p.runInterceptors(mc)
+
+	if mc.rejectWith != 0 {
+		p.sendS9(mc.rejectWith, reply)
+		return nil, fmt.Errorf("%w: S%02dF%02d (S9F%d)", ErrMessageRejected, reply.StreamCode(), reply.FunctionCode(), mc.rejectWith)
+	}
+	if mc.reply != nil {
+		return mc.reply, nil
+	}
+	return mc.Message, nil
+}
+
+func (p *HsmsProtocol) sendInterceptorReply(reply, request *ast.DataMessage) {
+	reply = reply.SetSessionIDAndSystemBytes(p.sessionID, request.SystemBytes())
+	if reply.WaitBit() == "optional" {
+		reply = reply.SetWaitBit(false)
+	}
+
+	p.logDataMessage("OUT", reply)
+
+	if err := p.hsmsConnection.Send(reply); err != nil {
+		p.logger.Error("send interceptor reply failed", "stream", reply.StreamCode(), "function", reply.FunctionCode(), "error", err)
+	}
+}
+
+// sendS9 reports message to the peer with the S9 error selected by function.
+// The S9 carries the system bytes of message, which ends the peer's transaction.
+func (p *HsmsProtocol) sendS9(function int, message *ast.DataMessage) {
+	systemBytes := message.SystemBytes()
+	p.logger.Info("message rejected, sending S9", "stream", message.StreamCode(), "function", message.FunctionCode(), "s9", function)
+
+	switch function {
+	case S9F1UnrecognizedDeviceID:
+		p.sendS9Error(BuildS9F1(byte(message.SessionID()), systemBytes), systemBytes)
+	case S9F3UnrecognizedStream:
+		p.sendS9Error(BuildS9F3(byte(message.StreamCode()), systemBytes), systemBytes)
+	case S9F5UnrecognizedFunction:
+		p.sendS9Error(BuildS9F5(byte(message.FunctionCode()), systemBytes), systemBytes)
+	case S9F7IllegalData:
+		p.sendS9F7IllegalData(systemBytes)
+	case S9F9TransactionTimeout:
+		p.sendS9Error(BuildS9F9(messageHeader(message), systemBytes), systemBytes)
+	case S9F11DataTooLong:
+		p.sendS9F11DataTooLong(systemBytes)
+	case S9F13ConversationTimeout:
+		p.sendS9Error(BuildS9F13(systemBytes), systemBytes)
+	default:
+		p.logger.Warn("interceptor rejected message with unknown S9 function", "function", function)
+	}
+}
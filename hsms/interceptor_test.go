@@ -0,0 +1,108 @@
+package hsms
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func TestInterceptors(t *testing.T) {
+	server, port := startTestServer(t)
+
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.RegisterHandler(1, 3, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 4, 0, "H<-E", ast.NewUintNode(4, 1)), nil
+	})
+	passive.RegisterHandler(1, 17, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 18, 0, "H<-E", ast.NewBinaryNode(0)), nil
+	})
+	passive.Use(InterceptorFunc(func(mc *MessageContext) {
+		if mc.Direction != DirectionInbound {
+			return
+		}
+		switch {
+		case mc.Message.StreamCode() == 1 && mc.Message.FunctionCode() == 1:
+			mc.Respond(ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewListNode()))
+		case mc.Message.StreamCode() == 2 && mc.Message.FunctionCode() == 41:
+			mc.Reject(S9F5UnrecognizedFunction)
+		}
+	}))
+	// Rewrite handler replies on the way out.
+	passive.Use(InterceptorFunc(func(mc *MessageContext) {
+		if mc.Direction == DirectionOutbound && mc.Message.FunctionCode() == 4 {
+			mc.Message = ast.NewDataMessage("", 1, 4, 0, "H<-E", ast.NewUintNode(4, 2))
+		}
+		if mc.Direction == DirectionOutbound && mc.Message.FunctionCode() == 18 {
+			mc.Respond(ast.NewDataMessage("", 1, 18, 0, "H<-E", ast.NewBinaryNode(1)))
+		}
+	}))
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	var mu sync.Mutex
+	var correlated []int
+	active.Use(InterceptorFunc(func(mc *MessageContext) {
+		if mc.Direction == DirectionInbound && mc.Request != nil {
+			mu.Lock()
+			correlated = append(correlated, mc.Request.FunctionCode())
+			mu.Unlock()
+		}
+		if mc.Direction == DirectionOutbound && mc.Message.StreamCode() == 10 {
+			mc.Reject(S9F3UnrecognizedStream)
+		}
+	}))
+
+	reply, err := active.SendAndWait(ast.NewDataMessage("", 1, 3, 1, "H->E", ast.NewListNode()))
+	if err != nil {
+		t.Fatalf("S1F3: %v", err)
+	}
+	item, _ := reply.Get()
+	if got := item.Values().([]uint64)[0]; got != 2 {
+		t.Fatalf("expected rewritten reply value 2, got %d", got)
+	}
+
+	reply, err = active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+	if err != nil {
+		t.Fatalf("S1F1: %v", err)
+	}
+	if reply.FunctionCode() != 2 {
+		t.Fatalf("expected short-circuited S1F2, got S%dF%d", reply.StreamCode(), reply.FunctionCode())
+	}
+
+	reply, err = active.SendAndWait(ast.NewDataMessage("", 1, 17, 1, "H->E", ast.NewEmptyItemNode()))
+	if err != nil {
+		t.Fatalf("S1F17: %v", err)
+	}
+	item, _ = reply.Get()
+	if ack := item.Values().([]int); ack[0] != 1 {
+		t.Fatalf("expected S1F18 from outbound Respond, got %v", reply)
+	}
+
+	reply, err = active.SendAndWait(ast.NewDataMessage("", 2, 41, 1, "H->E", ast.NewListNode()))
+	if err != nil {
+		t.Fatalf("S2F41: %v", err)
+	}
+	if reply.StreamCode() != 9 || reply.FunctionCode() != 5 {
+		t.Fatalf("expected S9F5 rejection, got S%dF%d", reply.StreamCode(), reply.FunctionCode())
+	}
+
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 10, 3, 1, "H->E", ast.NewListNode())); !errors.Is(err, ErrMessageRejected) {
+		t.Fatalf("expected outbound rejection, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(correlated) != 4 || correlated[0] != 3 || correlated[1] != 1 || correlated[2] != 17 || correlated[3] != 41 {
+		t.Fatalf("unexpected reply correlation %v", correlated)
+	}
+}
@@ -0,0 +1,165 @@
+package hsms
+
+import (
+	"net"
+	"time"
+)
+
+// ConnectionEventType identifies a connection lifecycle event.
+type ConnectionEventType int
+
+const (
+	EventConnected ConnectionEventType = iota
+	EventSelected
+	EventDeselected
+	EventSeparated
+	EventDisconnected
+	EventReconnectScheduled
+	EventRejected
+	EventConnectFailed
+	EventConnectionRefused
+)
+
+func (t ConnectionEventType) String() string {
+	switch t {
+	case EventConnected:
+		return "Connected"
+	case EventSelected:
+		return "Selected"
+	case EventDeselected:
+		return "Deselected"
+	case EventSeparated:
+		return "Separated"
+	case EventDisconnected:
+		return "Disconnected"
+	case EventReconnectScheduled:
+		return "ReconnectScheduled"
+	case EventRejected:
+		return "Rejected"
+	case EventConnectFailed:
+		return "ConnectFailed"
+	case EventConnectionRefused:
+		return "ConnectionRefused"
+	default:
+		return "Unknown"
+	}
+}
+
+// DisconnectReason explains why a connection was closed.
+type DisconnectReason int
+
+const (
+	// DisconnectReasonPeerClosed means the peer closed the TCP connection.
+	DisconnectReasonPeerClosed DisconnectReason = iota
+	// DisconnectReasonT7 means no Select completed within T7.
+	DisconnectReasonT7
+	// DisconnectReasonT8 means the network intercharacter timeout expired.
+	DisconnectReasonT8
+	// DisconnectReasonLinktest means a Linktest.req got no response within T6.
+	DisconnectReasonLinktest
+	// DisconnectReasonSeparate means the peer sent Separate.req.
+	DisconnectReasonSeparate
+	// DisconnectReasonSelectRejected means the Select handshake was refused.
+	DisconnectReasonSelectRejected
+	// DisconnectReasonLocal means the protocol was disabled locally.
+	DisconnectReasonLocal
+	// DisconnectReasonError means a receive error other than a peer close.
+	DisconnectReasonError
+	// DisconnectReasonT6 means Select.req or Deselect.req got no response within T6.
+	DisconnectReasonT6
+	// DisconnectReasonReplaced means a new connection replaced this one, see ConnectionPolicyReplace.
+	DisconnectReasonReplaced
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectReasonPeerClosed:
+		return "peer closed"
+	case DisconnectReasonT7:
+		return "T7 timeout"
+	case DisconnectReasonT8:
+		return "T8 timeout"
+	case DisconnectReasonLinktest:
+		return "linktest failure"
+	case DisconnectReasonSeparate:
+		return "separate.req"
+	case DisconnectReasonSelectRejected:
+		return "select rejected"
+	case DisconnectReasonLocal:
+		return "local"
+	case DisconnectReasonError:
+		return "error"
+	case DisconnectReasonT6:
+		return "T6 timeout"
+	case DisconnectReasonReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionEvent is published to connection listeners on every lifecycle change.
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	Time time.Time
+	// LocalAddr and RemoteAddr are set for EventConnected; RemoteAddr and
+	// Err are set for EventConnectionRefused.
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// Endpoint is the remote endpoint of an active protocol for
+	// EventConnected and EventConnectFailed; Err is set for the latter.
+	Endpoint Endpoint
+	// Remote reports whether the peer initiated EventDeselected or EventSeparated.
+	Remote bool
+	// Reason and Err are set for EventDisconnected. For EventRejected, Err is
+	// the *RejectError of a Reject.req that matched no pending request.
+	Reason DisconnectReason
+	Err    error
+	// Attempt and Delay are set for EventReconnectScheduled.
+	Attempt int
+	Delay   time.Duration
+}
+
+// AddConnectionListener registers fn to receive connection lifecycle events.
+// Listeners run synchronously in registration order and must not block.
+func (p *HsmsProtocol) AddConnectionListener(fn func(ConnectionEvent)) {
+	if fn == nil {
+		return
+	}
+	p.listenerMu.Lock()
+	p.listeners = append(p.listeners, fn)
+	p.listenerMu.Unlock()
+}
+
+func (p *HsmsProtocol) publish(event ConnectionEvent) {
+	event.Time = time.Now()
+
+	p.listenerMu.RLock()
+	listeners := p.listeners
+	p.listenerMu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+// setDisconnectReason records why the current connection is about to close.
+// The first reason recorded wins until the Disconnected event is published.
+func (p *HsmsProtocol) setDisconnectReason(reason DisconnectReason, err error) {
+	p.listenerMu.Lock()
+	defer p.listenerMu.Unlock()
+	if p.disconnectReason == nil {
+		p.disconnectReason = &ConnectionEvent{Type: EventDisconnected, Reason: reason, Err: err}
+	}
+}
+
+func (p *HsmsProtocol) takeDisconnectEvent() ConnectionEvent {
+	p.listenerMu.Lock()
+	defer p.listenerMu.Unlock()
+	event := p.disconnectReason
+	p.disconnectReason = nil
+	if event == nil {
+		return ConnectionEvent{Type: EventDisconnected, Reason: DisconnectReasonPeerClosed}
+	}
+	return *event
+}
@@ -0,0 +1,155 @@
+package hsms
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []ConnectionEvent
+}
+
+func (r *eventRecorder) record(event ConnectionEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+// waitFor returns the first recorded event of type typ.
+func (r *eventRecorder) waitFor(t *testing.T, typ ConnectionEventType, timeout time.Duration) ConnectionEvent {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		for _, event := range r.events {
+			if event.Type == typ {
+				r.mu.Unlock()
+				return event
+			}
+		}
+		r.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %s event within %s", typ, timeout)
+	return ConnectionEvent{}
+}
+
+func (r *eventRecorder) types() []ConnectionEventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]ConnectionEventType, len(r.events))
+	for idx, event := range r.events {
+		types[idx] = event.Type
+	}
+	return types
+}
+
+func TestConnectionEvents(t *testing.T) {
+	server, port := startTestServer(t)
+
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passiveEvents := &eventRecorder{}
+	passive.AddConnectionListener(passiveEvents.record)
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := NewHsmsProtocol("127.0.0.1", port, true, 1, "active")
+	active.Timeouts().SetLinktest(60)
+	active.Timeouts().SetAutoReconnect(false)
+	activeEvents := &eventRecorder{}
+	active.AddConnectionListener(activeEvents.record)
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	connected := activeEvents.waitFor(t, EventConnected, 3*time.Second)
+	if addr, ok := connected.RemoteAddr.(*net.TCPAddr); !ok || addr.Port != port {
+		t.Fatalf("unexpected remote address %v", connected.RemoteAddr)
+	}
+	if connected.LocalAddr == nil {
+		t.Fatal("expected local address")
+	}
+	activeEvents.waitFor(t, EventSelected, 3*time.Second)
+	passiveEvents.waitFor(t, EventSelected, 3*time.Second)
+
+	// Separate the link from the passive side.
+	sep := ast.NewHSMSMessageSeparateReq(1, passive.encodeSystemID(passive.getNextSystemCounter()))
+	if err := passive.hsmsConnection.Send(sep.ToBytes()); err != nil {
+		t.Fatalf("send separate.req: %v", err)
+	}
+
+	disconnected := activeEvents.waitFor(t, EventDisconnected, 3*time.Second)
+	if disconnected.Reason != DisconnectReasonSeparate {
+		t.Fatalf("expected separate.req reason, got %s", disconnected.Reason)
+	}
+	if separated := activeEvents.waitFor(t, EventSeparated, time.Second); !separated.Remote {
+		t.Fatal("expected peer-initiated separate")
+	}
+	want := []ConnectionEventType{EventConnected, EventSelected, EventSeparated, EventDisconnected}
+	if got := activeEvents.types(); len(got) < len(want) || !equalEventTypes(got[:len(want)], want) {
+		t.Fatalf("active events %v, want prefix %v", got, want)
+	}
+
+	if disconnected := passiveEvents.waitFor(t, EventDisconnected, 3*time.Second); disconnected.Reason != DisconnectReasonPeerClosed {
+		t.Fatalf("expected peer closed reason, got %s", disconnected.Reason)
+	}
+}
+
+func TestReconnectScheduledEvent(t *testing.T) {
+	active := NewHsmsProtocol("127.0.0.1", freePort(t), true, 1, "active")
+	active.Timeouts().SetAutoReconnect(true)
+	active.Timeouts().SetReconnectBackoffBase(1)
+	events := &eventRecorder{}
+	active.AddConnectionListener(events.record)
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	scheduled := events.waitFor(t, EventReconnectScheduled, 3*time.Second)
+	if scheduled.Attempt != 1 {
+		t.Fatalf("expected attempt 1, got %d", scheduled.Attempt)
+	}
+	if scheduled.Delay <= 0 {
+		t.Fatalf("expected positive delay, got %s", scheduled.Delay)
+	}
+}
+
+func equalEventTypes(a, b []ConnectionEventType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSelectKeepsLocalSessionID(t *testing.T) {
+	port := freePort(t)
+	passive := NewHsmsProtocol("127.0.0.1", port, false, 0, "equipment")
+	passive.Timeouts().SetLinktest(60)
+	recorder := &eventRecorder{}
+	passive.AddConnectionListener(recorder.record)
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+	waitForListening(t, passive)
+
+	newTestActive(t, port, 5, "host")
+
+	event := recorder.waitFor(t, EventDisconnected, 3*time.Second)
+	if event.Reason != DisconnectReasonSelectRejected {
+		t.Fatalf("expected select rejection, got %+v", event)
+	}
+	if passive.sessionID != 0 || passive.hsmsConnection.sessionID != 0 {
+		t.Fatalf("session ID changed to %d", passive.sessionID)
+	}
+}
@@ -2,6 +2,7 @@ package hsms
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -32,6 +33,9 @@ var (
 	ErrNotSelected = errors.New("hsms: connection not selected")
 	// ErrTimeout indicates the remote side did not answer within the configured timeout.
 	ErrTimeout = errors.New("hsms: timeout waiting for response")
+	// ErrDisabling is returned for new requests while Disable drains the
+	// connection.
+	ErrDisabling = errors.New("hsms: protocol is being disabled")
 )
 
 type LoggingMode int
@@ -61,6 +65,9 @@ func streamFunctionKey(stream, function int) string {
 // HsmsProtocol represents the base class for creating Host/Equipment models.
 var (
 	ErrT3Timeout = errors.New("T3 timeout")
+	// ErrT6Timeout is returned when a control request (Select, Deselect or
+	// Linktest) gets no response within T6. The connection is closed.
+	ErrT6Timeout = errors.New("hsms: T6 control transaction timeout")
 )
 
 type HsmsProtocol struct {
@@ -83,6 +90,8 @@ type HsmsProtocol struct {
 
 	queueMu      sync.RWMutex
 	systemQueues map[uint32]*utils.Deque
+	transactions map[uint32]*Transaction
+	wheel        timerWheel
 
 	logMu      sync.RWMutex
 	logCfg     LoggingConfig
@@ -92,14 +101,28 @@ type HsmsProtocol struct {
 	connDone   chan struct{}
 
 	connectThreadRunning *atomic.Bool
+	// draining is set while Disable shuts the connection down; new requests
+	// are refused with ErrDisabling.
+	draining *atomic.Bool
 
 	handlerMu      sync.RWMutex
 	handlers       map[string]DataMessageHandler
 	defaultHandler DataMessageHandler
 
-	linktestTimerMu sync.Mutex
-	linktestTimer   *time.Ticker
-	disconnectFlg   chan struct{}
+	interceptorMu sync.RWMutex
+	interceptors  []Interceptor
+
+	dispatchMu  sync.RWMutex
+	dispatchCfg DispatchConfig
+
+	listenerMu       sync.RWMutex
+	listeners        []func(ConnectionEvent)
+	disconnectReason *ConnectionEvent
+
+	linktestTimerMu  sync.Mutex
+	linktestTimer    *time.Ticker
+	disconnectFlg    chan struct{}
+	linktestFailures *atomic.Int32
 
 	t7TimerMu sync.Mutex
 	t7Timer   *time.Timer
@@ -107,6 +130,39 @@ type HsmsProtocol struct {
 	serverMu sync.Mutex
 	server   *link.Server
 
+	transportMu     sync.RWMutex
+	transport       Transport
+	readBufferSize  int
+	writeBufferSize int
+	maxMessageSize  int
+	lazyDecoding    bool
+	tlsConfig       *tls.Config
+	peerVerifier    PeerVerifier
+	localAddr       net.Addr
+	connectTimeout  time.Duration
+	// dialCancel aborts the connection attempt in progress; Disable calls it.
+	dialMu     sync.Mutex
+	dialCancel context.CancelFunc
+	// endpoints replace remoteAddress and remotePort when set. lastEndpoint
+	// indexes the endpoint of the last connection for FailoverSticky.
+	endpoints      []Endpoint
+	failover       FailoverPolicy
+	lastEndpoint   int
+	activeEndpoint Endpoint
+	// access filters the connections of a passive protocol;
+	// connectionPolicy handles one that arrives while connected.
+	access           *accessFilter
+	connectionPolicy ConnectionPolicy
+	claimMu          sync.Mutex
+	// router is set when a shared Server accepts connections on behalf of
+	// this passive protocol instead of a dedicated listener. It is set under
+	// the server's lock but read without it, hence atomic.
+	router atomic.Pointer[Server]
+	// sessionTable is set on the protocol that carries the TCP connection of
+	// an HSMS-GS general session; owner is set on each of its session entities.
+	sessionTable *GeneralSession
+	owner        *GeneralSession
+
 	// Reconnection state
 	reconnectAttempts  int
 	lastDisconnectTime time.Time
@@ -132,9 +188,16 @@ func NewHsmsProtocol(address string, port int, active bool, sessionID int, name
 		systemCounter:        atomic.NewUint32(rand.Uint32()),
 		timeouts:             NewSecsTimeout(),
 		systemQueues:         make(map[uint32]*utils.Deque),
+		transactions:         make(map[uint32]*Transaction),
 		handlers:             make(map[string]DataMessageHandler),
 		disconnectFlg:        make(chan struct{}, 1),
+		linktestFailures:     atomic.NewInt32(0),
 		connectThreadRunning: atomic.NewBool(false),
+		draining:             atomic.NewBool(false),
+		readBufferSize:       DefaultBufferSize,
+		writeBufferSize:      DefaultBufferSize,
+		maxMessageSize:       DefaultMaxMessageSize,
+		access:               newAccessFilter(),
 	}
 	h.logCfg.Writer = os.Stderr
 	h.logCfg.Mode = LoggingModeSML
@@ -177,18 +240,41 @@ func (p *HsmsProtocol) startLinktestTimer() {
 	}()
 
 	p.clearDisconnectFlag()
-	p.hsmsConnection.sendLinktestReq()
+	if !p.linktest() {
+		return
+	}
 
 	for {
 		select {
 		case <-ticker.C:
-			p.hsmsConnection.sendLinktestReq()
+			if !p.linktest() {
+				return
+			}
 		case <-p.disconnectFlg:
 			return
 		}
 	}
 }
 
+// linktest sends one Linktest.req and counts consecutive failures. It reports
+// false when the link is gone; on T6 expiry the connection has been closed and
+// the usual reconnect cycle follows.
+func (p *HsmsProtocol) linktest() bool {
+	if err := p.hsmsConnection.sendLinktestReq(); err != nil {
+		failures := p.linktestFailures.Inc()
+		p.logger.Warn("linktest failed", "consecutiveFailures", failures, "error", err)
+		return false
+	}
+	p.linktestFailures.Store(0)
+	return true
+}
+
+// LinktestFailures returns the number of consecutive failed linktests. It is
+// reset by the next successful linktest.
+func (p *HsmsProtocol) LinktestFailures() int {
+	return int(p.linktestFailures.Load())
+}
+
 func (p *HsmsProtocol) stopLinktestTimer() {
 	p.linktestTimerMu.Lock()
 	defer p.linktestTimerMu.Unlock()
@@ -215,6 +301,7 @@ func (p *HsmsProtocol) startT7Timer() {
 		p.logger.Warn("T7 timeout", "duration", duration)
 		p.connected.Store(false)
 		p.stopLinktestTimer()
+		p.setDisconnectReason(DisconnectReasonT7, nil)
 		if err := p.connectionState.TimeoutT7(); err != nil {
 			p.logger.Error("timeoutT7 transition error", "error", err)
 		}
@@ -238,12 +325,21 @@ func (p *HsmsProtocol) stopT7Timer() {
 
 func (p *HsmsProtocol) onStateConnectedNotSelected(ctx context.Context, _ *fsm.Event) {
 	p.logger.Info("state transition", "state", "CONNECTED_NOT_SELECTED")
+	if p.owner != nil {
+		// T7 is enforced once for the shared connection.
+		p.owner.updateSelected()
+		return
+	}
 	p.startT7Timer()
 }
 
 func (p *HsmsProtocol) onStateSelect(ctx context.Context, _ *fsm.Event) {
 	p.logger.Info("state transition", "state", "CONNECTED_SELECTED")
 	p.stopT7Timer()
+	p.publish(ConnectionEvent{Type: EventSelected})
+	if p.owner != nil {
+		p.owner.updateSelected()
+	}
 }
 
 func (p *HsmsProtocol) onStateDisconnect(ctx context.Context, _ *fsm.Event) {
@@ -251,6 +347,16 @@ func (p *HsmsProtocol) onStateDisconnect(ctx context.Context, _ *fsm.Event) {
 	p.connected.Store(false)
 	p.stopLinktestTimer()
 	p.stopT7Timer()
+	event := p.takeDisconnectEvent()
+	p.publish(event)
+	if p.sessionTable != nil {
+		p.sessionTable.disconnected(event)
+	}
+	if p.owner != nil {
+		// Entities are attached again by their general session.
+		p.owner.updateSelected()
+		return
+	}
 	if p.enabled.Load() {
 		if p.connectThreadRunning.CompareAndSwap(false, true) {
 			go p.startConnectThread()
@@ -261,14 +367,14 @@ func (p *HsmsProtocol) onStateDisconnect(ctx context.Context, _ *fsm.Event) {
 // onStateConnect is triggered when the HSMS connection transitions out of NOT-CONNECTED.
 func (p *HsmsProtocol) onStateConnect(ctx context.Context, _ *fsm.Event) {
 	go func() {
-		if p.active {
+		if p.active && p.sessionTable == nil {
 			if err := p.hsmsConnection.sendSelectReq(); err != nil {
 				p.logger.Error("send select.req failed", "error", err)
 				return
 			}
 		}
 
-		if !p.enabled.Load() {
+		if !p.enabled.Load() || p.owner != nil {
 			return
 		}
 
@@ -321,37 +427,40 @@ func (p *HsmsProtocol) OnConnectionEstablished() {
 // Enable starts the connection manager.
 func (p *HsmsProtocol) Enable() {
 	if p.enabled.CompareAndSwap(false, true) {
+		p.draining.Store(false)
 		if p.connectThreadRunning.CompareAndSwap(false, true) {
 			go p.startConnectThread()
 		}
 	}
 }
 
-// Disable stops the HSMS connection and releases resources.
+// Disable stops the HSMS connection and releases resources. An established
+// connection is shut down gracefully first, see closeGracefully, which takes
+// up to T3 + T6; use DisableContext to bound it.
 func (p *HsmsProtocol) Disable() {
+	p.DisableContext(context.Background())
+}
+
+// DisableContext is like Disable, but when ctx is done it stops waiting for
+// pending requests and for Deselect.rsp, and closes the connection at once.
+// New SendAndWait, SendAsync and SendDataMessage calls fail with ErrDisabling
+// from the start.
+func (p *HsmsProtocol) DisableContext(ctx context.Context) {
 	if !p.enabled.CompareAndSwap(true, false) {
 		return
 	}
+	p.draining.Store(true)
+	p.cancelDial()
 
 	p.stopLinktestTimer()
 	p.stopT7Timer()
+	if p.connectionState.CurrentState() != StateNotConnected {
+		p.setDisconnectReason(DisconnectReasonLocal, nil)
+	}
+	p.closeGracefully(ctx)
 	p.connected.Store(false)
 
-	if p.active {
-		if sess := p.hsmsConnection.Session(); sess != nil && !sess.IsClosed() {
-			if p.connectionState.CurrentState() == StateConnectedSelected {
-				if err := p.hsmsConnection.sendDeselectReq(); err != nil {
-					p.logger.Error("deselect failed", "error", err)
-				}
-			}
-			systemID := p.getNextSystemCounter()
-			sep := ast.NewHSMSMessageSeparateReq(uint16(p.sessionID), p.encodeSystemID(systemID))
-			if err := p.hsmsConnection.Send(sep.ToBytes()); err != nil {
-				p.logger.Error("send separate.req failed", "error", err)
-			}
-			// allow a brief moment for remote to process before closing
-			time.Sleep(200 * time.Millisecond)
-		}
+	if p.active || p.router.Load() != nil || p.owner != nil {
 		select {
 		case p.disconnectFlg <- struct{}{}:
 		default:
@@ -386,6 +495,15 @@ func (p *HsmsProtocol) waitForConnectionClosure(timeout time.Duration) {
 
 func (p *HsmsProtocol) startConnectThread() {
 	defer p.connectThreadRunning.Store(false)
+	if !p.active && p.router.Load() != nil {
+		// Connections are accepted and handed over by the shared server.
+		return
+	}
+	if p.owner != nil {
+		// Session entities share the connection of their general session.
+		p.owner.attach(p)
+		return
+	}
 	for p.enabled.Load() {
 		if p.active {
 			if err := p.activeConnect(); err != nil {
@@ -414,6 +532,7 @@ func (p *HsmsProtocol) startConnectThread() {
 				// Calculate exponential backoff delay
 				delay := p.calculateBackoffDelay()
 				p.logger.Info("reconnecting", "attempt", p.reconnectAttempts, "delay", delay)
+				p.publish(ConnectionEvent{Type: EventReconnectScheduled, Attempt: p.reconnectAttempts, Delay: delay})
 				time.Sleep(delay)
 				continue
 			}
@@ -423,7 +542,9 @@ func (p *HsmsProtocol) startConnectThread() {
 			if !p.enabled.Load() {
 				return
 			}
-			time.Sleep(time.Duration(p.timeouts.T5ConnSeparateTimeout()) * time.Second)
+			delay := time.Duration(p.timeouts.T5ConnSeparateTimeout()) * time.Second
+			p.publish(ConnectionEvent{Type: EventReconnectScheduled, Delay: delay})
+			time.Sleep(delay)
 			continue
 		}
 
@@ -440,10 +561,8 @@ func (p *HsmsProtocol) startConnectThread() {
 }
 
 func (p *HsmsProtocol) passiveConnect() error {
-	server, err := link.Listen("tcp",
-		fmt.Sprintf("%s:%d", p.remoteAddress, p.remotePort),
-		codec.Bufio(codec.SECSII(), 1024*5, 1024*5),
-		0, link.HandlerFunc(p.OnConnectionEstablishedAndStartReceiver))
+	server, err := p.connector().listen(p.remoteAddress, p.remotePort,
+		link.HandlerFunc(p.OnConnectionEstablishedAndStartReceiver))
 	if err != nil {
 		return err
 	}
@@ -452,7 +571,13 @@ func (p *HsmsProtocol) passiveConnect() error {
 	p.server = server
 	p.serverMu.Unlock()
 
-	err = server.SingleServe()
+	if p.getConnectionPolicy() == ConnectionPolicyWait {
+		err = server.SingleServe()
+	} else {
+		// Keep accepting, so connections that arrive while connected are
+		// rejected or replace the current one.
+		err = server.Serve()
+	}
 
 	p.serverMu.Lock()
 	if p.server == server {
@@ -468,17 +593,68 @@ func (p *HsmsProtocol) passiveConnect() error {
 	return nil
 }
 
+// activeConnect tries the endpoints in failover order and serves the first
+// connection that succeeds. It fails when every endpoint failed.
 func (p *HsmsProtocol) activeConnect() error {
-	session, err := link.Dial("tcp", fmt.Sprintf("%s:%d", p.remoteAddress, p.remotePort),
-		codec.Bufio(codec.SECSII(), 1024*5, 1024*5), 0)
-	if err != nil {
-		return err
+	conn := p.connector()
+	var errs []error
+	for _, endpoint := range p.endpointOrder() {
+		session, err := p.dialEndpoint(conn, endpoint)
+		if err != nil {
+			if !p.enabled.Load() {
+				return err
+			}
+			p.logger.Warn("connect to endpoint failed", "endpoint", endpoint, "error", err)
+			p.publish(ConnectionEvent{Type: EventConnectFailed, Endpoint: endpoint, Err: err})
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+			continue
+		}
+
+		p.setActiveEndpoint(endpoint)
+		p.hsmsConnection.SetSession(session)
+		p.OnConnectionEstablishedAndStartReceiver(session)
+		return nil
 	}
+	return errors.Join(errs...)
+}
 
-	p.hsmsConnection.SetSession(session)
-	p.OnConnectionEstablishedAndStartReceiver(session)
+// dialEndpoint connects to endpoint within the connect timeout, T5 unless
+// SetConnectTimeout set one. Disable aborts it.
+func (p *HsmsProtocol) dialEndpoint(conn connector, endpoint Endpoint) (*link.Session, error) {
+	timeout := conn.connectTimeout
+	if timeout <= 0 {
+		timeout = time.Duration(p.timeouts.T5ConnSeparateTimeout()) * time.Second
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
 
-	return nil
+	p.dialMu.Lock()
+	if !p.enabled.Load() {
+		cancel()
+	}
+	p.dialCancel = cancel
+	p.dialMu.Unlock()
+	defer func() {
+		p.dialMu.Lock()
+		p.dialCancel = nil
+		p.dialMu.Unlock()
+	}()
+
+	return conn.dial(ctx, endpoint.Address, endpoint.Port)
+}
+
+func (p *HsmsProtocol) cancelDial() {
+	p.dialMu.Lock()
+	if p.dialCancel != nil {
+		p.dialCancel()
+	}
+	p.dialMu.Unlock()
 }
 
 // handleHsmsRequests processes HSMS control messages.
@@ -492,7 +668,7 @@ func (p *HsmsProtocol) handleHsmsRequests(message ast.HSMSMessage) {
 		ctrl, ok := message.(*ast.ControlMessage)
 		if !ok {
 			p.logger.Warn("received malformed select.req")
-			p.hsmsConnection.sendReject(message, RejectReasonBusyOrAlreadyActive)
+			p.hsmsConnection.sendReject(message, RejectReasonPTypeNotSupported)
 			return
 		}
 
@@ -500,27 +676,19 @@ func (p *HsmsProtocol) handleHsmsRequests(message ast.HSMSMessage) {
 		expectedSession := uint16(p.sessionID)
 		if receivedSession != expectedSession {
 			// 0xFFFF0000 是 HSMS 标准规定的“系统消息会话 ID”，只用于 Select/Linktest 等控制消息。
-			acceptMismatch := false
+			// The session ID is fixed at construction; a remote using another
+			// ID is denied rather than adopted.
 			if receivedSession == 0xFFFF {
 				p.logger.Info(
 					"select.req session mismatch: remote used wildcard",
 					"remote", receivedSession, "expected", expectedSession,
 				)
-				acceptMismatch = true
-			} else if expectedSession == 0 || expectedSession == 0xFFFF {
-				p.logger.Info(
-					"select.req session mismatch: adopting remote session",
-					"remote", receivedSession, "expected", expectedSession,
-				)
-				p.sessionID = int(receivedSession)
-				p.hsmsConnection.sessionID = int(receivedSession)
-				acceptMismatch = true
-			}
-			if !acceptMismatch {
+			} else {
 				p.logger.Warn("select.req session mismatch", "remote", receivedSession, "expected", expectedSession)
 				p.hsmsConnection.sendSelectRsp(message, ControlStatusDenied)
 				_ = p.hsmsConnection.Close()
 				p.connected.Store(false)
+				p.setDisconnectReason(DisconnectReasonSelectRejected, nil)
 				if err := p.connectionState.Disconnect(); err != nil {
 					p.logger.Error("change state to NOT-CONNECTED failed", "error", err)
 				}
@@ -529,7 +697,7 @@ func (p *HsmsProtocol) handleHsmsRequests(message ast.HSMSMessage) {
 		}
 
 		if !p.connected.Load() {
-			p.hsmsConnection.sendReject(message, RejectReasonNotReady)
+			p.hsmsConnection.sendReject(message, RejectReasonEntityNotSelected)
 			return
 		}
 		p.hsmsConnection.sendSelectRsp(message, ControlStatusAccepted)
@@ -549,6 +717,7 @@ func (p *HsmsProtocol) handleHsmsRequests(message ast.HSMSMessage) {
 		if ControlStatus(ctrl.Status()) != ControlStatusAccepted {
 			p.logger.Warn("select.rsp rejected", "status", ctrl.Status())
 			p.connected.Store(false)
+			p.setDisconnectReason(DisconnectReasonSelectRejected, nil)
 			if err := p.connectionState.Disconnect(); err != nil {
 				p.logger.Error("change state to NOT-CONNECTED failed", "error", err)
 			}
@@ -561,17 +730,23 @@ func (p *HsmsProtocol) handleHsmsRequests(message ast.HSMSMessage) {
 
 	case hsms.DeselectReqStr:
 		if !p.connected.Load() {
-			p.hsmsConnection.sendReject(message, RejectReasonNotReady)
+			p.hsmsConnection.sendReject(message, RejectReasonEntityNotSelected)
 			return
 		}
 		p.hsmsConnection.sendDeselectRsp(message, ControlStatusAccepted)
 		if err := p.connectionState.Deselect(); err != nil {
 			p.logger.Error("change state to NOT-SELECTED failed", "error", err)
+		} else {
+			p.publish(ConnectionEvent{Type: EventDeselected, Remote: true})
 		}
 
 	case hsms.DeselectRspStr:
-		if err := p.connectionState.Deselect(); err != nil {
+		if ctrl, ok := message.(*ast.ControlMessage); ok && ControlStatus(ctrl.Status()) != ControlStatusAccepted {
+			p.logger.Warn("deselect.rsp rejected", "status", ctrl.Status())
+		} else if err := p.connectionState.Deselect(); err != nil {
 			p.logger.Error("change state to NOT-SELECTED failed", "error", err)
+		} else {
+			p.publish(ConnectionEvent{Type: EventDeselected})
 		}
 		if queue, ok := p.fetchQueue(systemID); ok {
 			queue.Put(message)
@@ -579,16 +754,21 @@ func (p *HsmsProtocol) handleHsmsRequests(message ast.HSMSMessage) {
 
 	case hsms.LinktestReqStr:
 		if !p.connected.Load() {
-			p.hsmsConnection.sendReject(message, RejectReasonNotReady)
+			p.hsmsConnection.sendReject(message, RejectReasonEntityNotSelected)
 			return
 		}
 		p.hsmsConnection.sendLinkTestRsp(message)
 
+	case hsms.RejectReqStr:
+		p.handleReject(message, systemID)
+
 	case hsms.SeparateReqStr:
 		p.logger.Info("received separate.req, closing session")
 		p.onDisconnection()
 		p.stopLinktestTimer()
 		p.connected.Store(false)
+		p.publish(ConnectionEvent{Type: EventSeparated, Remote: true})
+		p.setDisconnectReason(DisconnectReasonSeparate, nil)
 		if err := p.connectionState.Disconnect(); err != nil {
 			p.logger.Error("change state to NOT-CONNECTED failed", "error", err)
 		}
@@ -625,9 +805,19 @@ func (p *HsmsProtocol) invokeHandler(handler DataMessageHandler, msg *ast.DataMe
 		response = response.SetWaitBit(false)
 	}
 
+	response, reply, err := p.interceptOutbound(response, msg)
+	if reply != nil {
+		p.sendInterceptorReply(reply, msg)
+		return
+	}
+	if err != nil || response == nil {
+		p.logger.Info("handler response withheld by interceptor", "stream", msg.StreamCode(), "function", msg.FunctionCode(), "error", err)
+		return
+	}
+
 	p.logDataMessage("OUT", response)
 
-	if err := p.hsmsConnection.Send(response.ToBytes()); err != nil {
+	if err := p.hsmsConnection.Send(response); err != nil {
 		p.logger.Error("send response failed", "stream", response.StreamCode(), "function", response.FunctionCode(), "error", err)
 	}
 }
@@ -777,16 +967,42 @@ func (p *HsmsProtocol) handleDataMessage(message *ast.DataMessage) {
 	p.sendS9ErrorForUnrecognized(message)
 }
 
-func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.Session) {
-	if !p.active {
-		if p.hsmsConnection.Session() == nil {
-			p.hsmsConnection.SetSession(connection)
-		} else if !p.hsmsConnection.Session().IsClosed() {
+// claimSession makes connection the session of a passive protocol. A live
+// session is kept or replaced according to the connection policy.
+func (p *HsmsProtocol) claimSession(connection *link.Session) bool {
+	p.claimMu.Lock()
+	defer p.claimMu.Unlock()
+
+	current := p.hsmsConnection.Session()
+	if current != nil && current != connection && !current.IsClosed() {
+		if p.getConnectionPolicy() != ConnectionPolicyReplace {
+			p.access.busy.Inc()
+			p.logger.Warn("connection refused", "remote", connection.RemoteAddr(), "error", ErrConnectionBusy)
 			_ = connection.Close()
-			return
-		} else {
-			p.hsmsConnection.SetSession(connection)
+			p.refuseConnection(connection.RemoteAddr(), ErrConnectionBusy)
+			return false
 		}
+		p.logger.Info("replacing connection", "old", current.RemoteAddr(), "new", connection.RemoteAddr())
+		p.stopLinktestTimer()
+		p.stopT7Timer()
+		p.setDisconnectReason(DisconnectReasonReplaced, nil)
+		_ = current.Close()
+		p.waitForConnectionClosure(2 * time.Second)
+	}
+	p.hsmsConnection.SetSession(connection)
+	return true
+}
+
+func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.Session) {
+	p.serveSession(connection, nil)
+}
+
+// serveSession runs the receive loop for connection. pending holds a control
+// message that was already read from the connection (the Select.req used by
+// Server for routing) and is processed before anything else.
+func (p *HsmsProtocol) serveSession(connection *link.Session, pending ast.HSMSMessage) {
+	if !p.active && !p.claimSession(connection) {
+		return
 	}
 
 	done := make(chan struct{})
@@ -805,6 +1021,7 @@ func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.
 		if sess := p.hsmsConnection.Session(); sess == connection {
 			p.hsmsConnection.SetSession(nil)
 		}
+		p.failTransactions(ErrNotConnected)
 
 		close(done)
 	}()
@@ -823,9 +1040,32 @@ func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.
 		defer deadlineCodec.SetReadDeadline(time.Time{})
 	}
 
+	dispatcher := p.newDispatcher()
+	defer dispatcher.stop()
+
+	connected := ConnectionEvent{
+		Type:       EventConnected,
+		LocalAddr:  connection.LocalAddr(),
+		RemoteAddr: connection.RemoteAddr(),
+	}
+	if p.active {
+		p.transportMu.RLock()
+		connected.Endpoint = p.activeEndpoint
+		p.transportMu.RUnlock()
+	}
+	p.publish(connected)
 	p.OnConnectionEstablished()
+	if p.sessionTable != nil {
+		p.sessionTable.connected(connection)
+	}
 
-	for p.enabled.Load() {
+	if pending != nil {
+		p.handleHsmsRequests(pending)
+	}
+
+	// The loop runs until the connection is closed, so that replies to the
+	// Deselect.req sent by Disable are still received.
+	for {
 		if deadlineCodec != nil {
 			if err := deadlineCodec.SetReadDeadline(time.Now().Add(t8Duration)); err != nil {
 				p.logger.Error("set read deadline failed", "error", err)
@@ -840,6 +1080,19 @@ func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.
 			}
 		}
 
+		var tooLong *codec.MessageTooLongError
+		if errors.As(err, &tooLong) {
+			p.logger.Warn("message too long, skipped", "length", tooLong.Length, "max", tooLong.Max)
+			p.sendS9F11DataTooLong(tooLong.Header[6:10])
+			continue
+		}
+
+		var parseErr *codec.ParseError
+		if errors.As(err, &parseErr) {
+			p.handleMalformedMessage(parseErr)
+			continue
+		}
+
 		if err != nil {
 			p.connected.Store(false)
 			p.stopLinktestTimer()
@@ -848,6 +1101,9 @@ func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.
 			if t8Duration > 0 {
 				if ne, ok := err.(net.Error); ok && ne.Timeout() {
 					p.logger.Warn("receive error: T8 timeout", "duration", t8Duration)
+					if p.connectionState.CurrentState() != StateNotConnected {
+						p.setDisconnectReason(DisconnectReasonT8, err)
+					}
 					logHandled = true
 				}
 			}
@@ -856,6 +1112,14 @@ func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.
 			}
 
 			if p.connectionState.CurrentState() != StateNotConnected {
+				switch {
+				case !p.enabled.Load():
+					p.setDisconnectReason(DisconnectReasonLocal, nil)
+				case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+					p.setDisconnectReason(DisconnectReasonPeerClosed, err)
+				default:
+					p.setDisconnectReason(DisconnectReasonError, err)
+				}
 				if err := p.connectionState.Disconnect(); err != nil {
 					p.logger.Error("change state to NOT-CONNECTED failed", "error", err)
 				}
@@ -864,31 +1128,45 @@ func (p *HsmsProtocol) OnConnectionEstablishedAndStartReceiver(connection *link.
 		}
 
 		message := rsp.(ast.HSMSMessage)
-		if message.Type() != hsms.DataMessageStr {
-			p.handleHsmsRequests(message)
+		if p.sessionTable != nil && p.sessionTable.route(message) {
 			continue
 		}
+		p.receive(message, dispatcher)
+	}
+}
 
-		dataMessage, ok := message.(*ast.DataMessage)
-		if !ok {
-			p.logger.Warn("unexpected HSMS message type", "type", fmt.Sprintf("%T", message))
-			continue
-		}
+// receive processes one message read from the connection.
+func (p *HsmsProtocol) receive(message ast.HSMSMessage, dispatcher *dispatcher) {
+	if message.Type() != hsms.DataMessageStr {
+		p.handleHsmsRequests(message)
+		return
+	}
 
-		p.logDataMessage("IN", dataMessage)
+	dataMessage, ok := message.(*ast.DataMessage)
+	if !ok {
+		p.logger.Warn("unexpected HSMS message type", "type", fmt.Sprintf("%T", message))
+		return
+	}
 
-		if p.connectionState.CurrentState() != StateConnectedSelected {
-			p.logger.Warn("received message while not selected")
-			continue
-		}
+	p.logDataMessage("IN", dataMessage)
 
-		systemID := binary.BigEndian.Uint32(dataMessage.SystemBytes())
-		if queue, ok := p.fetchQueue(systemID); ok {
-			queue.Put(dataMessage)
-			continue
-		}
+	if p.connectionState.CurrentState() != StateConnectedSelected {
+		p.logger.Warn("received message while not selected")
+		p.hsmsConnection.sendReject(dataMessage, RejectReasonEntityNotSelected)
+		return
+	}
 
-		p.handleDataMessage(dataMessage)
+	if p.resolveTransaction(dataMessage) {
+		return
+	}
+	systemID := binary.BigEndian.Uint32(dataMessage.SystemBytes())
+	if queue, ok := p.fetchQueue(systemID); ok {
+		queue.Put(dataMessage)
+		return
+	}
+
+	if dataMessage, ok = p.interceptInbound(dataMessage); ok {
+		dispatcher.dispatch(dataMessage)
 	}
 }
 
@@ -902,12 +1180,24 @@ func (p *HsmsProtocol) ensureReady(requireSelected bool) error {
 	return nil
 }
 
+// ensureAccepting is ensureReady for new data requests, which are refused
+// while Disable drains the connection. Replies are still sent.
+func (p *HsmsProtocol) ensureAccepting() error {
+	if err := p.ensureReady(true); err != nil {
+		return err
+	}
+	if p.draining.Load() {
+		return ErrDisabling
+	}
+	return nil
+}
+
 // SendDataMessage sends a SECS-II data message without waiting for the reply.
 func (p *HsmsProtocol) SendDataMessage(message *ast.DataMessage) error {
 	if message == nil {
 		return errors.New("hsms: nil message")
 	}
-	if err := p.ensureReady(true); err != nil {
+	if err := p.ensureAccepting(); err != nil {
 		return err
 	}
 
@@ -917,19 +1207,40 @@ func (p *HsmsProtocol) SendDataMessage(message *ast.DataMessage) error {
 		outgoing = outgoing.SetWaitBit(false)
 	}
 
+	outgoing, local, err := p.interceptOutbound(outgoing, nil)
+	if err != nil || local != nil {
+		return err
+	}
+
 	p.logDataMessage("OUT", outgoing)
 
-	return p.hsmsConnection.Send(outgoing.ToBytes())
+	return p.hsmsConnection.Send(outgoing)
 }
 
 // SendAndWait sends a SECS-II data message and waits for the response.
 func (p *HsmsProtocol) SendAndWait(message *ast.DataMessage) (*ast.DataMessage, error) {
+	return p.SendAndWaitContext(context.Background(), message)
+}
+
+// SendAndWaitContext is like SendAndWait but gives up with ctx.Err() when ctx
+// is done. A deadline on ctx replaces T3 for this transaction.
+func (p *HsmsProtocol) SendAndWaitContext(ctx context.Context, message *ast.DataMessage) (*ast.DataMessage, error) {
 	if message == nil {
 		return nil, errors.New("hsms: nil message")
 	}
-	if err := p.ensureReady(true); err != nil {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if err := p.ensureAccepting(); err != nil {
+		return nil, err
+	}
+
+	waitCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, time.Duration(p.timeouts.T3ReplyTimeout())*time.Second)
+		defer cancel()
+	}
 
 	systemID := p.getNextSystemCounter()
 	queue := p.createQueue(systemID)
@@ -940,28 +1251,41 @@ func (p *HsmsProtocol) SendAndWait(message *ast.DataMessage) (*ast.DataMessage,
 		outgoing = outgoing.SetWaitBit(true)
 	}
 
+	outgoing, local, err := p.interceptOutbound(outgoing, nil)
+	if err != nil {
+		return nil, err
+	}
+	if local != nil {
+		return local, nil
+	}
+
 	p.logDataMessage("OUT", outgoing)
 
-	if err := p.hsmsConnection.Send(outgoing.ToBytes()); err != nil {
+	if err := p.hsmsConnection.Send(outgoing); err != nil {
 		return nil, err
 	}
 
-	resp, err := queue.Get(p.timeouts.T3ReplyTimeout())
+	resp, err := queue.GetContext(waitCtx)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		// On T3 timeout (Wait Bit=True was sent), send S9F9
 		p.sendS9F9TransactionTimeout(outgoing)
 		return nil, ErrT3Timeout
 	}
 
 	switch value := resp.(type) {
+	case error:
+		return nil, value
 	case *ast.DataMessage:
-		return value, nil
+		return p.interceptReply(value, outgoing)
 	case ast.HSMSMessage:
 		dataMessage, ok := value.(*ast.DataMessage)
 		if !ok {
 			return nil, fmt.Errorf("hsms: unexpected response type %T", value)
 		}
-		return dataMessage, nil
+		return p.interceptReply(dataMessage, outgoing)
 	default:
 		return nil, fmt.Errorf("hsms: unexpected response payload %T", resp)
 	}
@@ -981,9 +1305,14 @@ func (p *HsmsProtocol) SendResponse(message *ast.DataMessage, systemBytes []byte
 		outgoing = outgoing.SetWaitBit(false)
 	}
 
+	outgoing, local, err := p.interceptOutbound(outgoing, nil)
+	if err != nil || local != nil {
+		return err
+	}
+
 	p.logDataMessage("OUT", outgoing)
 
-	return p.hsmsConnection.Send(outgoing.ToBytes())
+	return p.hsmsConnection.Send(outgoing)
 }
 
 // RegisterHandler registers a callback for a specific stream/function pair.
@@ -0,0 +1,57 @@
+package hsms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func TestSendAndWaitContext(t *testing.T) {
+	server, port := startTestServer(t)
+
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	// S1F1 is swallowed so the host never gets a reply.
+	passive.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return nil, nil
+	})
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	request := ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := active.SendAndWaitContext(ctx, request); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("context deadline did not override T3, waited %v", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := active.SendAndWaitContext(ctx, request); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+
+	active.queueMu.RLock()
+	pending := len(active.systemQueues)
+	active.queueMu.RUnlock()
+	if pending != 0 {
+		t.Fatalf("expected no pending transactions, got %d", pending)
+	}
+}
@@ -1,6 +1,10 @@
 package hsms
 
 import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/younglifestyle/secs4go/codec"
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
 )
 
@@ -18,31 +22,29 @@ func (p *HsmsProtocol) sendS9ErrorForUnrecognized(message *ast.DataMessage) {
 		return
 	}
 
-	var s9Message *ast.DataMessage
-
 	// Check if it's an unknown stream entirely
 	isKnownStream := p.isKnownStream(stream)
 
 	if !isKnownStream {
 		// Unknown stream - send S9F3
-		s9Message = BuildS9F3(byte(stream), systemBytes)
 		p.logger.Info("unrecognized stream, sending S9F3", "stream", stream, "function", function)
+		p.sendS9Error(BuildS9F3(byte(stream), systemBytes), systemBytes)
 	} else {
 		// Known stream but unknown function - send S9F5
-		s9Message = BuildS9F5(byte(function), systemBytes)
 		p.logger.Info("unrecognized function, sending S9F5", "stream", stream, "function", function)
+		p.sendS9Error(BuildS9F5(byte(function), systemBytes), systemBytes)
 	}
+}
 
-	if s9Message != nil {
-		// Set session ID and ensure no wait bit
-		s9Message = s9Message.SetSessionIDAndSystemBytes(p.sessionID, systemBytes)
-		s9Message = s9Message.SetWaitBit(false)
+// sendS9Error sends an S9 error message with the given system bytes and no wait bit.
+func (p *HsmsProtocol) sendS9Error(s9Message *ast.DataMessage, systemBytes []byte) {
+	s9Message = s9Message.SetSessionIDAndSystemBytes(p.sessionID, systemBytes)
+	s9Message = s9Message.SetWaitBit(false)
 
-		p.logDataMessage("OUT", s9Message)
+	p.logDataMessage("OUT", s9Message)
 
-		if err := p.hsmsConnection.Send(s9Message.ToBytes()); err != nil {
-			p.logger.Error("failed to send S9 error message", "error", err)
-		}
+	if err := p.hsmsConnection.Send(s9Message); err != nil {
+		p.logger.Error("failed to send S9 error message", "function", s9Message.FunctionCode(), "error", err)
 	}
 }
 
@@ -81,30 +83,42 @@ func (p *HsmsProtocol) isKnownStream(stream int) bool {
 
 // sendS9F7IllegalData sends S9F7 for illegal data format
 func (p *HsmsProtocol) sendS9F7IllegalData(systemBytes []byte) {
-	s9Message := BuildS9F7(systemBytes)
-	s9Message = s9Message.SetSessionIDAndSystemBytes(p.sessionID, systemBytes)
-	s9Message = s9Message.SetWaitBit(false)
-
 	p.logger.Info("illegal data format, sending S9F7")
-	p.logDataMessage("OUT", s9Message)
+	p.sendS9Error(BuildS9F7(systemBytes), systemBytes)
+}
 
-	if err := p.hsmsConnection.Send(s9Message.ToBytes()); err != nil {
-		p.logger.Error("failed to send S9F7", "error", err)
+// handleMalformedMessage answers a message the codec could not decode. Data
+// messages get S9F7; control messages with an unknown PType or SType, or
+// with text they should not carry, get Reject.req. The connection is kept.
+func (p *HsmsProtocol) handleMalformedMessage(parseErr *codec.ParseError) {
+	header := parseErr.Header
+	p.logger.Warn("malformed message",
+		"length", parseErr.Length,
+		"header", hex.EncodeToString(header),
+		"raw", hex.EncodeToString(parseErr.Raw),
+		"error", parseErr.Err,
+	)
+
+	if parseErr.DataMessage() {
+		p.sendS9F7IllegalData(header[6:10])
+		return
+	}
+
+	reason := RejectReasonSTypeNotSupported
+	if header[4] != 0 {
+		reason = RejectReasonPTypeNotSupported
+	}
+	reject := ast.NewHSMSMessageRejectReq(binary.BigEndian.Uint16(header[:2]), header[4], header[5], header[6:10], byte(reason))
+	p.logControlMessage("TX", reject)
+	if err := p.hsmsConnection.Send(reject); err != nil {
+		p.logger.Error("send reject.req failed", "error", err)
 	}
 }
 
 // sendS9F11DataTooLong sends S9F11 for oversized messages
 func (p *HsmsProtocol) sendS9F11DataTooLong(systemBytes []byte) {
-	s9Message := BuildS9F11(systemBytes)
-	s9Message = s9Message.SetSessionIDAndSystemBytes(p.sessionID, systemBytes)
-	s9Message = s9Message.SetWaitBit(false)
-
 	p.logger.Info("message too long, sending S9F11")
-	p.logDataMessage("OUT", s9Message)
-
-	if err := p.hsmsConnection.Send(s9Message.ToBytes()); err != nil {
-		p.logger.Error("failed to send S9F11", "error", err)
-	}
+	p.sendS9Error(BuildS9F11(systemBytes), systemBytes)
 }
 
 // sendS9F9TransactionTimeout sends S9F9 for T3 transaction timeout
@@ -113,50 +127,54 @@ func (p *HsmsProtocol) sendS9F9TransactionTimeout(originalMsg *ast.DataMessage)
 	// W: <B [10] SHeader>
 	// The stored header of the message associated with the transaction timer timeout.
 
-	// We need to reconstruct the 10-byte header from the original message
-	// Device ID (2 bytes), Stream (1 byte), Function (1 byte), PType (1 byte), SType (1 byte), System Bytes (4 bytes)
+	headerBytes := messageHeader(originalMsg)
+
+	s9Message := BuildS9F9(headerBytes, nil)
+
+	if s9Message != nil {
+		// Set session ID and ensure no wait bit for error message
+		// Use next system bytes for the S9 message itself
+		systemID := p.getNextSystemCounter()
+		nextSys := p.encodeSystemID(systemID)
+
+		s9Message = s9Message.SetSessionIDAndSystemBytes(p.sessionID, nextSys)
+		s9Message = s9Message.SetWaitBit(false)
+
+		p.logger.Info("T3 timeout, sending S9F9", "stream", originalMsg.StreamCode(), "function", originalMsg.FunctionCode())
+		p.logDataMessage("OUT", s9Message)
+
+		if err := p.hsmsConnection.Send(s9Message); err != nil {
+			p.logger.Error("failed to send S9F9", "error", err)
+		}
+	}
+}
 
+// messageHeader reconstructs the 10-byte HSMS header of a data message:
+// Device ID (2 bytes), Stream (1 byte), Function (1 byte), PType (1 byte), SType (1 byte), System Bytes (4 bytes)
+func messageHeader(msg *ast.DataMessage) []byte {
 	headerBytes := make([]byte, 10)
 
 	// Device ID / Session ID
-	session := originalMsg.SessionID()
+	session := msg.SessionID()
 	headerBytes[0] = byte(session >> 8)
 	headerBytes[1] = byte(session)
 
 	// Stream & Function - Wait Bit is in Stream byte
-	stream := byte(originalMsg.StreamCode())
-	if originalMsg.WaitBit() == "true" {
+	stream := byte(msg.StreamCode())
+	if msg.WaitBit() == "true" {
 		stream |= 0x80
 	}
 	headerBytes[2] = stream
-	headerBytes[3] = byte(originalMsg.FunctionCode())
+	headerBytes[3] = byte(msg.FunctionCode())
 
 	// PType, SType
 	headerBytes[4] = 0 // PType = 0 (SECS-II)
 	headerBytes[5] = 0 // SType = 0 (Data Message)
 
 	// System Bytes
-	sysBytes := originalMsg.SystemBytes()
+	sysBytes := msg.SystemBytes()
 	if len(sysBytes) >= 4 {
 		copy(headerBytes[6:], sysBytes[:4])
 	}
-
-	s9Message := BuildS9F9(headerBytes, nil)
-
-	if s9Message != nil {
-		// Set session ID and ensure no wait bit for error message
-		// Use next system bytes for the S9 message itself
-		systemID := p.getNextSystemCounter()
-		nextSys := p.encodeSystemID(systemID)
-
-		s9Message = s9Message.SetSessionIDAndSystemBytes(p.sessionID, nextSys)
-		s9Message = s9Message.SetWaitBit(false)
-
-		p.logger.Info("T3 timeout, sending S9F9", "stream", originalMsg.StreamCode(), "function", originalMsg.FunctionCode())
-		p.logDataMessage("OUT", s9Message)
-
-		if err := p.hsmsConnection.Send(s9Message.ToBytes()); err != nil {
-			p.logger.Error("failed to send S9F9", "error", err)
-		}
-	}
+	return headerBytes
 }
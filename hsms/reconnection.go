@@ -7,14 +7,20 @@ import (
 
 // calculateBackoffDelay calculates the delay for exponential backoff
 func (p *HsmsProtocol) calculateBackoffDelay() time.Duration {
-	base := p.timeouts.ReconnectBackoffBase()
-	max := p.timeouts.ReconnectBackoffMax()
+	return p.timeouts.ReconnectDelay(p.reconnectAttempts)
+}
+
+// ReconnectDelay returns the exponential backoff delay before reconnect
+// attempt number attempt (starting at 1), capped at ReconnectBackoffMax.
+func (s *SecsTimeout) ReconnectDelay(attempt int) time.Duration {
+	base := s.ReconnectBackoffBase()
+	max := s.ReconnectBackoffMax()
 
 	// Calculate: base * 2^(attempts-1)
 	// For attempt 1: base * 2^0 = base
 	// For attempt 2: base * 2^1 = base * 2
 	// For attempt 3: base * 2^2 = base * 4
-	delay := float64(base) * math.Pow(2, float64(p.reconnectAttempts-1))
+	delay := float64(base) * math.Pow(2, float64(attempt-1))
 
 	// Cap at maximum
 	if delay > float64(max) {
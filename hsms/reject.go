@@ -0,0 +1,76 @@
+package hsms
+
+import (
+	"fmt"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// RejectError is returned to the sender of a message the peer answered with
+// Reject.req.
+type RejectError struct {
+	Reason RejectReason
+	// PType is the rejected PType when Reason is RejectReasonPTypeNotSupported;
+	// otherwise SType is the rejected SType (0 for data messages).
+	PType       byte
+	SType       byte
+	SessionID   uint16
+	SystemBytes []byte
+}
+
+func (e *RejectError) Error() string {
+	if e.Reason == RejectReasonPTypeNotSupported {
+		return fmt.Sprintf("hsms: message rejected: %s (ptype %d)", e.Reason, e.PType)
+	}
+	return fmt.Sprintf("hsms: message rejected: %s (stype %d)", e.Reason, e.SType)
+}
+
+func newRejectError(message *ast.ControlMessage) *RejectError {
+	rejectErr := &RejectError{
+		Reason:      RejectReason(message.Status()),
+		SessionID:   message.SessionID(),
+		SystemBytes: append([]byte(nil), message.SystemBytes()...),
+	}
+	if rejectErr.Reason == RejectReasonPTypeNotSupported {
+		rejectErr.PType = message.RejectedType()
+	} else {
+		rejectErr.SType = message.RejectedType()
+	}
+	return rejectErr
+}
+
+// handleReject fails the request the Reject.req refers to, or publishes an
+// EventRejected when no request is waiting for it.
+func (p *HsmsProtocol) handleReject(message ast.HSMSMessage, systemID uint32) {
+	ctrl, ok := message.(*ast.ControlMessage)
+	if !ok {
+		p.logger.Warn("received malformed reject.req")
+		return
+	}
+	rejectErr := newRejectError(ctrl)
+	if p.failPending(systemID, rejectErr) {
+		p.logger.Warn("request rejected by peer", "reason", rejectErr.Reason)
+		return
+	}
+	p.logger.Warn("received unsolicited reject.req", "reason", rejectErr.Reason)
+	p.publish(ConnectionEvent{Type: EventRejected, Err: rejectErr})
+}
+
+// failPending fails the SendAsync transaction, SendAndWait call or control
+// request waiting on systemID. It reports false when nothing was waiting.
+func (p *HsmsProtocol) failPending(systemID uint32, err error) bool {
+	p.queueMu.Lock()
+	tx, ok := p.transactions[systemID]
+	delete(p.transactions, systemID)
+	p.queueMu.Unlock()
+
+	if ok {
+		tx.complete(nil, err)
+		return true
+	}
+	if queue, ok := p.fetchQueue(systemID); ok {
+		queue.Put(err)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package hsms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/parser/hsms"
+)
+
+func TestRejectFailsWaitingRequests(t *testing.T) {
+	port := startScriptedPeer(t, func(msg ast.HSMSMessage) []ast.HSMSMessage {
+		switch msg.Type() {
+		case hsms.SelectReqStr:
+			return []ast.HSMSMessage{ast.NewHSMSMessageSelectRsp(msg, byte(ControlStatusAccepted))}
+		case hsms.LinktestReqStr:
+			return []ast.HSMSMessage{ast.NewHSMSMessageLinktestRsp(msg)}
+		case hsms.DataMessageStr:
+			if msg.(*ast.DataMessage).StreamCode() == 2 {
+				// Refers to a transaction that does not exist.
+				return []ast.HSMSMessage{ast.NewHSMSMessageRejectReq(1, 0, 0, []byte{0xDE, 0xAD, 0xBE, 0xEF}, byte(RejectReasonTransactionNotOpen))}
+			}
+			return []ast.HSMSMessage{ast.NewHSMSMessageRejectReqFromMsg(msg, byte(RejectReasonEntityNotSelected))}
+		}
+		return nil
+	})
+
+	active := NewHsmsProtocol("127.0.0.1", port, true, 1, "active")
+	active.Timeouts().SetLinktest(60)
+	events := &eventRecorder{}
+	active.AddConnectionListener(events.record)
+	active.Enable()
+	t.Cleanup(active.Disable)
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	start := time.Now()
+	_, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+	var rejectErr *RejectError
+	if !errors.As(err, &rejectErr) {
+		t.Fatalf("expected RejectError, got %v", err)
+	}
+	if rejectErr.Reason != RejectReasonEntityNotSelected || rejectErr.SType != 0 {
+		t.Fatalf("unexpected reject %+v", rejectErr)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("reject should fail the caller immediately, took %s", elapsed)
+	}
+
+	tx := active.SendAsync(ast.NewDataMessage("", 1, 3, 1, "H->E", ast.NewListNode()))
+	select {
+	case <-tx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("async transaction not failed by reject")
+	}
+	if !errors.As(tx.Err(), &rejectErr) {
+		t.Fatalf("expected RejectError from transaction, got %v", tx.Err())
+	}
+
+	if err := active.SendDataMessage(ast.NewDataMessage("", 2, 17, 0, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("SendDataMessage: %v", err)
+	}
+	rejected := events.waitFor(t, EventRejected, time.Second)
+	if !errors.As(rejected.Err, &rejectErr) || rejectErr.Reason != RejectReasonTransactionNotOpen {
+		t.Fatalf("unexpected unsolicited reject %v", rejected.Err)
+	}
+}
@@ -1,7 +1,10 @@
 package hsms
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
 )
@@ -152,3 +155,62 @@ func TestBuildS9F13(t *testing.T) {
 		t.Errorf("Expected ListNode body for S9F13, got %T", body)
 	}
 }
+
+func TestOversizedMessageGetsS9F11(t *testing.T) {
+	errs := make(chan *S9ErrorInfo, 1)
+	_, active := newTransportPair(t, NewMemoryTransport(), "equipment", 5000, func(p *HsmsProtocol) {
+		p.SetMaxMessageSize(200)
+		if p.active {
+			p.OnS9Error = func(info *S9ErrorInfo) { errs <- info }
+		}
+	})
+
+	big := ast.NewDataMessage("", 6, 11, 0, "H->E", ast.NewASCIINode(strings.Repeat("x", 500)))
+	if err := active.SendDataMessage(big); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case info := <-errs:
+		if info.ErrorCode != S9F11DataTooLong {
+			t.Fatalf("expected S9F11, got S9F%d", info.ErrorCode)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no S9F11 received")
+	}
+
+	// The connection survives the skipped message.
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("S1F1 after oversized message: %v", err)
+	}
+}
+
+func TestMalformedMessageGetsS9F7(t *testing.T) {
+	errs := make(chan *S9ErrorInfo, 1)
+	_, active := newTransportPair(t, NewMemoryTransport(), "equipment", 5000, func(p *HsmsProtocol) {
+		if p.active {
+			p.OnS9Error = func(info *S9ErrorInfo) { errs <- info }
+		}
+	})
+
+	// S6F11 whose list claims 200 items but carries one U4.
+	frame := []byte{0, 0, 0, 18, 0, 0, 6, 11, 0, 0, 0xCA, 0xFE, 0x00, 0x01, 0o001, 200, 0o261, 4, 0, 0, 0, 1}
+	if err := active.hsmsConnection.Send(frame); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case info := <-errs:
+		if info.ErrorCode != S9F7IllegalData {
+			t.Fatalf("expected S9F7, got S9F%d", info.ErrorCode)
+		}
+		if !bytes.Equal(info.SystemBytes, []byte{0xCA, 0xFE, 0x00, 0x01}) {
+			t.Fatalf("S9F7 system bytes = %X, want CAFE0001", info.SystemBytes)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no S9F7 received")
+	}
+
+	// The connection survives the malformed message.
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("S1F1 after malformed message: %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+package hsms
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	link "github.com/younglifestyle/secs4go"
+	"github.com/younglifestyle/secs4go/common"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/parser/hsms"
+)
+
+var (
+	// ErrServerRunning is returned when the routing table is changed in a way
+	// that requires the server to be stopped.
+	ErrServerRunning = errors.New("hsms: server already running")
+	// ErrSessionExists is returned when a session ID or remote host is already routed.
+	ErrSessionExists = errors.New("hsms: session already registered")
+)
+
+// Server accepts many HSMS connections on one passive port. Each connection is
+// handed to the passive HsmsProtocol registered for its remote host, or else
+// for the session ID of its first Select.req.
+type Server struct {
+	address  string
+	port     int
+	timeouts *SecsTimeout
+	logger   common.Logger
+
+	mu        sync.RWMutex
+	bySession map[uint16]*HsmsProtocol
+	byHost    map[string]*HsmsProtocol
+	server    *link.Server
+
+	transport       Transport
+	readBufferSize  int
+	writeBufferSize int
+	maxMessageSize  int
+	lazyDecoding    bool
+	tlsConfig       *tls.Config
+	peerVerifier    PeerVerifier
+	access          *accessFilter
+}
+
+// NewServer creates a server that listens on address:port once started.
+func NewServer(address string, port int) *Server {
+	return &Server{
+		address:   address,
+		port:      port,
+		timeouts:  NewSecsTimeout(),
+		logger:    common.NopLogger(),
+		bySession: make(map[uint16]*HsmsProtocol),
+		byHost:    make(map[string]*HsmsProtocol),
+
+		readBufferSize:  DefaultBufferSize,
+		writeBufferSize: DefaultBufferSize,
+		maxMessageSize:  DefaultMaxMessageSize,
+		access:          newAccessFilter(),
+	}
+}
+
+// SetLogger replaces the logger used for accept and routing events.
+// If logger is nil, a silent NopLogger is used.
+func (s *Server) SetLogger(logger common.Logger) {
+	if logger == nil {
+		logger = common.NopLogger()
+	}
+	s.logger = logger
+}
+
+// Timeouts returns the server timeouts. T7 bounds how long an unrouted
+// connection may stay open without sending Select.req.
+func (s *Server) Timeouts() *SecsTimeout {
+	return s.timeouts
+}
+
+// NewSession creates a passive HsmsProtocol routed by sessionID.
+func (s *Server) NewSession(sessionID int, name string) (*HsmsProtocol, error) {
+	p := NewHsmsProtocol(s.address, s.port, false, sessionID, name)
+	if err := s.AddSession(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// AddSession routes connections to the passive protocol p. With no remote
+// hosts, p receives connections whose Select.req carries its session ID.
+// Otherwise p receives every connection from the listed hosts (IP addresses).
+// Register sessions before enabling them.
+func (s *Server) AddSession(p *HsmsProtocol, remoteHosts ...string) error {
+	if p == nil {
+		return errors.New("hsms: nil protocol")
+	}
+	if p.active {
+		return errors.New("hsms: only passive protocols can be served")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if router := p.router.Load(); router != nil && router != s {
+		return errors.New("hsms: protocol already attached to another server")
+	}
+	if len(remoteHosts) == 0 {
+		key := uint16(p.sessionID)
+		if _, exists := s.bySession[key]; exists {
+			return fmt.Errorf("%w: session %d", ErrSessionExists, key)
+		}
+		s.bySession[key] = p
+	} else {
+		for _, host := range remoteHosts {
+			if _, exists := s.byHost[host]; exists {
+				return fmt.Errorf("%w: host %s", ErrSessionExists, host)
+			}
+		}
+		for _, host := range remoteHosts {
+			s.byHost[host] = p
+		}
+	}
+	p.router.Store(s)
+	return nil
+}
+
+// RemoveSession drops every route to p. Its current connection, if any, is not closed.
+func (s *Server) RemoveSession(p *HsmsProtocol) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, candidate := range s.bySession {
+		if candidate == p {
+			delete(s.bySession, key)
+		}
+	}
+	for host, candidate := range s.byHost {
+		if candidate == p {
+			delete(s.byHost, host)
+		}
+	}
+	p.router.CompareAndSwap(s, nil)
+}
+
+// SetTransport replaces the transport the server listens on. A nil transport
+// restores TCP. Call it before Start.
+func (s *Server) SetTransport(transport Transport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transport = transport
+}
+
+// SetBufferSizes sets the read and write buffer sizes of accepted
+// connections. Call it before Start.
+func (s *Server) SetBufferSizes(readSize, writeSize int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readBufferSize = readSize
+	s.writeBufferSize = writeSize
+}
+
+// SetMaxMessageSize limits the length of messages received on the server's
+// connections, see HsmsProtocol.SetMaxMessageSize. Call it before Start.
+func (s *Server) SetMaxMessageSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxMessageSize = size
+}
+
+// SetLazyDecoding makes data messages received on the server's connections
+// carry an ast.LazyItem, see HsmsProtocol.SetLazyDecoding. Call it before Start.
+func (s *Server) SetLazyDecoding(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lazyDecoding = enabled
+}
+
+// SetTLSConfig makes the server accept HSMS over TLS with cfg as server
+// configuration. A nil cfg switches back to plain TCP. Call it before Start;
+// the TLS settings of the routed protocols are not used.
+func (s *Server) SetTLSConfig(cfg *tls.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsConfig = cfg
+}
+
+// SetPeerVerifier installs an identity check on client certificates, e.g.
+// PeerNames. Call it before Start.
+func (s *Server) SetPeerVerifier(verify PeerVerifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peerVerifier = verify
+}
+
+// Start opens the listener and accepts connections in the background.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		return ErrServerRunning
+	}
+	server, err := connector{
+		transport:   s.transport,
+		tlsConfig:   withPeerVerifier(s.tlsConfig, s.peerVerifier),
+		readBuffer:  s.readBufferSize,
+		writeBuffer: s.writeBufferSize,
+		maxMessage:  s.maxMessageSize,
+		lazy:        s.lazyDecoding,
+		access:      s.access,
+		logger:      s.logger,
+	}.listen(s.address, s.port, link.HandlerFunc(s.handleSession))
+	if err != nil {
+		return err
+	}
+	s.server = server
+
+	go func() {
+		if err := server.Serve(); err != nil {
+			s.logger.Info("server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listener and every connection accepted by the server.
+// Registered protocols stay enabled and are served again after the next Start.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	server := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if server != nil {
+		server.Stop()
+	}
+}
+
+// Addr returns the listener address, or nil when the server is not running.
+func (s *Server) Addr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Listener().Addr()
+}
+
+func (s *Server) handleSession(session *link.Session) {
+	remote := remoteHost(session)
+
+	s.mu.RLock()
+	p := s.byHost[remote]
+	s.mu.RUnlock()
+
+	if p != nil {
+		s.logger.Info("routing connection by remote host", "remote", remote, "name", p.name)
+		s.dispatch(p, session, nil)
+		return
+	}
+
+	selectReq, err := s.awaitSelect(session)
+	if err != nil {
+		s.logger.Warn("connection closed before select", "remote", remote, "error", err)
+		_ = session.Close()
+		return
+	}
+
+	ctrl := selectReq.(*ast.ControlMessage)
+	s.mu.RLock()
+	p = s.bySession[ctrl.SessionID()]
+	s.mu.RUnlock()
+
+	if p == nil {
+		s.logger.Warn("select.req for unknown session", "remote", remote, "session", ctrl.SessionID())
+		s.refuse(session, selectReq, ControlStatusEntityUnknown)
+		return
+	}
+	s.logger.Info("routing connection by session", "remote", remote, "session", ctrl.SessionID(), "name", p.name)
+	s.dispatch(p, session, selectReq)
+}
+
+// dispatch hands session to p unless p is disabled or already owns a live connection.
+func (s *Server) dispatch(p *HsmsProtocol, session *link.Session, selectReq ast.HSMSMessage) {
+	s.mu.Lock()
+	status := ControlStatusAccepted
+	if !p.enabled.Load() {
+		status = ControlStatusNotReady
+	} else if current := p.hsmsConnection.Session(); current != nil && !current.IsClosed() {
+		// serveSession closes the current connection for ConnectionPolicyReplace.
+		if p.getConnectionPolicy() != ConnectionPolicyReplace {
+			status = ControlStatusDenied
+		}
+	} else {
+		p.hsmsConnection.SetSession(session)
+	}
+	s.mu.Unlock()
+
+	if status != ControlStatusAccepted {
+		s.logger.Warn("connection refused", "name", p.name, "status", status)
+		s.refuse(session, selectReq, status)
+		if status == ControlStatusDenied {
+			p.access.busy.Inc()
+			p.refuseConnection(session.RemoteAddr(), ErrConnectionBusy)
+		}
+		return
+	}
+	p.serveSession(session, selectReq)
+}
+
+// refuse answers selectReq, when present, with status and closes the session.
+func (s *Server) refuse(session *link.Session, selectReq ast.HSMSMessage, status ControlStatus) {
+	if selectReq != nil {
+		rsp := ast.NewHSMSMessageSelectRsp(selectReq, byte(status))
+		if err := session.Send(rsp); err != nil {
+			s.logger.Error("send select.rsp failed", "error", err)
+		}
+	}
+	_ = session.Close()
+}
+
+// awaitSelect reads control messages until a Select.req arrives or T7 expires.
+// Linktest.req is answered; any other message is rejected as not selected.
+func (s *Server) awaitSelect(session *link.Session) (ast.HSMSMessage, error) {
+	deadline := time.Now().Add(time.Duration(s.timeouts.T7NotSelectTimeout()) * time.Second)
+	dc, ok := session.Codec().(link.DeadlineCodec)
+	if ok {
+		defer dc.SetReadDeadline(time.Time{})
+	}
+
+	for {
+		if ok {
+			if err := dc.SetReadDeadline(deadline); err != nil {
+				return nil, err
+			}
+		}
+		rsp, err := session.Receive()
+		if err != nil {
+			return nil, err
+		}
+		message := rsp.(ast.HSMSMessage)
+
+		switch message.Type() {
+		case hsms.SelectReqStr:
+			if _, isCtrl := message.(*ast.ControlMessage); isCtrl {
+				return message, nil
+			}
+		case hsms.LinktestReqStr:
+			if err := session.Send(ast.NewHSMSMessageLinktestRsp(message)); err != nil {
+				return nil, err
+			}
+			continue
+		case hsms.SeparateReqStr:
+			return nil, errors.New("separate.req received")
+		}
+
+		reject := ast.NewHSMSMessageRejectReqFromMsg(message, byte(RejectReasonEntityNotSelected))
+		if err := session.Send(reject); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func remoteHost(session *link.Session) string {
+	addr := session.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
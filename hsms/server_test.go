@@ -0,0 +1,110 @@
+package hsms
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func waitForState(t *testing.T, p *HsmsProtocol, state string, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if p.CurrentState() == state {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s: expected state %s, got %s", p.name, state, p.CurrentState())
+}
+
+func startTestServer(t *testing.T) (*Server, int) {
+	t.Helper()
+	server := NewServer("127.0.0.1", 0)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(server.Stop)
+	return server, server.Addr().(*net.TCPAddr).Port
+}
+
+func newTestActive(t *testing.T, port, sessionID int, name string) *HsmsProtocol {
+	t.Helper()
+	p := NewHsmsProtocol("127.0.0.1", port, true, sessionID, name)
+	p.Timeouts().SetLinktest(60)
+	p.Timeouts().SetAutoReconnect(false)
+	p.Enable()
+	t.Cleanup(p.Disable)
+	return p
+}
+
+func TestServerRoutesBySessionID(t *testing.T) {
+	server, port := startTestServer(t)
+
+	for _, sessionID := range []int{1, 2} {
+		passive, err := server.NewSession(sessionID, "passive")
+		if err != nil {
+			t.Fatalf("NewSession(%d): %v", sessionID, err)
+		}
+		passive.Timeouts().SetLinktest(60)
+		id := sessionID
+		passive.RegisterHandler(1, 1, func(msg *ast.DataMessage) (*ast.DataMessage, error) {
+			return ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewUintNode(4, uint64(id))), nil
+		})
+		passive.Enable()
+		t.Cleanup(passive.Disable)
+	}
+	if _, err := server.NewSession(1, "duplicate"); err == nil {
+		t.Fatal("expected duplicate session error")
+	}
+
+	first := newTestActive(t, port, 1, "tool-1")
+	second := newTestActive(t, port, 2, "tool-2")
+	waitForState(t, first, StateConnectedSelected, 3*time.Second)
+	waitForState(t, second, StateConnectedSelected, 3*time.Second)
+
+	for want, p := range map[uint64]*HsmsProtocol{1: first, 2: second} {
+		reply, err := p.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+		if err != nil {
+			t.Fatalf("%s: SendAndWait: %v", p.name, err)
+		}
+		item, _ := reply.Get()
+		if got := item.Values().([]uint64)[0]; got != want {
+			t.Fatalf("%s: routed to session %d, want %d", p.name, got, want)
+		}
+	}
+
+	unknown := newTestActive(t, port, 3, "tool-3")
+	time.Sleep(300 * time.Millisecond)
+	if unknown.CurrentState() == StateConnectedSelected {
+		t.Fatal("unknown session should not be selected")
+	}
+}
+
+func TestServerRoutesByRemoteHost(t *testing.T) {
+	server, port := startTestServer(t)
+
+	passive := NewHsmsProtocol("127.0.0.1", 0, false, 7, "by-host")
+	passive.Timeouts().SetLinktest(60)
+	if err := server.AddSession(passive, "127.0.0.1"); err != nil {
+		t.Fatalf("AddSession: %v", err)
+	}
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 7, "tool")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+	waitForState(t, passive, StateConnectedSelected, 3*time.Second)
+
+	// A second connection from the same host is refused while the first is alive.
+	extra := newTestActive(t, port, 7, "extra")
+	time.Sleep(300 * time.Millisecond)
+	if extra.CurrentState() == StateConnectedSelected {
+		t.Fatal("second connection should be refused")
+	}
+	if active.CurrentState() != StateConnectedSelected {
+		t.Fatal("first connection should stay selected")
+	}
+}
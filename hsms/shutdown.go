@@ -0,0 +1,87 @@
+package hsms
+
+import (
+	"context"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// Deselect sends Deselect.req and waits for Deselect.rsp until ctx is done or
+// T6 expires. On success the connection stays open in NOT-SELECTED state.
+func (p *HsmsProtocol) Deselect(ctx context.Context) error {
+	if err := p.ensureReady(true); err != nil {
+		return err
+	}
+	return p.hsmsConnection.sendDeselectReq(ctx)
+}
+
+// Separate sends Separate.req and closes the connection. The protocol stays
+// enabled: an active protocol connects again after T5 and a passive one keeps
+// listening. Use Disable to stop for good.
+func (p *HsmsProtocol) Separate() error {
+	if err := p.ensureReady(false); err != nil {
+		return err
+	}
+
+	request := ast.NewHSMSMessageSeparateReq(uint16(p.sessionID), p.encodeSystemID(p.getNextSystemCounter()))
+	p.logControlMessage("TX", request)
+	if err := p.hsmsConnection.Send(request); err != nil {
+		return err
+	}
+	p.publish(ConnectionEvent{Type: EventSeparated})
+
+	p.setDisconnectReason(DisconnectReasonSeparate, nil)
+	p.connected.Store(false)
+	p.stopLinktestTimer()
+	return p.hsmsConnection.Close()
+}
+
+// Drain waits until no SendAndWait, SendAsync or control request is waiting
+// for its reply, or until ctx is done. Stop issuing new requests first;
+// Disable does so before it drains.
+func (p *HsmsProtocol) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		p.queueMu.RLock()
+		pending := len(p.systemQueues) + len(p.transactions)
+		p.queueMu.RUnlock()
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeGracefully ends an established connection the way the peer expects:
+// pending requests are drained for up to T3, a selected link is deselected
+// (T6), and Separate.req is sent before the socket is closed. Waiting stops
+// early when ctx is done. The connection of a general session is left to its
+// entities.
+func (p *HsmsProtocol) closeGracefully(ctx context.Context) {
+	if p.sessionTable != nil || !p.connected.Load() || p.hsmsConnection.Session() == nil {
+		return
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, time.Duration(p.timeouts.T3ReplyTimeout())*time.Second)
+	if err := p.Drain(drainCtx); err != nil {
+		p.logger.Warn("closing with requests still pending", "error", err)
+	}
+	cancel()
+
+	if p.connectionState.CurrentState() == StateConnectedSelected && ctx.Err() == nil {
+		if err := p.Deselect(ctx); err != nil {
+			p.logger.Warn("deselect failed", "error", err)
+		}
+	}
+	if err := p.Separate(); err != nil {
+		p.logger.Warn("separate failed", "error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package hsms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func TestDeselectKeepsConnection(t *testing.T) {
+	server, port := startTestServer(t)
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	if err := active.Deselect(context.Background()); err != nil {
+		t.Fatalf("Deselect: %v", err)
+	}
+	if state := active.CurrentState(); state != StateConnectedNotSelected {
+		t.Fatalf("expected NOT-SELECTED after Deselect, got %s", state)
+	}
+	waitForState(t, passive, StateConnectedNotSelected, time.Second)
+	if err := active.Deselect(context.Background()); err != ErrNotSelected {
+		t.Fatalf("expected ErrNotSelected, got %v", err)
+	}
+}
+
+func TestDisableDrainsAndSeparates(t *testing.T) {
+	server, port := startTestServer(t)
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.RegisterHandler(1, 3, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		time.Sleep(300 * time.Millisecond)
+		return ast.NewDataMessage("", 1, 4, 0, "H<-E", ast.NewListNode()), nil
+	})
+	passiveEvents := &eventRecorder{}
+	passive.AddConnectionListener(passiveEvents.record)
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	tx := active.SendAsync(ast.NewDataMessage("", 1, 3, 1, "H->E", ast.NewListNode()))
+	disabled := make(chan struct{})
+	go func() {
+		active.Disable()
+		close(disabled)
+	}()
+
+	// New requests are refused while the transaction drains.
+	time.Sleep(50 * time.Millisecond)
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); !errors.Is(err, ErrDisabling) {
+		t.Fatalf("expected ErrDisabling during drain, got %v", err)
+	}
+	<-disabled
+
+	if _, err := tx.Wait(); err != nil {
+		t.Fatalf("in-flight transaction was not drained: %v", err)
+	}
+
+	disconnected := passiveEvents.waitFor(t, EventDisconnected, 3*time.Second)
+	if disconnected.Reason != DisconnectReasonSeparate {
+		t.Fatalf("expected separate.req reason, got %s", disconnected.Reason)
+	}
+	want := []ConnectionEventType{EventConnected, EventSelected, EventDeselected, EventSeparated, EventDisconnected}
+	if got := passiveEvents.types(); !equalEventTypes(got, want) {
+		t.Fatalf("passive events %v, want %v", got, want)
+	}
+}
+
+func TestDisableContextBoundsDrain(t *testing.T) {
+	server, port := startTestServer(t)
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	release := make(chan struct{})
+	passive.RegisterHandler(1, 3, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		<-release
+		return ast.NewDataMessage("", 1, 4, 0, "H<-E", ast.NewListNode()), nil
+	})
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	active.SendAsync(ast.NewDataMessage("", 1, 3, 1, "H->E", ast.NewListNode()))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	active.DisableContext(ctx)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("DisableContext took %v, expected it to stop with ctx", elapsed)
+	}
+	close(release)
+	waitForState(t, active, StateNotConnected, time.Second)
+	waitForState(t, passive, StateNotConnected, time.Second)
+}
+
+func TestSeparateKeepsProtocolEnabled(t *testing.T) {
+	server, port := startTestServer(t)
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := NewHsmsProtocol("127.0.0.1", port, true, 1, "active")
+	active.Timeouts().SetLinktest(60)
+	active.Timeouts().SetT5ConnSeparateTimeout(1)
+	active.Enable()
+	t.Cleanup(active.Disable)
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	if err := passive.Separate(); err != nil {
+		t.Fatalf("Separate: %v", err)
+	}
+	waitForState(t, active, StateNotConnected, time.Second)
+	// The active side connects again after T5.
+	waitForState(t, active, StateConnectedSelected, 5*time.Second)
+}
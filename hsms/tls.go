@@ -0,0 +1,174 @@
+package hsms
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPeerNotAllowed is returned by a PeerVerifier that refuses the peer certificate.
+	ErrPeerNotAllowed = errors.New("hsms: peer certificate not allowed")
+	// ErrNoPeerCertificate is returned when a peer verifier is set but the peer
+	// presented no certificate.
+	ErrNoPeerCertificate = errors.New("hsms: peer presented no certificate")
+)
+
+// PeerVerifier checks the identity of the peer once its certificate chain has
+// been verified. Returning an error aborts the TLS handshake.
+type PeerVerifier func(cert *x509.Certificate) error
+
+// PeerNames returns a PeerVerifier accepting peers whose certificate carries
+// one of names as subject common name or DNS subject alternative name.
+func PeerNames(names ...string) PeerVerifier {
+	allowed := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		allowed[name] = struct{}{}
+	}
+	return func(cert *x509.Certificate) error {
+		if _, ok := allowed[cert.Subject.CommonName]; ok {
+			return nil
+		}
+		for _, name := range cert.DNSNames {
+			if _, ok := allowed[name]; ok {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %q", ErrPeerNotAllowed, cert.Subject.CommonName)
+	}
+}
+
+// SetTLSConfig runs HSMS over TLS. An active protocol uses cfg as client
+// configuration, a passive one as server configuration; set ClientAuth to
+// tls.RequireAndVerifyClientCert for mutual authentication. A nil cfg
+// switches back to plain TCP. The change applies from the next connection.
+//
+// Session entities of a general session use the connection of the carrier,
+// so configure TLS on GeneralSession.Protocol().
+func (p *HsmsProtocol) SetTLSConfig(cfg *tls.Config) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.tlsConfig = cfg
+}
+
+// SetPeerVerifier installs an additional identity check on the peer
+// certificate, e.g. PeerNames. It only takes effect together with SetTLSConfig.
+func (p *HsmsProtocol) SetPeerVerifier(verify PeerVerifier) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.peerVerifier = verify
+}
+
+// withPeerVerifier returns a copy of cfg that also runs verify on the leaf
+// certificate of the peer.
+func withPeerVerifier(cfg *tls.Config, verify PeerVerifier) *tls.Config {
+	if cfg == nil || verify == nil {
+		return cfg
+	}
+	cfg = cfg.Clone()
+	next := cfg.VerifyConnection
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		if next != nil {
+			if err := next(state); err != nil {
+				return err
+			}
+		}
+		if len(state.PeerCertificates) == 0 {
+			return ErrNoPeerCertificate
+		}
+		return verify(state.PeerCertificates[0])
+	}
+	return cfg
+}
+
+// CertificateReloader serves a certificate and key from files and loads them
+// again when either file changes, so certificates can be rotated without
+// restarting the protocol. Plug GetCertificate (server) or
+// GetClientCertificate (client) into a tls.Config. The files are checked on
+// every handshake; established connections keep their certificate.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certStat fileStamp
+	keyStat  fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertificateReloader loads certFile and keyFile, which must be PEM encoded.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files now. On error the previous certificate stays in use.
+func (r *CertificateReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+func (r *CertificateReloader) load() error {
+	certStat, err := stampFile(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyStat, err := stampFile(r.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("hsms: load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certStat = certStat
+	r.keyStat = keyStat
+	return nil
+}
+
+// current returns the certificate, reloading it first if a file has changed.
+func (r *CertificateReloader) current() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certStat, certErr := stampFile(r.certFile)
+	keyStat, keyErr := stampFile(r.keyFile)
+	if certErr == nil && keyErr == nil && (certStat != r.certStat || keyStat != r.keyStat) {
+		// A half-written pair fails to load; keep serving the old one until
+		// both files are consistent.
+		_ = r.load()
+	}
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+func stampFile(name string) (fileStamp, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
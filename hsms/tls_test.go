@@ -0,0 +1,234 @@
+package hsms
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns PEM encoded certificate and key for name, valid for loopback.
+func (ca *testCA) issue(t *testing.T, name string, serial int64) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) keyPair(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, name, 2)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("load key pair: %v", err)
+	}
+	return cert
+}
+
+func (ca *testCA) serverConfig(t *testing.T, name string) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{ca.keyPair(t, name)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func (ca *testCA) clientConfig(t *testing.T, name string) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{ca.keyPair(t, name)},
+		RootCAs:      ca.pool,
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	port := freePort(t)
+
+	passive := NewHsmsProtocol("127.0.0.1", port, false, 1, "equipment")
+	passive.Timeouts().SetLinktest(60)
+	passive.SetTLSConfig(ca.serverConfig(t, "equipment"))
+	passive.SetPeerVerifier(PeerNames("host"))
+	passive.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewEmptyItemNode()), nil
+	})
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+	waitForListening(t, passive)
+
+	active := NewHsmsProtocol("127.0.0.1", port, true, 1, "host")
+	active.Timeouts().SetLinktest(60)
+	active.Timeouts().SetAutoReconnect(false)
+	active.SetTLSConfig(ca.clientConfig(t, "host"))
+	active.SetPeerVerifier(PeerNames("equipment"))
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("S1F1 over TLS: %v", err)
+	}
+}
+
+func TestTLSRejectsUnknownPeer(t *testing.T) {
+	ca := newTestCA(t)
+	port := freePort(t)
+	server := NewServer("127.0.0.1", port)
+	server.SetTLSConfig(ca.serverConfig(t, "equipment"))
+	server.SetPeerVerifier(PeerNames("host"))
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	passive, err := server.NewSession(1, "equipment")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	newActive := func(name string, cfg *tls.Config) *HsmsProtocol {
+		p := NewHsmsProtocol("127.0.0.1", port, true, 1, name)
+		p.Timeouts().SetLinktest(60)
+		p.Timeouts().SetAutoReconnect(false)
+		p.SetTLSConfig(cfg)
+		p.Enable()
+		t.Cleanup(p.Disable)
+		return p
+	}
+
+	intruder := newActive("intruder", ca.clientConfig(t, "intruder"))
+	// A plain TCP client never completes the handshake either.
+	plain := newActive("plain", nil)
+
+	time.Sleep(time.Second)
+	for _, p := range []*HsmsProtocol{passive, intruder, plain} {
+		if state := p.CurrentState(); state == StateConnectedSelected {
+			t.Fatalf("%s: unexpected selected state", p.name)
+		}
+	}
+
+	newActive("host", ca.clientConfig(t, "host"))
+	waitForState(t, passive, StateConnectedSelected, 3*time.Second)
+}
+
+func TestCertificateReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	write := func(certPEM, keyPEM []byte, modTime time.Time) {
+		t.Helper()
+		for name, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+			if err := os.WriteFile(name, data, 0o600); err != nil {
+				t.Fatalf("write %s: %v", name, err)
+			}
+			if err := os.Chtimes(name, modTime, modTime); err != nil {
+				t.Fatalf("chtimes %s: %v", name, err)
+			}
+		}
+	}
+	serial := func(r *CertificateReloader) int64 {
+		t.Helper()
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("parse certificate: %v", err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+
+	now := time.Now()
+	certPEM, keyPEM := ca.issue(t, "equipment", 10)
+	write(certPEM, keyPEM, now)
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader: %v", err)
+	}
+	if got := serial(reloader); got != 10 {
+		t.Fatalf("expected serial 10, got %d", got)
+	}
+
+	certPEM, keyPEM = ca.issue(t, "equipment", 11)
+	write(certPEM, keyPEM, now.Add(time.Minute))
+	if got := serial(reloader); got != 11 {
+		t.Fatalf("expected rotated serial 11, got %d", got)
+	}
+
+	// A broken pair keeps the last good certificate.
+	write([]byte("garbage"), keyPEM, now.Add(2*time.Minute))
+	if got := serial(reloader); got != 11 {
+		t.Fatalf("expected serial 11 after failed reload, got %d", got)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected Reload to report the broken certificate")
+	}
+}
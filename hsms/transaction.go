@@ -0,0 +1,301 @@
+package hsms
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/utils"
+)
+
+// Transaction tracks one asynchronous request started with SendAsync.
+type Transaction struct {
+	request  *ast.DataMessage
+	systemID uint32
+	done     chan struct{}
+
+	mu        sync.Mutex
+	finished  bool
+	reply     *ast.DataMessage
+	err       error
+	callbacks []func(*Transaction)
+}
+
+func newTransaction(request *ast.DataMessage, systemID uint32) *Transaction {
+	return &Transaction{
+		request:  request,
+		systemID: systemID,
+		done:     make(chan struct{}),
+	}
+}
+
+// Request returns the message as it was sent, including session ID and system bytes.
+func (t *Transaction) Request() *ast.DataMessage {
+	return t.request
+}
+
+// Done returns a channel that is closed once the transaction has completed.
+func (t *Transaction) Done() <-chan struct{} {
+	return t.done
+}
+
+// Reply returns the received reply, or nil while pending, on error, or when no
+// reply was expected.
+func (t *Transaction) Reply() *ast.DataMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reply
+}
+
+// Err returns the transaction error, or nil while pending or on success.
+func (t *Transaction) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Wait blocks until the transaction completes and returns its outcome.
+func (t *Transaction) Wait() (*ast.DataMessage, error) {
+	<-t.done
+	return t.Reply(), t.Err()
+}
+
+// OnComplete registers fn to run once the transaction completes. If it has
+// already completed, fn runs immediately. Callbacks run on the goroutine that
+// completes the transaction (usually the receive loop) and must not block.
+func (t *Transaction) OnComplete(fn func(*Transaction)) {
+	if fn == nil {
+		return
+	}
+	t.mu.Lock()
+	if !t.finished {
+		t.callbacks = append(t.callbacks, fn)
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	fn(t)
+}
+
+// complete records the outcome. Only the first call has any effect.
+func (t *Transaction) complete(reply *ast.DataMessage, err error) bool {
+	t.mu.Lock()
+	if t.finished {
+		t.mu.Unlock()
+		return false
+	}
+	t.finished = true
+	t.reply = reply
+	t.err = err
+	callbacks := t.callbacks
+	t.callbacks = nil
+	close(t.done)
+	t.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(t)
+	}
+	return true
+}
+
+func (t *Transaction) isFinished() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finished
+}
+
+// SendAsync sends a SECS-II data message and returns immediately. The reply is
+// delivered through the returned Transaction, which fails with ErrT3Timeout
+// when no reply arrives within T3, or with ErrNotConnected when the connection
+// is lost first. Messages sent without the wait bit complete
+// as soon as they are written.
+func (p *HsmsProtocol) SendAsync(message *ast.DataMessage) *Transaction {
+	if message == nil {
+		tx := newTransaction(nil, 0)
+		tx.complete(nil, errors.New("hsms: nil message"))
+		return tx
+	}
+
+	systemID := p.getNextSystemCounter()
+	outgoing := message.SetSessionIDAndSystemBytes(p.sessionID, p.encodeSystemID(systemID))
+	if outgoing.WaitBit() == "optional" {
+		outgoing = outgoing.SetWaitBit(true)
+	}
+	tx := newTransaction(outgoing, systemID)
+
+	if err := p.ensureAccepting(); err != nil {
+		tx.complete(nil, err)
+		return tx
+	}
+
+	outgoing, local, err := p.interceptOutbound(outgoing, nil)
+	if err != nil || local != nil {
+		tx.complete(local, err)
+		return tx
+	}
+	tx.request = outgoing
+
+	expectReply := outgoing.WaitBit() == "true"
+	if expectReply {
+		p.queueMu.Lock()
+		p.transactions[systemID] = tx
+		p.queueMu.Unlock()
+	}
+
+	p.logDataMessage("OUT", outgoing)
+
+	if err := p.hsmsConnection.Send(outgoing); err != nil {
+		p.removeTransaction(systemID)
+		tx.complete(nil, err)
+		return tx
+	}
+	if !expectReply {
+		tx.complete(nil, nil)
+		return tx
+	}
+
+	p.wheel.add(time.Duration(p.timeouts.T3ReplyTimeout())*time.Second, tx, func() {
+		if p.removeTransaction(systemID) && tx.complete(nil, ErrT3Timeout) {
+			p.sendS9F9TransactionTimeout(outgoing)
+		}
+	})
+	return tx
+}
+
+// resolveTransaction completes the pending transaction matching the reply's
+// system bytes. It reports false when no transaction is waiting for it.
+func (p *HsmsProtocol) resolveTransaction(reply *ast.DataMessage) bool {
+	systemID := binary.BigEndian.Uint32(reply.SystemBytes())
+
+	p.queueMu.Lock()
+	tx, ok := p.transactions[systemID]
+	delete(p.transactions, systemID)
+	p.queueMu.Unlock()
+
+	if !ok {
+		return false
+	}
+	tx.complete(p.interceptReply(reply, tx.request))
+	return true
+}
+
+func (p *HsmsProtocol) removeTransaction(systemID uint32) bool {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	if _, ok := p.transactions[systemID]; !ok {
+		return false
+	}
+	delete(p.transactions, systemID)
+	return true
+}
+
+// failTransactions fails every request still waiting for a reply with err.
+// It runs when the connection is lost, so no S9F9 is sent for them.
+func (p *HsmsProtocol) failTransactions(err error) {
+	p.queueMu.Lock()
+	pending := p.transactions
+	p.transactions = make(map[uint32]*Transaction)
+	queues := make([]*utils.Deque, 0, len(p.systemQueues))
+	for _, queue := range p.systemQueues {
+		queues = append(queues, queue)
+	}
+	p.queueMu.Unlock()
+
+	for _, tx := range pending {
+		tx.complete(nil, err)
+	}
+	for _, queue := range queues {
+		queue.Put(err)
+	}
+}
+
+const (
+	wheelTick  = 100 * time.Millisecond
+	wheelSlots = 512
+)
+
+type wheelEntry struct {
+	rounds int
+	tx     *Transaction
+	expire func()
+}
+
+// timerWheel enforces reply timeouts for all pending transactions of a
+// protocol with a single goroutine, which only runs while entries are pending.
+type timerWheel struct {
+	mu      sync.Mutex
+	slots   [wheelSlots][]wheelEntry
+	pos     int
+	count   int
+	running bool
+}
+
+func (w *timerWheel) add(timeout time.Duration, tx *Transaction, expire func()) {
+	ticks := int((timeout + wheelTick - 1) / wheelTick)
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	w.mu.Lock()
+	slot := (w.pos + ticks) % wheelSlots
+	w.slots[slot] = append(w.slots[slot], wheelEntry{
+		rounds: (ticks - 1) / wheelSlots,
+		tx:     tx,
+		expire: expire,
+	})
+	w.count++
+	start := !w.running
+	w.running = true
+	w.mu.Unlock()
+
+	if start {
+		go w.run()
+	}
+}
+
+func (w *timerWheel) run() {
+	ticker := time.NewTicker(wheelTick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, idle := w.advance()
+		for _, entry := range expired {
+			entry.expire()
+		}
+		if idle {
+			return
+		}
+	}
+}
+
+// advance moves the wheel one slot and returns the entries that expired. idle
+// is true when nothing is left and the goroutine has been released.
+func (w *timerWheel) advance() (expired []wheelEntry, idle bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pos = (w.pos + 1) % wheelSlots
+	slot := w.slots[w.pos]
+	kept := slot[:0]
+	for _, entry := range slot {
+		switch {
+		case entry.tx.isFinished():
+			w.count--
+		case entry.rounds > 0:
+			entry.rounds--
+			kept = append(kept, entry)
+		default:
+			expired = append(expired, entry)
+			w.count--
+		}
+	}
+	w.slots[w.pos] = kept
+
+	if w.count == 0 {
+		w.running = false
+		return expired, true
+	}
+	return expired, false
+}
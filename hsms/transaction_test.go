@@ -0,0 +1,129 @@
+package hsms
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func TestSendAsync(t *testing.T) {
+	server, port := startTestServer(t)
+
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	passive.Timeouts().SetLinktest(60)
+	passive.RegisterHandler(1, 3, func(msg *ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 4, 0, "H<-E", ast.NewUintNode(4, 42)), nil
+	})
+	passive.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return nil, nil
+	})
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	active.Timeouts().SetT3ReplyTimeout(1)
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	const count = 200
+	var callbacks atomic.Int32
+	pending := make([]*Transaction, 0, count)
+	for i := 0; i < count; i++ {
+		tx := active.SendAsync(ast.NewDataMessage("", 1, 3, 1, "H->E", ast.NewListNode()))
+		tx.OnComplete(func(*Transaction) { callbacks.Add(1) })
+		pending = append(pending, tx)
+	}
+	for _, tx := range pending {
+		select {
+		case <-tx.Done():
+		case <-time.After(3 * time.Second):
+			t.Fatal("transaction did not complete")
+		}
+		if tx.Err() != nil {
+			t.Fatalf("unexpected error: %v", tx.Err())
+		}
+		if tx.Reply() == nil || tx.Reply().FunctionCode() != 4 {
+			t.Fatalf("unexpected reply %v", tx.Reply())
+		}
+	}
+	if got := callbacks.Load(); got != count {
+		t.Fatalf("expected %d callbacks, got %d", count, got)
+	}
+
+	start := time.Now()
+	_, err = active.SendAsync(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())).Wait()
+	if !errors.Is(err, ErrT3Timeout) {
+		t.Fatalf("expected T3 timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("T3 enforced after %v", elapsed)
+	}
+
+	noReply := active.SendAsync(ast.NewDataMessage("", 1, 1, 0, "H->E", ast.NewEmptyItemNode()))
+	select {
+	case <-noReply.Done():
+	default:
+		t.Fatal("message without wait bit should complete immediately")
+	}
+
+	active.queueMu.RLock()
+	left := len(active.transactions)
+	active.queueMu.RUnlock()
+	if left != 0 {
+		t.Fatalf("expected no pending transactions, got %d", left)
+	}
+}
+
+func TestSendAsyncFailsOnDisconnect(t *testing.T) {
+	server, port := startTestServer(t)
+
+	passive, err := server.NewSession(1, "passive")
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	passive.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		<-release
+		return nil, nil
+	})
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+
+	active := newTestActive(t, port, 1, "active")
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+
+	tx := active.SendAsync(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+	waitDone := make(chan error, 1)
+	go func() {
+		_, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+		waitDone <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if sess := passive.hsmsConnection.Session(); sess != nil {
+		_ = sess.Close()
+	}
+
+	select {
+	case <-tx.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("transaction was not failed when the connection dropped")
+	}
+	if !errors.Is(tx.Err(), ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected, got %v", tx.Err())
+	}
+	select {
+	case err := <-waitDone:
+		if !errors.Is(err, ErrNotConnected) {
+			t.Fatalf("expected ErrNotConnected from SendAndWait, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("SendAndWait was not failed when the connection dropped")
+	}
+}
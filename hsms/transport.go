@@ -0,0 +1,442 @@
+package hsms
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	link "github.com/younglifestyle/secs4go"
+	"github.com/younglifestyle/secs4go/codec"
+	"github.com/younglifestyle/secs4go/common"
+)
+
+// DefaultBufferSize is the default size of the read and write buffers of a connection.
+const DefaultBufferSize = 5 * 1024
+
+// DefaultMaxMessageSize is the default limit for received messages, see SetMaxMessageSize.
+const DefaultMaxMessageSize = 16 * 1024 * 1024
+
+var (
+	// ErrNoListener is returned by MemoryTransport.Dial when nothing listens on the address.
+	ErrNoListener = errors.New("hsms: no listener on address")
+	// ErrAddressInUse is returned by MemoryTransport.Listen when the address is taken.
+	ErrAddressInUse = errors.New("hsms: address already in use")
+)
+
+// Transport creates the connections HSMS runs over. The protocol passes its
+// configured address and port; a transport may ignore the port when its
+// addresses do not have one.
+type Transport interface {
+	Dial(ctx context.Context, address string, port int) (net.Conn, error)
+	Listen(address string, port int) (net.Listener, error)
+}
+
+// TCPTransport connects over TCP. It is the default transport.
+type TCPTransport struct {
+	Dialer net.Dialer
+}
+
+func (t *TCPTransport) Dial(ctx context.Context, address string, port int) (net.Conn, error) {
+	return t.Dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+}
+
+func (t *TCPTransport) Listen(address string, port int) (net.Listener, error) {
+	return net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+}
+
+// UnixTransport connects over a Unix domain socket. The address is the socket
+// path and the port is ignored.
+type UnixTransport struct {
+	Dialer net.Dialer
+}
+
+func (t *UnixTransport) Dial(ctx context.Context, address string, _ int) (net.Conn, error) {
+	return t.Dialer.DialContext(ctx, "unix", address)
+}
+
+func (t *UnixTransport) Listen(address string, _ int) (net.Listener, error) {
+	return net.Listen("unix", address)
+}
+
+// MemoryTransport connects protocols in the same process through buffered
+// in-memory pipes, without opening ports. Use one MemoryTransport for both sides:
+//
+//	transport := hsms.NewMemoryTransport()
+//	equipment.SetTransport(transport)
+//	host.SetTransport(transport)
+type MemoryTransport struct {
+	mu        sync.Mutex
+	listeners map[string]*memoryListener
+}
+
+// NewMemoryTransport creates an empty in-memory network.
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{listeners: make(map[string]*memoryListener)}
+}
+
+func (t *MemoryTransport) Dial(ctx context.Context, address string, port int) (net.Conn, error) {
+	key := memoryAddr(fmt.Sprintf("%s:%d", address, port))
+
+	t.mu.Lock()
+	listener, ok := t.listeners[string(key)]
+	t.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoListener, key)
+	}
+
+	client, server := newMemoryConnPair(memoryAddr("client"), key)
+	select {
+	case listener.conns <- server:
+		return client, nil
+	case <-listener.done:
+		client.Close()
+		server.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNoListener, key)
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+}
+
+func (t *MemoryTransport) Listen(address string, port int) (net.Listener, error) {
+	key := fmt.Sprintf("%s:%d", address, port)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.listeners[key]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrAddressInUse, key)
+	}
+	listener := &memoryListener{
+		transport: t,
+		addr:      memoryAddr(key),
+		conns:     make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	t.listeners[key] = listener
+	return listener, nil
+}
+
+type memoryListener struct {
+	transport *MemoryTransport
+	addr      memoryAddr
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.transport.mu.Lock()
+		delete(l.transport.listeners, string(l.addr))
+		l.transport.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// memoryPipe is one direction of a memoryConn. Writes never block, like
+// writes into a socket buffer, so both sides can send at the same time;
+// net.Pipe would deadlock two receive loops that answer each other.
+type memoryPipe struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+	// ready is signalled when data arrives, the pipe is closed or the read
+	// deadline changes.
+	ready chan struct{}
+}
+
+func newMemoryPipe() *memoryPipe {
+	return &memoryPipe{ready: make(chan struct{}, 1)}
+}
+
+func (p *memoryPipe) signal() {
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (p *memoryPipe) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.signal()
+}
+
+// memoryConn is a net.Conn over two memoryPipes with memory addresses.
+type memoryConn struct {
+	rx, tx *memoryPipe
+	local  memoryAddr
+	remote memoryAddr
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	deadlineMu   sync.Mutex
+	readDeadline time.Time
+}
+
+func newMemoryConnPair(client, server memoryAddr) (*memoryConn, *memoryConn) {
+	up, down := newMemoryPipe(), newMemoryPipe()
+	return &memoryConn{rx: down, tx: up, local: client, remote: server, done: make(chan struct{})},
+		&memoryConn{rx: up, tx: down, local: server, remote: client, done: make(chan struct{})}
+}
+
+func (c *memoryConn) Read(b []byte) (int, error) {
+	for {
+		select {
+		case <-c.done:
+			return 0, net.ErrClosed
+		default:
+		}
+
+		c.rx.mu.Lock()
+		if c.rx.buf.Len() > 0 {
+			n, _ := c.rx.buf.Read(b)
+			c.rx.mu.Unlock()
+			return n, nil
+		}
+		closed := c.rx.closed
+		c.rx.mu.Unlock()
+		if closed {
+			return 0, io.EOF
+		}
+
+		c.deadlineMu.Lock()
+		deadline := c.readDeadline
+		c.deadlineMu.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		c.wait(deadline)
+	}
+}
+
+// wait blocks until rx is signalled, the deadline passes or c is closed.
+func (c *memoryConn) wait(deadline time.Time) {
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-c.rx.ready:
+	case <-expired:
+	case <-c.done:
+	}
+}
+
+func (c *memoryConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.tx.mu.Lock()
+	if c.tx.closed {
+		c.tx.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	c.tx.buf.Write(b)
+	c.tx.mu.Unlock()
+	c.tx.signal()
+	return len(b), nil
+}
+
+// Close ends both directions; the peer reads the remaining data, then io.EOF.
+func (c *memoryConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.tx.close()
+		c.rx.close()
+	})
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr  { return c.local }
+func (c *memoryConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *memoryConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	c.readDeadline = t
+	c.deadlineMu.Unlock()
+	c.rx.signal()
+	return nil
+}
+
+// SetWriteDeadline is a no-op: writes never block.
+func (c *memoryConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+func (a memoryAddr) String() string  { return string(a) }
+
+// SetTransport replaces the transport used for the next connection. A nil
+// transport restores TCP. Session entities of a general session use the
+// connection of the carrier, so set it on GeneralSession.Protocol().
+func (p *HsmsProtocol) SetTransport(transport Transport) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.transport = transport
+}
+
+// SetBufferSizes sets the read and write buffer sizes of the next connection.
+// A size of 0 disables that buffer; the default is DefaultBufferSize.
+func (p *HsmsProtocol) SetBufferSizes(readSize, writeSize int) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.readBufferSize = readSize
+	p.writeBufferSize = writeSize
+}
+
+// SetMaxMessageSize limits the length of received messages, counting the
+// 10 byte header. Longer messages are skipped without being buffered and
+// answered with S9F11; the connection stays up. Zero removes the limit; the
+// default is DefaultMaxMessageSize. It applies to the next connection.
+func (p *HsmsProtocol) SetMaxMessageSize(size int) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.maxMessageSize = size
+}
+
+// SetLazyDecoding makes received data messages carry an ast.LazyItem, which
+// decodes values on access, instead of decoded item nodes. Handlers that only
+// read a few items of large messages, e.g. the CEID of a S6F11, then skip
+// decoding the rest. Code that type-asserts item nodes needs LazyItem.Item
+// first; the gem handlers do that themselves. It applies to the next connection.
+func (p *HsmsProtocol) SetLazyDecoding(enabled bool) {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+	p.lazyDecoding = enabled
+}
+
+// connector is a snapshot of the connection settings, taken once per connection.
+type connector struct {
+	transport   Transport
+	tlsConfig   *tls.Config
+	readBuffer  int
+	writeBuffer int
+	maxMessage  int
+	lazy        bool
+	// localAddr and connectTimeout apply to dial only.
+	localAddr      net.Addr
+	connectTimeout time.Duration
+	// access, logger and onRefuse apply to listen only.
+	access   *accessFilter
+	logger   common.Logger
+	onRefuse func(addr net.Addr, err error)
+}
+
+func (p *HsmsProtocol) connector() connector {
+	p.transportMu.RLock()
+	defer p.transportMu.RUnlock()
+	return connector{
+		transport:      p.transport,
+		tlsConfig:      withPeerVerifier(p.tlsConfig, p.peerVerifier),
+		readBuffer:     p.readBufferSize,
+		writeBuffer:    p.writeBufferSize,
+		maxMessage:     p.maxMessageSize,
+		lazy:           p.lazyDecoding,
+		localAddr:      p.localAddr,
+		connectTimeout: p.connectTimeout,
+		access:         p.access,
+		logger:         p.logger,
+		onRefuse:       p.refuseConnection,
+	}
+}
+
+func (c connector) protocol() link.Protocol {
+	return codec.Bufio(&codec.SecsIIProtocol{MaxMessageSize: c.maxMessage, LazyItems: c.lazy}, c.readBuffer, c.writeBuffer)
+}
+
+// dial opens a session to address:port from the local address, if any,
+// completing the TLS handshake first when TLS is configured.
+func (c connector) dial(ctx context.Context, address string, port int) (*link.Session, error) {
+	transport := c.transport
+	if transport == nil {
+		transport = &TCPTransport{}
+	}
+	if c.localAddr != nil {
+		tcp, ok := transport.(*TCPTransport)
+		if !ok {
+			return nil, ErrLocalBindUnsupported
+		}
+		bound := &TCPTransport{Dialer: tcp.Dialer}
+		bound.Dialer.LocalAddr = c.localAddr
+		transport = bound
+	}
+	conn, err := transport.Dial(ctx, address, port)
+	if err != nil {
+		return nil, err
+	}
+	if c.tlsConfig != nil {
+		cfg := c.tlsConfig
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = address
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return link.NewConnSession(conn, c.protocol(), 0)
+}
+
+// listen opens a server on address:port. Connections the access filter
+// refuses are closed before the TLS handshake; accepted TLS connections
+// complete their handshake before handler runs.
+func (c connector) listen(address string, port int, handler link.Handler) (*link.Server, error) {
+	transport := c.transport
+	if transport == nil {
+		transport = &TCPTransport{}
+	}
+	listener, err := transport.Listen(address, port)
+	if err != nil {
+		return nil, err
+	}
+	if c.access != nil {
+		logger := c.logger
+		if logger == nil {
+			logger = common.NopLogger()
+		}
+		listener = &accessListener{Listener: listener, filter: c.access, logger: logger, onRefuse: c.onRefuse}
+	}
+	if c.tlsConfig != nil {
+		listener = tls.NewListener(listener, c.tlsConfig)
+	}
+	return link.NewServer(listener, c.protocol(), 0, handler), nil
+}
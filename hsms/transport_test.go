@@ -0,0 +1,115 @@
+package hsms
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// newTransportPair connects an equipment and a host protocol over transport.
+// configure runs on both protocols before they are enabled.
+func newTransportPair(t *testing.T, transport Transport, address string, port int, configure ...func(*HsmsProtocol)) (passive, active *HsmsProtocol) {
+	t.Helper()
+	passive = NewHsmsProtocol(address, port, false, 1, "equipment")
+	passive.Timeouts().SetLinktest(60)
+	passive.SetTransport(transport)
+	for _, fn := range configure {
+		fn(passive)
+	}
+	passive.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewASCIINode("online")), nil
+	})
+	passive.Enable()
+	t.Cleanup(passive.Disable)
+	waitForListening(t, passive)
+
+	active = NewHsmsProtocol(address, port, true, 1, "host")
+	active.Timeouts().SetLinktest(60)
+	active.Timeouts().SetAutoReconnect(false)
+	active.SetTransport(transport)
+	for _, fn := range configure {
+		fn(active)
+	}
+	active.Enable()
+	t.Cleanup(active.Disable)
+
+	waitForState(t, active, StateConnectedSelected, 3*time.Second)
+	return passive, active
+}
+
+func TestMemoryTransport(t *testing.T) {
+	_, active := newTransportPair(t, NewMemoryTransport(), "equipment", 5000)
+
+	reply, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+	if err != nil {
+		t.Fatalf("S1F1 over memory transport: %v", err)
+	}
+	item, _ := reply.Get()
+	if got := item.Values(); got != "online" {
+		t.Fatalf("unexpected reply %v", got)
+	}
+}
+
+func TestUnixTransport(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "hsms.sock")
+	_, active := newTransportPair(t, &UnixTransport{}, socket, 0, func(p *HsmsProtocol) {
+		p.SetBufferSizes(512, 0)
+	})
+
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("S1F1 over unix socket: %v", err)
+	}
+}
+
+func TestMemoryTransportAddresses(t *testing.T) {
+	transport := NewMemoryTransport()
+	if _, err := transport.Dial(context.Background(), "equipment", 1); !errors.Is(err, ErrNoListener) {
+		t.Fatalf("expected ErrNoListener, got %v", err)
+	}
+
+	listener, err := transport.Listen("equipment", 1)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if _, err := transport.Listen("equipment", 1); !errors.Is(err, ErrAddressInUse) {
+		t.Fatalf("expected ErrAddressInUse, got %v", err)
+	}
+	listener.Close()
+	if _, err := transport.Listen("equipment", 1); err != nil {
+		t.Fatalf("Listen after close: %v", err)
+	}
+}
+
+func TestLazyDecoding(t *testing.T) {
+	received := make(chan ast.ItemNode, 1)
+	_, active := newTransportPair(t, NewMemoryTransport(), "equipment", 5000, func(p *HsmsProtocol) {
+		p.SetLazyDecoding(true)
+		if !p.active {
+			p.RegisterHandler(6, 11, func(msg *ast.DataMessage) (*ast.DataMessage, error) {
+				ceid, err := msg.Get(1)
+				if err != nil {
+					return nil, err
+				}
+				received <- ceid
+				return ast.NewDataMessage("", 6, 12, 0, "H->E", ast.NewBinaryNode(0)), nil
+			})
+		}
+	})
+
+	report := ast.NewListNode(ast.NewUintNode(4, 1), ast.NewUintNode(4, 3001), ast.NewListNode())
+	if _, err := active.SendAndWait(ast.NewDataMessage("", 6, 11, 1, "H<-E", report)); err != nil {
+		t.Fatalf("S6F11: %v", err)
+	}
+	ceid := <-received
+	lazy, ok := ceid.(*ast.LazyItem)
+	if !ok {
+		t.Fatalf("CEID is %T, want *ast.LazyItem", ceid)
+	}
+	if values := lazy.Values().([]uint64); len(values) != 1 || values[0] != 3001 {
+		t.Fatalf("CEID = %v, want 3001", values)
+	}
+}
@@ -146,20 +146,30 @@ func (node *ASCIINode) FillVariables(values map[string]interface{}) ItemNode {
 
 // ToBytes implements ItemNode.ToBytes()
 func (node *ASCIINode) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *ASCIINode) EncodedLength() int {
 	if !node.isValue {
-		return []byte{}
+		return 0
 	}
+	return getEncodedLength("ascii", node.Size())
+}
 
-	result, err := getHeaderBytes("ascii", node.Size())
-	if err != nil {
-		return []byte{}
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *ASCIINode) AppendBytes(dst []byte) []byte {
+	if !node.isValue {
+		return dst
 	}
 
-	for _, ch := range node.value {
-		result = append(result, byte(ch))
+	dst, err := appendHeaderBytes(dst, "ascii", node.Size())
+	if err != nil {
+		return dst
 	}
 
-	return result
+	// value consists of ASCII characters, one byte each
+	return append(dst, node.value...)
 }
 
 // String returns the string representation of the node.
@@ -184,9 +194,15 @@ func (node *ASCIINode) String() string {
 		return "<A[0]>"
 	}
 
+	return fmt.Sprintf(`<A%s>`, textLiteral(node.value))
+}
+
+// textLiteral returns the SML representation of a text value, as quoted strings
+// of printable characters and 0xNN codes of control characters.
+func textLiteral(value string) string {
 	var sb strings.Builder
 	printableState := false
-	for _, ch := range node.value {
+	for _, ch := range value {
 		if ch < 32 || ch == 127 {
 			// ch is a non-printable control character
 			// 32: space, which is the first printable character, 127: del
@@ -208,8 +224,7 @@ func (node *ASCIINode) String() string {
 	if printableState {
 		sb.WriteString(`"`)
 	}
-
-	return fmt.Sprintf(`<A%s>`, sb.String())
+	return sb.String()
 }
 
 // Private methods
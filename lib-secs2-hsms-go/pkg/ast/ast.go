@@ -3,6 +3,7 @@
 package ast
 
 import (
+	"encoding/binary"
 	"fmt"
 	"unicode"
 )
@@ -377,37 +378,55 @@ func (node *DataMessage) Type() string {
 //
 // Implements HSMSMessage.ToBytes().
 func (node *DataMessage) ToBytes() []byte {
-	if node.WaitBit() == "optional" || len(node.Variables()) != 0 || node.sessionID == -1 {
-		return []byte{}
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength returns len(ToBytes()) without encoding the message.
+func (node *DataMessage) EncodedLength() int {
+	if !node.encodable() {
+		return 0
 	}
+	return 14 + node.dataItem.EncodedLength() // 4 length bytes, 10 header bytes
+}
 
-	itemBytes := node.dataItem.ToBytes()
-	result := make([]byte, 0, len(itemBytes)+14) // 4 length bytes, 10 header bytes
+// AppendBytes appends the HSMS byte representation of the SECS-II message to dst
+// and returns the extended slice. dst is returned unchanged when ToBytes would
+// return an empty slice.
+//
+// Implements HSMSMessage.AppendBytes().
+func (node *DataMessage) AppendBytes(dst []byte) []byte {
+	if !node.encodable() {
+		return dst
+	}
 
 	// Message length bytes
-	var msgLength uint32 = uint32(len(itemBytes) + 10) // 10 header bytes
-	result = append(result, byte(msgLength>>24))
-	result = append(result, byte(msgLength>>16))
-	result = append(result, byte(msgLength>>8))
-	result = append(result, byte(msgLength))
+	var msgLength uint32 = uint32(node.dataItem.EncodedLength() + 10) // 10 header bytes
+	dst = binary.BigEndian.AppendUint32(dst, msgLength)
 	// Header byte 0-1: device ID
-	result = append(result, byte(node.sessionID>>8))
-	result = append(result, byte(node.sessionID))
+	dst = append(dst, byte(node.sessionID>>8))
+	dst = append(dst, byte(node.sessionID))
 	// Header byte 2-3: wait bit + stream code, function code
 	headerByte2 := node.StreamCode()
 	if node.WaitBit() == "true" {
 		headerByte2 += 0b10000000
 	}
-	result = append(result, byte(headerByte2))
-	result = append(result, byte(node.FunctionCode()))
+	dst = append(dst, byte(headerByte2))
+	dst = append(dst, byte(node.FunctionCode()))
 	// Header byte 4-5: PType, SType
-	result = append(result, 0, 0)
+	dst = append(dst, 0, 0)
 	// Header byte 6-9: system bytes
-	result = append(result, node.systemBytes[:4]...)
+	dst = append(dst, node.systemBytes[:4]...)
 	// Message text
-	result = append(result, itemBytes...)
+	return node.dataItem.AppendBytes(dst)
+}
 
-	return result
+// encodable reports whether the message can be represented in HSMS format.
+func (node *DataMessage) encodable() bool {
+	if node.WaitBit() == "optional" || node.sessionID == -1 {
+		return false
+	}
+	// Items with variables have no encoded length; skip collecting them otherwise.
+	return node.dataItem.EncodedLength() != 0 || len(node.Variables()) == 0
 }
 
 func (node *DataMessage) String() string {
@@ -121,20 +121,33 @@ func (node *BinaryNode) FillVariables(values map[string]interface{}) ItemNode {
 
 // ToBytes implements ItemNode.ToBytes()
 func (node *BinaryNode) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *BinaryNode) EncodedLength() int {
+	if len(node.variables) != 0 {
+		return 0
+	}
+	return getEncodedLength("binary", node.Size())
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *BinaryNode) AppendBytes(dst []byte) []byte {
 	if len(node.variables) != 0 {
-		return []byte{}
+		return dst
 	}
 
-	result, err := getHeaderBytes("binary", node.Size())
+	dst, err := appendHeaderBytes(dst, "binary", node.Size())
 	if err != nil {
-		return []byte{}
+		return dst
 	}
 
 	for _, value := range node.values {
-		result = append(result, byte(value))
+		dst = append(dst, byte(value))
 	}
 
-	return result
+	return dst
 }
 
 // String returns the string representation of the node.
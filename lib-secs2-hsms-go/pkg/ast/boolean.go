@@ -112,24 +112,37 @@ func (node *BooleanNode) FillVariables(values map[string]interface{}) ItemNode {
 
 // ToBytes implements ItemNode.ToBytes()
 func (node *BooleanNode) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *BooleanNode) EncodedLength() int {
+	if len(node.variables) != 0 {
+		return 0
+	}
+	return getEncodedLength("boolean", node.Size())
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *BooleanNode) AppendBytes(dst []byte) []byte {
 	if len(node.variables) != 0 {
-		return []byte{}
+		return dst
 	}
 
-	result, err := getHeaderBytes("boolean", node.Size())
+	dst, err := appendHeaderBytes(dst, "boolean", node.Size())
 	if err != nil {
-		return []byte{}
+		return dst
 	}
 
 	for _, value := range node.values {
 		if value {
-			result = append(result, 1)
+			dst = append(dst, 1)
 		} else {
-			result = append(result, 0)
+			dst = append(dst, 0)
 		}
 	}
 
-	return result
+	return dst
 }
 
 // String returns the string representation of the node.
@@ -0,0 +1,131 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests AppendBytes() and EncodedLength() of the ItemNode implementations
+// and DataMessage.
+//
+// Testing Strategy:
+//
+// AppendBytes() must append exactly ToBytes() to any dst, and leave dst
+// unchanged when ToBytes() is empty. EncodedLength() must equal
+// len(ToBytes()).
+//
+// Partitions:
+//
+//   - Node type: every ItemNode implementation, nested ListNode
+//   - Length bytes: 1, 2, 3
+//   - Node encodable: yes, contains variable
+func TestItemNode_AppendBytes(t *testing.T) {
+	nodes := []ItemNode{
+		NewEmptyItemNode(),
+		NewASCIINode(""),
+		NewASCIINode("text"),
+		NewASCIINodeVariable("var", 0, -1),
+		NewBinaryNode(0, 1, 255),
+		NewBinaryNode("var"),
+		NewBooleanNode(true, false),
+		NewFloatNode(4, -1.5, 2),
+		NewFloatNode(8, 3.25),
+		NewIntNode(1, -128, 127),
+		NewIntNode(2, -1),
+		NewIntNode(4, 1<<20),
+		NewIntNode(8, -1<<40),
+		NewIntNode(8, "var"),
+		NewUintNode(1, 255),
+		NewUintNode(2, 65535),
+		NewUintNode(4, 1<<31),
+		NewUintNode(8, uint64(1<<63)),
+		NewListNode(),
+		NewListNode(NewUintNode(4, 1), NewListNode(NewASCIINode("nested"))),
+		NewListNode(NewUintNode(4, 1), "var"),
+		NewListNode(NewListNode(NewBinaryNode("var"))),
+		NewUintNode(2, zeros(200)...),
+		NewBinaryNode(zeros(70000)...),
+	}
+	for i, node := range nodes {
+		expected := node.ToBytes()
+		assert.Equal(t, len(expected), node.EncodedLength(), "node #%d", i)
+
+		prefix := []byte{0xAA, 0xBB}
+		assert.Equal(t, append(prefix[:2:2], expected...), node.AppendBytes(prefix), "node #%d", i)
+	}
+}
+
+func TestDataMessage_AppendBytes(t *testing.T) {
+	messages := []*DataMessage{
+		NewHSMSDataMessage("", 1, 1, 1, "H->E", NewEmptyItemNode(), 0, []byte{0, 0, 0, 1}),
+		NewHSMSDataMessage("", 6, 11, 1, "H<-E", s6f11Item(), 1, []byte{0, 0, 0, 2}),
+		NewDataMessage("", 6, 11, 1, "H<-E", NewListNode("var")),
+		NewDataMessage("", 1, 1, 1, "H->E", NewEmptyItemNode()),
+	}
+	for i, msg := range messages {
+		expected := msg.ToBytes()
+		assert.Equal(t, len(expected), msg.EncodedLength(), "message #%d", i)
+		assert.Equal(t, expected, msg.AppendBytes([]byte{}), "message #%d", i)
+	}
+}
+
+// zeros returns n zero values for the node factory methods.
+func zeros(n int) []interface{} {
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = 0
+	}
+	return values
+}
+
+// s6f11Item returns a typical S6F11 event report: DATAID, CEID and one report
+// with a few status variables.
+func s6f11Item() ItemNode {
+	return NewListNode(
+		NewUintNode(4, 1001),
+		NewUintNode(4, 3001),
+		NewListNode(
+			NewListNode(
+				NewUintNode(4, 4001),
+				NewListNode(
+					NewASCIINode("LOT-0001"),
+					NewASCIINode("RECIPE-A"),
+					NewFloatNode(8, 23.5),
+					NewUintNode(2, 3),
+					NewBooleanNode(true),
+					NewIntNode(4, -42),
+				),
+			),
+		),
+	)
+}
+
+func BenchmarkDataMessage_ToBytes(b *testing.B) {
+	msg := NewHSMSDataMessage("", 6, 11, 1, "H<-E", s6f11Item(), 1, []byte{0, 0, 0, 1})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg.ToBytes()
+	}
+}
+
+func BenchmarkDataMessage_AppendBytes(b *testing.B) {
+	msg := NewHSMSDataMessage("", 6, 11, 1, "H<-E", s6f11Item(), 1, []byte{0, 0, 0, 1})
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = msg.AppendBytes(buf[:0])
+	}
+}
+
+func BenchmarkListNode_ToBytes(b *testing.B) {
+	values := make([]interface{}, 1000)
+	for i := range values {
+		values[i] = NewFloatNode(4, float64(i))
+	}
+	trace := NewListNode(values...)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		trace.ToBytes()
+	}
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"strconv"
@@ -143,38 +144,47 @@ func (node *FloatNode) FillVariables(values map[string]interface{}) ItemNode {
 
 // ToBytes implements ItemNode.ToBytes()
 func (node *FloatNode) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *FloatNode) EncodedLength() int {
+	if len(node.variables) != 0 {
+		return 0
+	}
+	return getEncodedLength(node.typ(), node.Size())
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *FloatNode) AppendBytes(dst []byte) []byte {
 	if len(node.variables) != 0 {
-		return []byte{}
+		return dst
 	}
 
-	result, err := getHeaderBytes(fmt.Sprintf("f%d", node.byteSize), node.Size())
+	dst, err := appendHeaderBytes(dst, node.typ(), node.Size())
 	if err != nil {
-		return []byte{}
+		return dst
 	}
 
 	if node.byteSize == 4 {
 		for _, value := range node.values {
-			bits := math.Float32bits(float32(value))
-			result = append(result, byte(bits>>24))
-			result = append(result, byte(bits>>16))
-			result = append(result, byte(bits>>8))
-			result = append(result, byte(bits))
+			dst = binary.BigEndian.AppendUint32(dst, math.Float32bits(float32(value)))
 		}
 	} else {
 		for _, value := range node.values {
-			bits := math.Float64bits(value)
-			result = append(result, byte(bits>>56))
-			result = append(result, byte(bits>>48))
-			result = append(result, byte(bits>>40))
-			result = append(result, byte(bits>>32))
-			result = append(result, byte(bits>>24))
-			result = append(result, byte(bits>>16))
-			result = append(result, byte(bits>>8))
-			result = append(result, byte(bits))
+			dst = binary.BigEndian.AppendUint64(dst, math.Float64bits(value))
 		}
 	}
 
-	return result
+	return dst
+}
+
+// typ returns the type name used by getDataByteLength and getFormatCode.
+func (node *FloatNode) typ() string {
+	if node.byteSize == 4 {
+		return "f4"
+	}
+	return "f8"
 }
 
 // String returns the string representation of the node.
@@ -35,6 +35,10 @@ type HSMSMessage interface {
 	// ToBytes returns byte representation of the HSMS message.
 	ToBytes() []byte
 
+	// AppendBytes appends the byte representation of the HSMS message to dst
+	// and returns the extended slice.
+	AppendBytes(dst []byte) []byte
+
 	SystemBytes() []byte
 }
 
@@ -205,28 +209,18 @@ func NewHSMSMessageRejectReq(sessionID uint16, pType, sType byte, systemBytes []
 	return &ControlMessage{header}
 }
 
-func NewHSMSMessageRejectReqFromMsg(rejectReq HSMSMessage, reasonCode byte) HSMSMessage {
-	if rejectReq.Type() != "Reject.req" {
-		panic("expected Reject.req message")
-	}
-
-	header := make([]byte, 10)
-	msg, _ := rejectReq.(*ControlMessage)
-	header[0] = msg.header[0]
-	header[1] = msg.header[1]
-	if reasonCode == 2 {
-		header[2] = msg.header[4] // pType
-	} else {
-		header[2] = msg.header[5] // sType
-	}
-	header[3] = reasonCode
-	header[5] = sTypeRejectReq
-	header[6] = msg.header[0]
-	header[7] = msg.header[1]
-	header[8] = msg.header[2]
-	header[9] = msg.header[3]
-
-	return &ControlMessage{header}
+// NewHSMSMessageRejectReqFromMsg creates HSMS Reject.req control message for the
+// received message, copying its session ID, pType, sType and system bytes.
+func NewHSMSMessageRejectReqFromMsg(message HSMSMessage, reasonCode byte) HSMSMessage {
+	// bytes 4-13 of the encoded message are the header being rejected
+	rejected := message.ToBytes()[4:14]
+	return NewHSMSMessageRejectReq(
+		uint16(rejected[0])<<8|uint16(rejected[1]),
+		rejected[4],
+		rejected[5],
+		rejected[6:10],
+		reasonCode,
+	)
 }
 
 // NewHSMSMessageSeparateReq creates HSMS Separate.req control message.
@@ -276,10 +270,13 @@ func (msg *ControlMessage) Type() string {
 
 // ToBytes returns the HSMS byte representation of the control message.
 func (msg *ControlMessage) ToBytes() []byte {
-	result := make([]byte, 0, 14)
-	result = append(result, 0, 0, 0, 10)
-	result = append(result, msg.header...)
-	return result
+	return msg.AppendBytes(make([]byte, 0, 14))
+}
+
+// AppendBytes appends the HSMS byte representation of the control message to dst.
+func (msg *ControlMessage) AppendBytes(dst []byte) []byte {
+	dst = append(dst, 0, 0, 0, 10)
+	return append(dst, msg.header...)
 }
 
 func (msg *ControlMessage) SystemBytes() []byte {
@@ -291,6 +288,12 @@ func (msg *ControlMessage) SessionID() uint16 {
 	return uint16(msg.header[0])<<8 | uint16(msg.header[1])
 }
 
+// RejectedType returns header byte 2 of a reject.req: the PType of the rejected
+// message when the reason code is 2, otherwise its SType.
+func (msg *ControlMessage) RejectedType() byte {
+	return msg.header[2]
+}
+
 // Status returns the status byte carried by control messages such as select.rsp.
 func (msg *ControlMessage) Status() byte {
 	return msg.header[3]
@@ -130,11 +130,13 @@ func TestHSMSControlMessage_RejectReq(t *testing.T) {
 	req2 := NewHSMSMessageRejectReq(1, 1, 0, []byte{0, 0, 0, 1}, 2)
 	assert.Equal(t, "reject.req", req2.Type())
 	assert.Equal(t, []byte{0, 0, 0, 10, 0, 1, 1, 2, 0, 7, 0, 0, 0, 1}, req2.ToBytes())
+	assert.Equal(t, byte(1), req2.(*ControlMessage).RejectedType())
 
 	// reason code 3, sType 9
 	req3 := NewHSMSMessageRejectReq(0x1234, 0, 9, []byte{0xFC, 0xFD, 0xFE, 0xFF}, 3)
 	assert.Equal(t, "reject.req", req3.Type())
 	assert.Equal(t, []byte{0, 0, 0, 10, 0x12, 0x34, 9, 3, 0, 7, 0xFC, 0xFD, 0xFE, 0xFF}, req3.ToBytes())
+	assert.Equal(t, byte(9), req3.(*ControlMessage).RejectedType())
 
 	// reason code 4
 	req4 := NewHSMSMessageRejectReq(0xFFFF, 0, 0, []byte{0xFF, 0xFF, 0xFF, 0xFF}, 4)
@@ -142,6 +144,19 @@ func TestHSMSControlMessage_RejectReq(t *testing.T) {
 	assert.Equal(t, []byte{0, 0, 0, 10, 0xFF, 0xFF, 0, 4, 0, 7, 0xFF, 0xFF, 0xFF, 0xFF}, req4.ToBytes())
 }
 
+func TestHSMSControlMessage_RejectReqFromMsg(t *testing.T) {
+	// reason code 1, rejecting a select.req
+	req1 := NewHSMSMessageRejectReqFromMsg(NewHSMSMessageSelectReq(0x1234, []byte{0, 0, 0, 5}), 1)
+	assert.Equal(t, "reject.req", req1.Type())
+	assert.Equal(t, []byte{0, 0, 0, 10, 0x12, 0x34, 1, 1, 0, 7, 0, 0, 0, 5}, req1.ToBytes())
+
+	// reason code 4, rejecting a data message
+	data := NewDataMessage("", 1, 1, 1, "H->E", NewEmptyItemNode()).SetSessionIDAndSystemBytes(1, []byte{0, 0, 0, 9})
+	req2 := NewHSMSMessageRejectReqFromMsg(data, 4)
+	assert.Equal(t, "reject.req", req2.Type())
+	assert.Equal(t, []byte{0, 0, 0, 10, 0, 1, 0, 4, 0, 7, 0, 0, 0, 9}, req2.ToBytes())
+}
+
 func TestHSMSControlMessage_SeparateReq(t *testing.T) {
 	req1 := NewHSMSMessageSeparateReq(0, []byte{0, 0, 0, 0})
 	assert.Equal(t, "separate.req", req1.Type())
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"strconv"
@@ -138,23 +139,56 @@ func (node *IntNode) FillVariables(values map[string]interface{}) ItemNode {
 
 // ToBytes implements ItemNode.ToBytes()
 func (node *IntNode) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *IntNode) EncodedLength() int {
+	if len(node.variables) != 0 {
+		return 0
+	}
+	return getEncodedLength(node.typ(), node.Size())
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *IntNode) AppendBytes(dst []byte) []byte {
 	if len(node.variables) != 0 {
-		return []byte{}
+		return dst
 	}
 
-	result, err := getHeaderBytes(fmt.Sprintf("i%d", node.byteSize), node.Size())
+	dst, err := appendHeaderBytes(dst, node.typ(), node.Size())
 	if err != nil {
-		return []byte{}
+		return dst
 	}
 
 	for _, value := range node.values {
-		bits := uint64(value)
-		for i := node.byteSize - 1; i >= 0; i-- {
-			result = append(result, byte(bits>>(i*8)))
+		switch node.byteSize {
+		case 1:
+			dst = append(dst, byte(value))
+		case 2:
+			dst = binary.BigEndian.AppendUint16(dst, uint16(value))
+		case 4:
+			dst = binary.BigEndian.AppendUint32(dst, uint32(value))
+		default:
+			dst = binary.BigEndian.AppendUint64(dst, uint64(value))
 		}
 	}
 
-	return result
+	return dst
+}
+
+// typ returns the type name used by getDataByteLength and getFormatCode.
+func (node *IntNode) typ() string {
+	switch node.byteSize {
+	case 1:
+		return "i1"
+	case 2:
+		return "i2"
+	case 4:
+		return "i4"
+	default:
+		return "i8"
+	}
 }
 
 // String returns the string representation of the node.
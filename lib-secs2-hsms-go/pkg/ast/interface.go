@@ -8,6 +8,11 @@ import (
 
 const MAX_BYTE_SIZE = 1<<24 - 1
 
+// MaxListDepth is the maximum nesting depth of lists that decoders accept.
+// Deeper items are rejected as malformed, so that a hostile message cannot
+// exhaust the stack of the recursive decoders.
+const MaxListDepth = 64
+
 // ItemNode is a interface of immutable data types, that represents a data item in a SECS-II message.
 // It contains an array consists of data values or variables which can be used to fill the data values later.
 // E.g., A boolean node should be able to represent a SECS-II data item of <BOOLEAN[3] T F varName>.
@@ -51,6 +56,14 @@ type ItemNode interface {
 	// ToBytes returns the byte representation of the data item.
 	ToBytes() []byte
 
+	// AppendBytes appends the byte representation of the data item to dst and
+	// returns the extended slice. dst is returned unchanged when ToBytes would
+	// return an empty slice.
+	AppendBytes(dst []byte) []byte
+
+	// EncodedLength returns len(ToBytes()) without encoding the data item.
+	EncodedLength() int
+
 	// Get returns list itemNode
 	Get(indices ...int) (ItemNode, error)
 
@@ -106,6 +119,16 @@ func (node emptyItemNode) ToBytes() []byte {
 	return []byte{}
 }
 
+// AppendBytes implements ItemNode.AppendBytes()
+func (node emptyItemNode) AppendBytes(dst []byte) []byte {
+	return dst
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node emptyItemNode) EncodedLength() int {
+	return 0
+}
+
 // String returns the string representation of the node.
 func (node emptyItemNode) String() string {
 	return ""
@@ -142,74 +165,114 @@ func getVariableNames(variablePosition map[string]int) []string {
 // specified type and size.
 //
 // The input argument typ should be one of "list", "binary", "boolean", "ascii",
-// "i8", "i1", "i2", "i4", "f8", "f4", "u8", "u1", "u2", or "u4".
+// "jis8", "unicode", "i8", "i1", "i2", "i4", "f8", "f4", "u8", "u1", "u2", or "u4".
 // The input argument size means the number of values in a item node.
+// For "unicode" it excludes the 2 byte character set code.
 func getDataByteLength(typ string, size int) int {
-	bytePerValue := map[string]int{
-		"list":    1,
-		"binary":  1,
-		"boolean": 1,
-		"ascii":   1,
-		"i8":      8,
-		"i1":      1,
-		"i2":      2,
-		"i4":      4,
-		"f8":      8,
-		"f4":      4,
-		"u8":      8,
-		"u1":      1,
-		"u2":      2,
-		"u4":      4,
+	switch typ {
+	case "i8", "f8", "u8":
+		return size * 8
+	case "i4", "f4", "u4":
+		return size * 4
+	case "i2", "u2", "unicode":
+		return size * 2
+	case "list", "binary", "boolean", "ascii", "jis8", "i1", "u1":
+		return size
+	default:
+		return 0
+	}
+}
+
+// getFormatCode returns the format code of a SECS-II data item type.
+func getFormatCode(typ string) byte {
+	switch typ {
+	case "list":
+		return 0o00
+	case "binary":
+		return 0o10
+	case "boolean":
+		return 0o11
+	case "ascii":
+		return 0o20
+	case "jis8":
+		return 0o21
+	case "unicode":
+		return 0o22
+	case "i8":
+		return 0o30
+	case "i1":
+		return 0o31
+	case "i2":
+		return 0o32
+	case "i4":
+		return 0o34
+	case "f8":
+		return 0o40
+	case "f4":
+		return 0o44
+	case "u8":
+		return 0o50
+	case "u1":
+		return 0o51
+	case "u2":
+		return 0o52
+	case "u4":
+		return 0o54
+	default:
+		return 0
+	}
+}
+
+// getLengthBytesCount returns the number of length bytes in the header of a
+// data item of dataByteLength bytes.
+func getLengthBytesCount(dataByteLength int) int {
+	switch {
+	case dataByteLength > 0xFFFF:
+		return 3
+	case dataByteLength > 0xFF:
+		return 2
+	default:
+		return 1
 	}
-	return size * bytePerValue[typ]
 }
 
-// getHeaderBytes returns the header bytes, which consist of the format byte
-// and the length bytes, of a SECS-II data item.
+// getEncodedLength returns the number of bytes to represent a data item with
+// specified type and size, header included, or 0 when it cannot be encoded.
+func getEncodedLength(typ string, size int) int {
+	return getItemLength(getDataByteLength(typ, size))
+}
+
+// getItemLength returns the number of bytes to represent a data item with
+// dataByteLength bytes of data, header included, or 0 when it cannot be encoded.
+func getItemLength(dataByteLength int) int {
+	if dataByteLength > MAX_BYTE_SIZE {
+		return 0
+	}
+	return 1 + getLengthBytesCount(dataByteLength) + dataByteLength
+}
+
+// appendHeaderBytes appends the header bytes, which consist of the format byte
+// and the length bytes, of a SECS-II data item to dst.
 //
 // The input argument typ should be one of "list", "binary", "boolean", "ascii",
 // "i8", "i1", "i2", "i4", "f8", "f4", "u8", "u1", "u2", or "u4".
 // The input argument size means the number of values in a item node.
 // An error is returned when the header bytes cannot be created.
-func getHeaderBytes(typ string, size int) ([]byte, error) {
-	formatCode := map[string]int{
-		"list":    0o00,
-		"binary":  0o10,
-		"boolean": 0o11,
-		"ascii":   0o20,
-		"i8":      0o30,
-		"i1":      0o31,
-		"i2":      0o32,
-		"i4":      0o34,
-		"f8":      0o40,
-		"f4":      0o44,
-		"u8":      0o50,
-		"u1":      0o51,
-		"u2":      0o52,
-		"u4":      0o54,
-	}
+func appendHeaderBytes(dst []byte, typ string, size int) ([]byte, error) {
+	return appendItemHeader(dst, typ, getDataByteLength(typ, size))
+}
 
-	dataByteLength := getDataByteLength(typ, size)
+// appendItemHeader appends the header bytes of a SECS-II data item of type typ
+// with dataByteLength bytes of data to dst.
+func appendItemHeader(dst []byte, typ string, dataByteLength int) ([]byte, error) {
 	if dataByteLength > MAX_BYTE_SIZE {
-		return []byte{}, fmt.Errorf("size limit exceeded")
+		return dst, fmt.Errorf("size limit exceeded")
 	}
 
-	lengthBytes := []byte{
-		byte(dataByteLength >> 16),
-		byte(dataByteLength >> 8),
-		byte(dataByteLength),
+	lengthBytesCount := getLengthBytesCount(dataByteLength)
+	dst = append(dst, getFormatCode(typ)<<2+byte(lengthBytesCount))
+	for i := lengthBytesCount - 1; i >= 0; i-- {
+		dst = append(dst, byte(dataByteLength>>(i*8)))
 	}
-
-	if lengthBytes[0] == 0 {
-		if lengthBytes[1] == 0 {
-			lengthBytes = lengthBytes[2:]
-		} else {
-			lengthBytes = lengthBytes[1:]
-		}
-	}
-
-	result := []byte{}
-	result = append(result, byte(formatCode[typ]<<2+len(lengthBytes)))
-	result = append(result, lengthBytes...)
-	return result, nil
+	return dst, nil
 }
@@ -0,0 +1,115 @@
+package ast
+
+import (
+	"fmt"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// JIS8Node is a immutable data type that represents a JIS-8 string in a SECS-II message.
+// Implements ItemNode.
+//
+// It contains a Go string, which is encoded as Shift_JIS: the JIS-8 (JIS X 0201)
+// characters take one byte each and JIS X 0208 characters, e.g. kanji, take two.
+// The size of JIS8Node is the number of encoded bytes.
+type JIS8Node struct {
+	value   string // text
+	encoded []byte // Shift_JIS bytes of value
+
+	symbol string
+	// Rep invariants
+	// - encoded is the Shift_JIS encoding of value
+	//
+	// Safety from rep exposure
+	// - encoded is copied when the node is created from bytes, and never returned
+}
+
+// Factory methods
+
+// NewJIS8Node creates a new JIS8Node that contains the input string.
+//
+// The input string should consist of characters that Shift_JIS can encode.
+func NewJIS8Node(str string) ItemNode {
+	encoded, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(str))
+	if err != nil {
+		panic("encountered character that is not in JIS-8 or Shift_JIS")
+	}
+	return newJIS8Node(str, encoded)
+}
+
+// NewJIS8NodeFromBytes creates a new JIS8Node from the Shift_JIS bytes of a
+// SECS-II data item. The bytes are copied; ToBytes returns them unchanged.
+func NewJIS8NodeFromBytes(data []byte) ItemNode {
+	value, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		panic("invalid Shift_JIS bytes")
+	}
+	return newJIS8Node(string(value), append([]byte(nil), data...))
+}
+
+func newJIS8Node(value string, encoded []byte) ItemNode {
+	if getDataByteLength("jis8", len(encoded)) > MAX_BYTE_SIZE {
+		panic("string length limit exceeded")
+	}
+	return &JIS8Node{value: value, encoded: encoded, symbol: "jis8"}
+}
+
+// Public methods
+
+func (node *JIS8Node) Values() interface{} {
+	return node.value
+}
+
+func (node *JIS8Node) Type() string {
+	return node.symbol
+}
+
+func (node *JIS8Node) Get(indices ...int) (ItemNode, error) {
+	if len(indices) == 0 {
+		return node, nil
+	} else {
+		return nil, fmt.Errorf("not list, node is %s, indices is %v", node, indices)
+	}
+}
+
+// Size implements ItemNode.Size().
+func (node *JIS8Node) Size() int {
+	return len(node.encoded)
+}
+
+// Variables implements ItemNode.Variables().
+func (node *JIS8Node) Variables() []string {
+	return []string{}
+}
+
+// FillVariables implements ItemNode.FillVariables().
+func (node *JIS8Node) FillVariables(values map[string]interface{}) ItemNode {
+	return node
+}
+
+// ToBytes implements ItemNode.ToBytes()
+func (node *JIS8Node) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *JIS8Node) EncodedLength() int {
+	return getEncodedLength("jis8", node.Size())
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *JIS8Node) AppendBytes(dst []byte) []byte {
+	dst, err := appendHeaderBytes(dst, "jis8", node.Size())
+	if err != nil {
+		return dst
+	}
+	return append(dst, node.encoded...)
+}
+
+// String returns the string representation of the node.
+func (node *JIS8Node) String() string {
+	if node.value == "" {
+		return "<J[0]>"
+	}
+	return fmt.Sprintf(`<J%s>`, textLiteral(node.value))
+}
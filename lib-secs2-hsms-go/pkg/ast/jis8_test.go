@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Testing Strategy:
+//
+// Create a new instance using the factory methods, and test the result of
+// public observer methods Size(), Values(), ToBytes(), and String().
+//
+// Partitions:
+//
+// - Length of the string: 0, 1, ...
+// - Characters: ASCII, half-width katakana, JIS X 0208 (2 bytes each)
+// - Factory method: NewJIS8Node, NewJIS8NodeFromBytes
+
+func TestJIS8Node(t *testing.T) {
+	var tests = []struct {
+		description     string // Test case description
+		input           string // Input to the factory method
+		expectedSize    int    // expected result from Size()
+		expectedToBytes []byte // expected result from ToBytes()
+		expectedString  string // expected result from String()
+	}{
+		{
+			description:     "Length: 0",
+			input:           "",
+			expectedSize:    0,
+			expectedToBytes: []byte{0x45, 0},
+			expectedString:  `<J[0]>`,
+		},
+		{
+			description:     "ASCII characters",
+			input:           "ABC",
+			expectedSize:    3,
+			expectedToBytes: []byte{0x45, 3, 0x41, 0x42, 0x43},
+			expectedString:  `<J "ABC">`,
+		},
+		{
+			description:     "Half-width katakana",
+			input:           "ｱｲ",
+			expectedSize:    2,
+			expectedToBytes: []byte{0x45, 2, 0xB1, 0xB2},
+			expectedString:  `<J "ｱｲ">`,
+		},
+		{
+			description:     "Kanji and control character",
+			input:           "日本\n",
+			expectedSize:    5,
+			expectedToBytes: []byte{0x45, 5, 0x93, 0xFA, 0x96, 0x7B, 0x0A},
+			expectedString:  `<J "日本" 0x0A>`,
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test #%d: %s", i, test.description)
+		node := NewJIS8Node(test.input)
+		assert.Equal(t, test.expectedSize, node.Size())
+		assert.Equal(t, test.input, node.Values())
+		assert.Equal(t, "jis8", node.Type())
+		assert.Equal(t, []string{}, node.Variables())
+		assert.Equal(t, test.expectedToBytes, node.ToBytes())
+		assert.Equal(t, len(test.expectedToBytes), node.EncodedLength())
+		assert.Equal(t, test.expectedString, fmt.Sprint(node))
+
+		fromBytes := NewJIS8NodeFromBytes(test.expectedToBytes[2:])
+		assert.Equal(t, test.input, fromBytes.Values())
+		assert.Equal(t, test.expectedToBytes, fromBytes.ToBytes())
+	}
+}
+
+func TestJIS8Node_NotEncodable(t *testing.T) {
+	assert.Panics(t, func() { NewJIS8Node("한국어") })
+}
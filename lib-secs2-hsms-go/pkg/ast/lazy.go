@@ -0,0 +1,413 @@
+package ast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrMalformedItem is wrapped by the errors NewLazyItem returns for bytes that
+// are not a valid SECS-II data item.
+var ErrMalformedItem = errors.New("malformed SECS-II item")
+
+// LazyItem is a immutable data type that represents a SECS-II data item by its
+// encoded bytes. Implements ItemNode.
+//
+// Values are decoded when they are accessed, and Get navigates nested lists
+// by their headers, returning LazyItems that share the bytes of their parent.
+// It suits large messages of which a handler only reads a few items, e.g. the
+// CEID of a S6F11. Item converts it into regular item nodes.
+type LazyItem struct {
+	raw          []byte // encoded item, header included
+	typ          string // type name, as returned by Type()
+	headerLength int    // format byte and length bytes
+	length       int    // number of data bytes, or number of items in a list
+
+	// Rep invariants
+	// - raw is a valid SECS-II data item, checked by NewLazyItem
+	// - length is a multiple of the byte size of typ
+	//
+	// Safety from rep exposure
+	// - raw should not be modified; Raw documents that it is shared
+}
+
+// Factory methods
+
+// NewLazyItem creates a new LazyItem over the encoded data item raw, which is
+// not copied and should not be modified afterwards.
+//
+// The structure of the item is checked up front, without allocating, so that
+// navigating it later cannot fail. An error wrapping ErrMalformedItem is
+// returned when raw is not exactly one valid data item.
+func NewLazyItem(raw []byte) (*LazyItem, error) {
+	end, err := scanItem(raw, 0)
+	if err != nil {
+		return nil, err
+	}
+	if end != len(raw) {
+		return nil, malformedItem("%d bytes after the data item", len(raw)-end)
+	}
+	return newLazyItem(raw), nil
+}
+
+// newLazyItem creates a LazyItem over raw, which has been checked by scanItem.
+func newLazyItem(raw []byte) *LazyItem {
+	typ, headerLength, length, _ := readItemHeader(raw, 0)
+	return &LazyItem{raw: raw, typ: typ, headerLength: headerLength, length: length}
+}
+
+// Public methods
+
+// Raw returns the encoded data item. The bytes are shared and should not be modified.
+func (node *LazyItem) Raw() []byte {
+	return node.raw
+}
+
+// Item decodes the data item and its children into regular item nodes.
+// An error is returned for values the item nodes cannot hold, i.e. non-ASCII
+// characters in ASCII items and floats that are infinite or NaN.
+func (node *LazyItem) Item() (item ItemNode, err error) {
+	// Handle panics on abstract syntax tree creation
+	defer func() {
+		if r := recover(); r != nil {
+			item, err = NewEmptyItemNode(), malformedItem("%v", r)
+		}
+	}()
+	return node.item(), nil
+}
+
+// Size implements ItemNode.Size().
+func (node *LazyItem) Size() int {
+	switch node.typ {
+	case "list":
+		return node.length
+	case "unicode":
+		if node.length == 0 {
+			return 0
+		}
+		// The character set code precedes the characters.
+		return (node.length - 2) / 2
+	}
+	return node.length / getDataByteLength(node.typ, 1)
+}
+
+// Variables implements ItemNode.Variables().
+func (node *LazyItem) Variables() []string {
+	return []string{}
+}
+
+// FillVariables implements ItemNode.FillVariables().
+func (node *LazyItem) FillVariables(values map[string]interface{}) ItemNode {
+	return node
+}
+
+// ToBytes implements ItemNode.ToBytes()
+func (node *LazyItem) ToBytes() []byte {
+	return append([]byte(nil), node.raw...)
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *LazyItem) AppendBytes(dst []byte) []byte {
+	return append(dst, node.raw...)
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *LazyItem) EncodedLength() int {
+	return len(node.raw)
+}
+
+// Get implements ItemNode.Get(). It returns a LazyItem; the items before the
+// requested one are skipped by their headers without being decoded.
+func (node *LazyItem) Get(indices ...int) (ItemNode, error) {
+	current := node
+	for _, index := range indices {
+		if current.typ != "list" {
+			return nil, fmt.Errorf("not list")
+		}
+		if index < 0 || index >= current.length {
+			return nil, fmt.Errorf("index out of bounds error, size : %d", current.length)
+		}
+
+		pos := current.headerLength
+		for i := 0; i < index; i++ {
+			pos, _ = scanItem(current.raw, pos)
+		}
+		end, _ := scanItem(current.raw, pos)
+		current = newLazyItem(current.raw[pos:end])
+	}
+	return current, nil
+}
+
+// Values implements ItemNode.Values(). The values have the same types as those
+// of the item node Item returns, except that a list holds LazyItems.
+func (node *LazyItem) Values() interface{} {
+	data := node.raw[node.headerLength:]
+	switch node.typ {
+	case "list":
+		values := make([]ItemNode, 0, node.length)
+		pos := node.headerLength
+		for i := 0; i < node.length; i++ {
+			end, _ := scanItem(node.raw, pos)
+			values = append(values, newLazyItem(node.raw[pos:end]))
+			pos = end
+		}
+		return values
+	case "ascii":
+		return string(data)
+	case "jis8":
+		return NewJIS8NodeFromBytes(data).Values()
+	case "unicode":
+		return NewUnicodeNodeFromBytes(data).Values()
+	case "binary":
+		values := make([]int, len(data))
+		for i, b := range data {
+			values[i] = int(b)
+		}
+		return values
+	case "boolean":
+		values := make([]bool, len(data))
+		for i, b := range data {
+			values[i] = b != 0
+		}
+		return values
+	}
+
+	byteSize := getDataByteLength(node.typ, 1)
+	switch node.typ[0] {
+	case 'f':
+		values := make([]float64, 0, node.Size())
+		for i := 0; i < len(data); i += byteSize {
+			values = append(values, decodeFloat(node.typ, data[i:]))
+		}
+		return values
+	case 'i':
+		values := make([]int64, 0, node.Size())
+		for i := 0; i < len(data); i += byteSize {
+			values = append(values, decodeInt(node.typ, data[i:]))
+		}
+		return values
+	default:
+		values := make([]uint64, 0, node.Size())
+		for i := 0; i < len(data); i += byteSize {
+			values = append(values, decodeUint(node.typ, data[i:]))
+		}
+		return values
+	}
+}
+
+// Type implements ItemNode.Type().
+func (node *LazyItem) Type() string {
+	return node.typ
+}
+
+// String returns the string representation of the decoded item.
+func (node *LazyItem) String() string {
+	item, _ := node.Item()
+	return fmt.Sprint(item)
+}
+
+// Private methods
+
+// item decodes the data item; the item node factory methods panic on values
+// they cannot hold.
+func (node *LazyItem) item() ItemNode {
+	if node.typ == "list" {
+		children := node.Values().([]ItemNode)
+		values := make([]interface{}, len(children))
+		for i, child := range children {
+			values[i] = child.(*LazyItem).item()
+		}
+		return NewListNode(values...)
+	}
+
+	data := node.raw[node.headerLength:]
+	switch node.typ {
+	case "ascii":
+		return NewASCIINode(string(data))
+	case "jis8":
+		return NewJIS8NodeFromBytes(data)
+	case "unicode":
+		return NewUnicodeNodeFromBytes(data)
+	case "binary":
+		values := make([]interface{}, len(data))
+		for i, b := range data {
+			values[i] = b
+		}
+		return NewBinaryNode(values...)
+	case "boolean":
+		values := make([]interface{}, len(data))
+		for i, b := range data {
+			values[i] = b != 0
+		}
+		return NewBooleanNode(values...)
+	}
+
+	byteSize := getDataByteLength(node.typ, 1)
+	values := make([]interface{}, 0, node.Size())
+	for i := 0; i < len(data); i += byteSize {
+		switch node.typ[0] {
+		case 'f':
+			values = append(values, decodeFloat(node.typ, data[i:]))
+		case 'i':
+			values = append(values, decodeInt(node.typ, data[i:]))
+		default:
+			values = append(values, decodeUint(node.typ, data[i:]))
+		}
+	}
+	switch node.typ[0] {
+	case 'f':
+		return NewFloatNode(byteSize, values...)
+	case 'i':
+		return NewIntNode(byteSize, values...)
+	default:
+		return NewUintNode(byteSize, values...)
+	}
+}
+
+// Helper functions
+
+func malformedItem(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformedItem, fmt.Sprintf(format, args...))
+}
+
+// getTypeName returns the type name of a SECS-II format code, or "" when the
+// format code is not supported.
+func getTypeName(formatCode byte) string {
+	switch formatCode {
+	case 0o00:
+		return "list"
+	case 0o10:
+		return "binary"
+	case 0o11:
+		return "boolean"
+	case 0o20:
+		return "ascii"
+	case 0o21:
+		return "jis8"
+	case 0o22:
+		return "unicode"
+	case 0o30:
+		return "i8"
+	case 0o31:
+		return "i1"
+	case 0o32:
+		return "i2"
+	case 0o34:
+		return "i4"
+	case 0o40:
+		return "f8"
+	case 0o44:
+		return "f4"
+	case 0o50:
+		return "u8"
+	case 0o51:
+		return "u1"
+	case 0o52:
+		return "u2"
+	case 0o54:
+		return "u4"
+	default:
+		return ""
+	}
+}
+
+// readItemHeader reads the header of the data item at pos of raw.
+func readItemHeader(raw []byte, pos int) (typ string, headerLength, length int, err error) {
+	if pos >= len(raw) {
+		return "", 0, 0, malformedItem("item exceeds message length")
+	}
+	typ = getTypeName(raw[pos] >> 2)
+	if typ == "" {
+		return "", 0, 0, malformedItem("unknown format code %#o", raw[pos]>>2)
+	}
+	lengthBytesCount := int(raw[pos] & 0b00000011)
+	if lengthBytesCount == 0 {
+		return "", 0, 0, malformedItem("item without length bytes")
+	}
+	headerLength = 1 + lengthBytesCount
+	if pos+headerLength > len(raw) {
+		return "", 0, 0, malformedItem("item exceeds message length")
+	}
+	for _, b := range raw[pos+1 : pos+headerLength] {
+		length = length<<8 | int(b)
+	}
+	return typ, headerLength, length, nil
+}
+
+// scanItem checks the data item at pos of raw and returns the position after it.
+func scanItem(raw []byte, pos int) (int, error) {
+	return scanNestedItem(raw, pos, 0)
+}
+
+// scanNestedItem is scanItem for an item inside depth lists.
+func scanNestedItem(raw []byte, pos, depth int) (int, error) {
+	typ, headerLength, length, err := readItemHeader(raw, pos)
+	if err != nil {
+		return 0, err
+	}
+	pos += headerLength
+
+	if typ == "list" {
+		// Every item takes at least two bytes.
+		if length > (len(raw)-pos)/2 {
+			return 0, malformedItem("list of %d items exceeds message length", length)
+		}
+		if depth >= MaxListDepth {
+			return 0, malformedItem("lists nested deeper than %d", MaxListDepth)
+		}
+		for i := 0; i < length; i++ {
+			if pos, err = scanNestedItem(raw, pos, depth+1); err != nil {
+				return 0, err
+			}
+		}
+		return pos, nil
+	}
+
+	if byteSize := getDataByteLength(typ, 1); length%byteSize != 0 {
+		return 0, malformedItem("item length %d is not a multiple of %d", length, byteSize)
+	}
+	if length > len(raw)-pos {
+		return 0, malformedItem("item exceeds message length")
+	}
+	if typ == "unicode" && length > 0 {
+		// length is even, so the character set code is there.
+		if charset := binary.BigEndian.Uint16(raw[pos:]); charset != CharsetUCS2 {
+			return 0, malformedItem("unsupported character set %d", charset)
+		}
+	}
+	return pos + length, nil
+}
+
+func decodeFloat(typ string, b []byte) float64 {
+	if typ == "f4" {
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+func decodeInt(typ string, b []byte) int64 {
+	switch typ {
+	case "i1":
+		return int64(int8(b[0]))
+	case "i2":
+		return int64(int16(binary.BigEndian.Uint16(b)))
+	case "i4":
+		return int64(int32(binary.BigEndian.Uint32(b)))
+	default:
+		return int64(binary.BigEndian.Uint64(b))
+	}
+}
+
+func decodeUint(typ string, b []byte) uint64 {
+	switch typ {
+	case "u1":
+		return uint64(b[0])
+	case "u2":
+		return uint64(binary.BigEndian.Uint16(b))
+	case "u4":
+		return uint64(binary.BigEndian.Uint32(b))
+	default:
+		return binary.BigEndian.Uint64(b)
+	}
+}
@@ -0,0 +1,165 @@
+package ast
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests LazyItem
+//
+// Testing Strategy:
+//
+// Create LazyItems over the bytes of regular item nodes, and compare Item(),
+// Get(), Values(), Size() and Type() with those of the regular nodes.
+//
+// Partitions:
+//
+//   - Item type: every ItemNode implementation, nested ListNode
+//   - Get indices: none, one, nested, out of bounds, into a non-list item
+//   - Input bytes: valid, malformed
+func TestLazyItem_MatchesItemNode(t *testing.T) {
+	nodes := []ItemNode{
+		NewASCIINode(""),
+		NewASCIINode("text"),
+		NewJIS8Node(""),
+		NewJIS8Node("日本ｱ"),
+		NewUnicodeNode(""),
+		NewUnicodeNode("한日😀"),
+		NewBinaryNode(0, 1, 255),
+		NewBooleanNode(true, false),
+		NewFloatNode(4, -1.5, 2),
+		NewFloatNode(8, 3.25),
+		NewIntNode(1, -128, 127),
+		NewIntNode(2, -1),
+		NewIntNode(4, 1<<20),
+		NewIntNode(8, -1<<40),
+		NewUintNode(1, 255),
+		NewUintNode(2, 65535),
+		NewUintNode(4, 1<<31),
+		NewUintNode(8, uint64(1<<63)),
+		NewListNode(),
+		s6f11Item(),
+	}
+	for i, node := range nodes {
+		lazy, err := NewLazyItem(node.ToBytes())
+		assert.NoError(t, err, "node #%d", i)
+
+		item, err := lazy.Item()
+		assert.NoError(t, err, "node #%d", i)
+		assert.Equal(t, node.ToBytes(), item.ToBytes(), "node #%d", i)
+		assert.Equal(t, node.ToBytes(), lazy.ToBytes(), "node #%d", i)
+		assert.Equal(t, node.EncodedLength(), lazy.EncodedLength(), "node #%d", i)
+		assert.Equal(t, node.Size(), lazy.Size(), "node #%d", i)
+		assert.Equal(t, node.Type(), lazy.Type(), "node #%d", i)
+		assert.Equal(t, node.(interface{ String() string }).String(), lazy.String(), "node #%d", i)
+		if node.Type() != "list" {
+			assert.Equal(t, node.Values(), lazy.Values(), "node #%d", i)
+		}
+	}
+}
+
+func TestLazyItem_Get(t *testing.T) {
+	node := s6f11Item()
+	raw := node.ToBytes()
+	lazy, err := NewLazyItem(raw)
+	assert.NoError(t, err)
+
+	for _, indices := range [][]int{{}, {1}, {2, 0}, {2, 0, 1, 3}} {
+		expected, err := node.Get(indices...)
+		assert.NoError(t, err)
+		actual, err := lazy.Get(indices...)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.ToBytes(), actual.ToBytes(), "indices %v", indices)
+	}
+
+	// Items share the bytes of the message.
+	ceid, _ := lazy.Get(1)
+	assert.Same(t, &raw[8], &ceid.(*LazyItem).Raw()[0]) // after <L[3]> and <U4 1001>
+	assert.Equal(t, uint64(3001), ceid.Values().([]uint64)[0])
+
+	_, err = lazy.Get(3)
+	assert.EqualError(t, err, "index out of bounds error, size : 3")
+	_, err = lazy.Get(1, 0)
+	assert.EqualError(t, err, "not list")
+}
+
+func TestLazyItem_Malformed(t *testing.T) {
+	inputs := [][]byte{
+		{},
+		{0o001, 200, 0o245, 1, 1},
+		{0o101, 200, 'a'},
+		{0o100, 'a'},
+		{0o175, 1, 0},
+		{0o261, 3, 0, 0, 1},
+		{0o245, 1, 1, 0xFF},
+		{0o102, 0},
+		{0o111, 3, 0, 1, 0},
+		{0o111, 2, 0, 2},
+	}
+	for _, input := range inputs {
+		_, err := NewLazyItem(input)
+		assert.True(t, errors.Is(err, ErrMalformedItem), "input %v: %v", input, err)
+	}
+
+	// Values the item nodes cannot hold are reported by Item.
+	lazy, err := NewLazyItem([]byte{0o101, 1, 0xFF})
+	assert.NoError(t, err)
+	_, err = lazy.Item()
+	assert.True(t, errors.Is(err, ErrMalformedItem))
+}
+
+func TestLazyItem_DeepNesting(t *testing.T) {
+	nested := func(depth int) []byte {
+		raw := make([]byte, 0, 2*depth)
+		for i := 1; i < depth; i++ {
+			raw = append(raw, 0o001, 1)
+		}
+		return append(raw, 0o001, 0)
+	}
+
+	lazy, err := NewLazyItem(nested(MaxListDepth))
+	assert.NoError(t, err)
+	_, err = lazy.Item()
+	assert.NoError(t, err)
+
+	for _, depth := range []int{MaxListDepth + 1, 7 << 20} {
+		_, err := NewLazyItem(nested(depth))
+		assert.True(t, errors.Is(err, ErrMalformedItem), "depth %d: %v", depth, err)
+	}
+}
+
+func TestLazyItem_InDataMessage(t *testing.T) {
+	lazy, err := NewLazyItem(s6f11Item().ToBytes())
+	assert.NoError(t, err)
+	msg := NewHSMSDataMessage("", 6, 11, 1, "H<-E", lazy, 1, []byte{0, 0, 0, 1})
+	eager := NewHSMSDataMessage("", 6, 11, 1, "H<-E", s6f11Item(), 1, []byte{0, 0, 0, 1})
+
+	assert.Equal(t, eager.ToBytes(), msg.ToBytes())
+	assert.Equal(t, eager.String(), msg.String())
+
+	ascii, err := msg.GetAscii(2, 0, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "LOT-0001", ascii)
+	value, err := msg.GetInt(2, 0, 1, 5, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), value)
+	flag, err := msg.GetBoolean(2, 0, 1, 4, 0)
+	assert.NoError(t, err)
+	assert.True(t, flag)
+}
+
+func BenchmarkLazyItem_GetCEID(b *testing.B) {
+	values := make([]interface{}, 1000)
+	for i := range values {
+		values[i] = NewFloatNode(4, float64(i))
+	}
+	raw := NewListNode(NewUintNode(4, 1), NewUintNode(4, 3001), NewListNode(values...)).ToBytes()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lazy, _ := NewLazyItem(raw)
+		ceid, _ := lazy.Get(1)
+		_ = ceid.Values()
+	}
+}
@@ -36,6 +36,7 @@ import (
 type ListNode struct {
 	values    []ItemNode     // Array of ItemNodes that this ListNode contains
 	variables map[string]int // Variable name and its position in the data array
+	length    int            // Encoded length, computed once since the node is immutable
 
 	symbol string
 	// Rep invariants
@@ -86,8 +87,9 @@ func NewListNode(values ...interface{}) ItemNode {
 		}
 	}
 
-	node := &ListNode{nodeValues, nodeVariables, "list"}
+	node := &ListNode{values: nodeValues, variables: nodeVariables, symbol: "list"}
 	node.checkRep()
+	node.length = node.encodedLength()
 	return node
 }
 
@@ -145,25 +147,27 @@ func (node *ListNode) FillVariables(values map[string]interface{}) ItemNode {
 
 // ToBytes implements ItemNode.ToBytes()
 func (node *ListNode) ToBytes() []byte {
-	if len(node.variables) != 0 {
-		return []byte{}
-	}
+	return node.AppendBytes(make([]byte, 0, node.length))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *ListNode) EncodedLength() int {
+	return node.length
+}
 
-	result, err := getHeaderBytes("list", node.Size())
-	if err != nil {
-		return []byte{}
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *ListNode) AppendBytes(dst []byte) []byte {
+	if node.length == 0 {
+		return dst
 	}
 
+	dst, _ = appendHeaderBytes(dst, "list", node.Size())
 	for _, item := range node.values {
-		// Call ToBytes() of child node recursively
-		childResult := item.ToBytes()
-		if len(childResult) == 0 {
-			return []byte{}
-		}
-		result = append(result, childResult...)
+		// Call AppendBytes() of child node recursively
+		dst = item.AppendBytes(dst)
 	}
 
-	return result
+	return dst
 }
 
 func (node *ListNode) Get(indices ...int) (ItemNode, error) {
@@ -195,6 +199,28 @@ func (node *ListNode) String() string {
 
 // Private methods
 
+// encodedLength returns the encoded length of the node, or 0 when the node
+// contains variables or a child that cannot be encoded.
+func (node *ListNode) encodedLength() int {
+	if len(node.variables) != 0 {
+		return 0
+	}
+
+	if node.Size() > MAX_BYTE_SIZE {
+		return 0
+	}
+	// The length bytes of a list hold its item count; the items follow the header.
+	length := 1 + getLengthBytesCount(node.Size())
+	for _, item := range node.values {
+		childLength := item.EncodedLength()
+		if childLength == 0 {
+			return 0
+		}
+		length += childLength
+	}
+	return length
+}
+
 func (node *ListNode) checkRep() {
 	ellipsisExist := false
 	visitedIndex := map[int]bool{}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/binary"
 	"fmt"
 	"strconv"
 	"strings"
@@ -132,22 +133,56 @@ func (node *UintNode) FillVariables(values map[string]interface{}) ItemNode {
 
 // ToBytes implements ItemNode.ToBytes()
 func (node *UintNode) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *UintNode) EncodedLength() int {
+	if len(node.variables) != 0 {
+		return 0
+	}
+	return getEncodedLength(node.typ(), node.Size())
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *UintNode) AppendBytes(dst []byte) []byte {
 	if len(node.variables) != 0 {
-		return []byte{}
+		return dst
 	}
 
-	result, err := getHeaderBytes(fmt.Sprintf("u%d", node.byteSize), node.Size())
+	dst, err := appendHeaderBytes(dst, node.typ(), node.Size())
 	if err != nil {
-		return []byte{}
+		return dst
 	}
 
 	for _, value := range node.values {
-		for i := node.byteSize - 1; i >= 0; i-- {
-			result = append(result, byte(value>>(i*8)))
+		switch node.byteSize {
+		case 1:
+			dst = append(dst, byte(value))
+		case 2:
+			dst = binary.BigEndian.AppendUint16(dst, uint16(value))
+		case 4:
+			dst = binary.BigEndian.AppendUint32(dst, uint32(value))
+		default:
+			dst = binary.BigEndian.AppendUint64(dst, uint64(value))
 		}
 	}
 
-	return result
+	return dst
+}
+
+// typ returns the type name used by getDataByteLength and getFormatCode.
+func (node *UintNode) typ() string {
+	switch node.byteSize {
+	case 1:
+		return "u1"
+	case 2:
+		return "u2"
+	case 4:
+		return "u4"
+	default:
+		return "u8"
+	}
 }
 
 // String returns the string representation of the node.
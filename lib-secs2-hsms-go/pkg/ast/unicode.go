@@ -0,0 +1,191 @@
+package ast
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// CharsetUCS2 is the character set code of 2-byte character data items that
+// hold UCS-2 (UTF-16BE) characters; it precedes the characters in the item.
+const CharsetUCS2 = 1
+
+// UnsupportedCharsetError is returned by UnicodeNode.Values for 2-byte
+// character data in a character set other than CharsetUCS2.
+type UnsupportedCharsetError struct {
+	Charset int
+}
+
+func (e *UnsupportedCharsetError) Error() string {
+	return fmt.Sprintf("unsupported character set %d", e.Charset)
+}
+
+// UnicodeNode is a immutable data type that represents a 2-byte character string
+// in a SECS-II message. Implements ItemNode.
+//
+// It contains a Go string, which is encoded as the character set code
+// CharsetUCS2 followed by the UTF-16BE code units of the string.
+// The size of UnicodeNode is the number of UTF-16 code units.
+//
+// Received data in another character set is kept as is: Values returns an
+// *UnsupportedCharsetError, Charset and Data return the raw item, and the
+// node encodes back to the same bytes. Its size is the number of data bytes.
+type UnicodeNode struct {
+	value   string   // text
+	encoded []uint16 // UTF-16 code units of value
+	charset int
+	raw     []byte // characters in charset, when it is not CharsetUCS2
+
+	symbol string
+	// Rep invariants
+	// - charset == CharsetUCS2: encoded is the UTF-16 encoding of value, raw is nil
+	// - otherwise value and encoded are empty
+}
+
+// Factory methods
+
+// NewUnicodeNode creates a new UnicodeNode that contains the input string.
+func NewUnicodeNode(str string) ItemNode {
+	return newUnicodeNode(str, utf16.Encode([]rune(str)))
+}
+
+// NewUnicodeNodeFromBytes creates a new UnicodeNode from the data of a SECS-II
+// 2-byte character item, i.e. the character set code followed by the characters.
+// Only CharsetUCS2 is decoded; data in another character set is kept raw.
+// Empty data is an empty string.
+func NewUnicodeNodeFromBytes(data []byte) ItemNode {
+	if len(data) == 0 {
+		return NewUnicodeNode("")
+	}
+	if len(data) < 2 {
+		panic("2-byte character data should have a length of at least 2")
+	}
+	if charset := int(binary.BigEndian.Uint16(data)); charset != CharsetUCS2 {
+		if len(data) > MAX_BYTE_SIZE {
+			panic("string length limit exceeded")
+		}
+		raw := append([]byte(nil), data[2:]...)
+		return &UnicodeNode{charset: charset, raw: raw, symbol: "unicode"}
+	}
+	if len(data)%2 != 0 {
+		panic("UCS-2 character data should have an even length")
+	}
+
+	encoded := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i < len(data); i += 2 {
+		encoded = append(encoded, binary.BigEndian.Uint16(data[i:]))
+	}
+	return newUnicodeNode(string(utf16.Decode(encoded)), encoded)
+}
+
+func newUnicodeNode(value string, encoded []uint16) ItemNode {
+	if 2+getDataByteLength("unicode", len(encoded)) > MAX_BYTE_SIZE {
+		panic("string length limit exceeded")
+	}
+	return &UnicodeNode{value: value, encoded: encoded, charset: CharsetUCS2, symbol: "unicode"}
+}
+
+// Public methods
+
+// Values returns the string, or an *UnsupportedCharsetError when the node
+// holds data in a character set other than CharsetUCS2.
+func (node *UnicodeNode) Values() interface{} {
+	if node.charset != CharsetUCS2 {
+		return &UnsupportedCharsetError{Charset: node.charset}
+	}
+	return node.value
+}
+
+// Charset returns the character set code of the node.
+func (node *UnicodeNode) Charset() int {
+	return node.charset
+}
+
+// Data returns the characters as encoded in Charset, without the character
+// set code.
+func (node *UnicodeNode) Data() []byte {
+	if node.charset != CharsetUCS2 {
+		return append([]byte(nil), node.raw...)
+	}
+	data := make([]byte, 0, 2*len(node.encoded))
+	for _, unit := range node.encoded {
+		data = binary.BigEndian.AppendUint16(data, unit)
+	}
+	return data
+}
+
+func (node *UnicodeNode) Type() string {
+	return node.symbol
+}
+
+func (node *UnicodeNode) Get(indices ...int) (ItemNode, error) {
+	if len(indices) == 0 {
+		return node, nil
+	} else {
+		return nil, fmt.Errorf("not list, node is %s, indices is %v", node, indices)
+	}
+}
+
+// Size implements ItemNode.Size().
+func (node *UnicodeNode) Size() int {
+	if node.charset != CharsetUCS2 {
+		return len(node.raw)
+	}
+	return len(node.encoded)
+}
+
+// dataLength returns the length of the item data, character set code included.
+func (node *UnicodeNode) dataLength() int {
+	if node.charset != CharsetUCS2 {
+		return 2 + len(node.raw)
+	}
+	return 2 + getDataByteLength("unicode", len(node.encoded))
+}
+
+// Variables implements ItemNode.Variables().
+func (node *UnicodeNode) Variables() []string {
+	return []string{}
+}
+
+// FillVariables implements ItemNode.FillVariables().
+func (node *UnicodeNode) FillVariables(values map[string]interface{}) ItemNode {
+	return node
+}
+
+// ToBytes implements ItemNode.ToBytes()
+func (node *UnicodeNode) ToBytes() []byte {
+	return node.AppendBytes(make([]byte, 0, node.EncodedLength()))
+}
+
+// EncodedLength implements ItemNode.EncodedLength()
+func (node *UnicodeNode) EncodedLength() int {
+	return getItemLength(node.dataLength())
+}
+
+// AppendBytes implements ItemNode.AppendBytes()
+func (node *UnicodeNode) AppendBytes(dst []byte) []byte {
+	dst, err := appendItemHeader(dst, "unicode", node.dataLength())
+	if err != nil {
+		return dst
+	}
+
+	dst = binary.BigEndian.AppendUint16(dst, uint16(node.charset))
+	if node.charset != CharsetUCS2 {
+		return append(dst, node.raw...)
+	}
+	for _, unit := range node.encoded {
+		dst = binary.BigEndian.AppendUint16(dst, unit)
+	}
+	return dst
+}
+
+// String returns the string representation of the node.
+func (node *UnicodeNode) String() string {
+	if node.charset != CharsetUCS2 {
+		return fmt.Sprintf("<W[%d] /* character set %d */>", len(node.raw), node.charset)
+	}
+	if node.value == "" {
+		return "<W[0]>"
+	}
+	return fmt.Sprintf(`<W%s>`, textLiteral(node.value))
+}
@@ -0,0 +1,101 @@
+package ast
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Testing Strategy:
+//
+// Create a new instance using the factory methods, and test the result of
+// public observer methods Size(), Values(), ToBytes(), and String().
+//
+// Partitions:
+//
+// - Length of the string: 0, 1, ...
+// - Characters: ASCII, BMP, supplementary (surrogate pair)
+// - Factory method: NewUnicodeNode, NewUnicodeNodeFromBytes
+// - Invalid bytes: odd length, unsupported character set
+
+func TestUnicodeNode(t *testing.T) {
+	var tests = []struct {
+		description     string // Test case description
+		input           string // Input to the factory method
+		expectedSize    int    // expected result from Size()
+		expectedToBytes []byte // expected result from ToBytes()
+		expectedString  string // expected result from String()
+	}{
+		{
+			description:     "Length: 0",
+			input:           "",
+			expectedSize:    0,
+			expectedToBytes: []byte{0x49, 2, 0, 1},
+			expectedString:  `<W[0]>`,
+		},
+		{
+			description:     "ASCII character",
+			input:           "A",
+			expectedSize:    1,
+			expectedToBytes: []byte{0x49, 4, 0, 1, 0, 0x41},
+			expectedString:  `<W "A">`,
+		},
+		{
+			description:     "Hangul and kanji",
+			input:           "한日",
+			expectedSize:    2,
+			expectedToBytes: []byte{0x49, 6, 0, 1, 0xD5, 0x5C, 0x65, 0xE5},
+			expectedString:  `<W "한日">`,
+		},
+		{
+			description:     "Surrogate pair",
+			input:           "😀",
+			expectedSize:    2,
+			expectedToBytes: []byte{0x49, 6, 0, 1, 0xD8, 0x3D, 0xDE, 0x00},
+			expectedString:  `<W "😀">`,
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test #%d: %s", i, test.description)
+		node := NewUnicodeNode(test.input)
+		assert.Equal(t, test.expectedSize, node.Size())
+		assert.Equal(t, test.input, node.Values())
+		assert.Equal(t, "unicode", node.Type())
+		assert.Equal(t, []string{}, node.Variables())
+		assert.Equal(t, test.expectedToBytes, node.ToBytes())
+		assert.Equal(t, len(test.expectedToBytes), node.EncodedLength())
+		assert.Equal(t, test.expectedString, fmt.Sprint(node))
+
+		fromBytes := NewUnicodeNodeFromBytes(test.expectedToBytes[2:])
+		assert.Equal(t, test.input, fromBytes.Values())
+		assert.Equal(t, test.expectedToBytes, fromBytes.ToBytes())
+	}
+}
+
+func TestUnicodeNodeFromBytes(t *testing.T) {
+	// Without the character set code, the item is an empty string
+	assert.Equal(t, "", NewUnicodeNodeFromBytes(nil).Values())
+
+	assert.Panics(t, func() { NewUnicodeNodeFromBytes([]byte{0}) })
+	assert.Panics(t, func() { NewUnicodeNodeFromBytes([]byte{0, 1, 0}) })
+
+	// Another character set is kept raw and only fails in Values
+	data := []byte{0, 2, 'U', 'T', 'F'}
+	node := NewUnicodeNodeFromBytes(data).(*UnicodeNode)
+	var charsetErr *UnsupportedCharsetError
+	err, ok := node.Values().(error)
+	assert.True(t, ok)
+	assert.ErrorAs(t, err, &charsetErr)
+	assert.Equal(t, 2, charsetErr.Charset)
+	assert.Equal(t, 2, node.Charset())
+	assert.Equal(t, []byte("UTF"), node.Data())
+	assert.Equal(t, 3, node.Size())
+	assert.Equal(t, append([]byte{0x49, 5}, data...), node.ToBytes())
+	assert.Equal(t, 7, node.EncodedLength())
+	assert.Equal(t, "<W[3] /* character set 2 */>", node.String())
+
+	ucs2 := NewUnicodeNode("A").(*UnicodeNode)
+	assert.Equal(t, CharsetUCS2, ucs2.Charset())
+	assert.Equal(t, []byte{0, 0x41}, ucs2.Data())
+}
@@ -0,0 +1,359 @@
+package hsms
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// ErrMalformed is wrapped by the errors Decoder and ReadMessage return for
+// message text that is not valid SECS-II. Other errors come from the reader.
+var ErrMalformed = errors.New("malformed SECS-II message")
+
+// chunkSize is the number of value bytes the decoder reads at a time.
+const chunkSize = 512
+
+// Decoder reads SECS-II items straight from a stream, so a message does not
+// have to be buffered before it is parsed. It never reads more than the
+// message text length given to NewDecoder, and item lengths larger than the
+// remaining text are rejected before anything is allocated for them.
+type Decoder struct {
+	r         io.Reader
+	remaining int
+	depth     int // number of lists being decoded
+	chunk     [chunkSize]byte
+}
+
+// NewDecoder returns a decoder for message text of length bytes read from r.
+func NewDecoder(r io.Reader, length int) *Decoder {
+	return &Decoder{r: r, remaining: length}
+}
+
+// Remaining returns the number of message text bytes not read yet.
+func (d *Decoder) Remaining() int {
+	return d.remaining
+}
+
+// Skip discards the rest of the message text.
+func (d *Decoder) Skip() error {
+	n, err := io.CopyN(io.Discard, d.r, int64(d.remaining))
+	d.remaining -= int(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func malformed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+}
+
+// read fills b from the message text.
+func (d *Decoder) read(b []byte) error {
+	if len(b) > d.remaining {
+		return malformed("item exceeds message length")
+	}
+	n, err := io.ReadFull(d.r, b)
+	d.remaining -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Decode reads the next item.
+func (d *Decoder) Decode() (item ast.ItemNode, err error) {
+	// Handle panics on abstract syntax tree creation
+	defer func() {
+		if r := recover(); r != nil {
+			item, err = ast.NewEmptyItemNode(), malformed("%v", r)
+		}
+	}()
+
+	var head [4]byte
+	if err := d.read(head[:1]); err != nil {
+		return ast.NewEmptyItemNode(), err
+	}
+	formatCode := head[0] >> 2
+	lengthBytesCount := int(head[0] & 0b00000011)
+	if lengthBytesCount == 0 {
+		return ast.NewEmptyItemNode(), malformed("item without length bytes")
+	}
+	if err := d.read(head[1 : 1+lengthBytesCount]); err != nil {
+		return ast.NewEmptyItemNode(), err
+	}
+	var length int
+	for _, b := range head[1 : 1+lengthBytesCount] {
+		length = length<<8 | int(b)
+	}
+
+	switch formatCode {
+	case formatCodeList:
+		// Every item takes at least two bytes.
+		if length > d.remaining/2 {
+			return ast.NewEmptyItemNode(), malformed("list of %d items exceeds message length", length)
+		}
+		if d.depth >= ast.MaxListDepth {
+			return ast.NewEmptyItemNode(), malformed("lists nested deeper than %d", ast.MaxListDepth)
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+		values := make([]interface{}, length)
+		for i := range values {
+			if values[i], err = d.Decode(); err != nil {
+				return ast.NewEmptyItemNode(), err
+			}
+		}
+		return ast.NewListNode(values...), nil
+
+	case formatCodeASCII:
+		if err := d.checkLength(1, length); err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		var sb strings.Builder
+		sb.Grow(length)
+		err := d.each(1, length, func(b []byte) {
+			for _, v := range b {
+				// Matches Parse, which decodes every byte as one rune.
+				sb.WriteRune(rune(v))
+			}
+		})
+		if err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		return ast.NewASCIINode(sb.String()), nil
+
+	case formatCodeJIS8:
+		data, err := d.bytes(length)
+		if err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		return ast.NewJIS8NodeFromBytes(data), nil
+
+	case formatCodeUnicode:
+		data, err := d.bytes(length)
+		if err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		return ast.NewUnicodeNodeFromBytes(data), nil
+
+	case formatCodeBinary:
+		values, err := d.values(1, length, func(b []byte) interface{} { return b[0] })
+		if err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		return ast.NewBinaryNode(values...), nil
+
+	case formatCodeBoolean:
+		values, err := d.values(1, length, func(b []byte) interface{} { return b[0] != 0 })
+		if err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		return ast.NewBooleanNode(values...), nil
+
+	case formatCodeF4:
+		values, err := d.values(4, length, func(b []byte) interface{} {
+			return math.Float32frombits(binary.BigEndian.Uint32(b))
+		})
+		if err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		return ast.NewFloatNode(4, values...), nil
+	case formatCodeF8:
+		values, err := d.values(8, length, func(b []byte) interface{} {
+			return math.Float64frombits(binary.BigEndian.Uint64(b))
+		})
+		if err != nil {
+			return ast.NewEmptyItemNode(), err
+		}
+		return ast.NewFloatNode(8, values...), nil
+
+	case formatCodeI1:
+		return d.intNode(1, length, func(b []byte) interface{} { return int8(b[0]) })
+	case formatCodeI2:
+		return d.intNode(2, length, func(b []byte) interface{} { return int16(binary.BigEndian.Uint16(b)) })
+	case formatCodeI4:
+		return d.intNode(4, length, func(b []byte) interface{} { return int32(binary.BigEndian.Uint32(b)) })
+	case formatCodeI8:
+		return d.intNode(8, length, func(b []byte) interface{} { return int64(binary.BigEndian.Uint64(b)) })
+
+	case formatCodeU1:
+		return d.uintNode(1, length, func(b []byte) interface{} { return b[0] })
+	case formatCodeU2:
+		return d.uintNode(2, length, func(b []byte) interface{} { return binary.BigEndian.Uint16(b) })
+	case formatCodeU4:
+		return d.uintNode(4, length, func(b []byte) interface{} { return binary.BigEndian.Uint32(b) })
+	case formatCodeU8:
+		return d.uintNode(8, length, func(b []byte) interface{} { return binary.BigEndian.Uint64(b) })
+
+	default:
+		return ast.NewEmptyItemNode(), malformed("unknown format code %#o", formatCode)
+	}
+}
+
+// checkLength validates an item of length bytes holding byteSize byte values.
+func (d *Decoder) checkLength(byteSize, length int) error {
+	if length%byteSize != 0 {
+		return malformed("item length %d is not a multiple of %d", length, byteSize)
+	}
+	if length > d.remaining {
+		return malformed("item exceeds message length")
+	}
+	return nil
+}
+
+// each reads length bytes in chunks of whole values of byteSize bytes.
+func (d *Decoder) each(byteSize, length int, fn func([]byte)) error {
+	if err := d.checkLength(byteSize, length); err != nil {
+		return err
+	}
+	step := chunkSize - chunkSize%byteSize
+	for length > 0 {
+		n := min(step, length)
+		if err := d.read(d.chunk[:n]); err != nil {
+			return err
+		}
+		fn(d.chunk[:n])
+		length -= n
+	}
+	return nil
+}
+
+// bytes reads the length bytes of a text item.
+func (d *Decoder) bytes(length int) ([]byte, error) {
+	if err := d.checkLength(1, length); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	return data, d.read(data)
+}
+
+// values decodes length bytes into values of byteSize bytes each.
+func (d *Decoder) values(byteSize, length int, decode func([]byte) interface{}) ([]interface{}, error) {
+	if err := d.checkLength(byteSize, length); err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, 0, length/byteSize)
+	err := d.each(byteSize, length, func(b []byte) {
+		for i := 0; i < len(b); i += byteSize {
+			values = append(values, decode(b[i:i+byteSize]))
+		}
+	})
+	return values, err
+}
+
+func (d *Decoder) intNode(byteSize, length int, decode func([]byte) interface{}) (ast.ItemNode, error) {
+	values, err := d.values(byteSize, length, decode)
+	if err != nil {
+		return ast.NewEmptyItemNode(), err
+	}
+	return ast.NewIntNode(byteSize, values...), nil
+}
+
+func (d *Decoder) uintNode(byteSize, length int, decode func([]byte) interface{}) (ast.ItemNode, error) {
+	values, err := d.values(byteSize, length, decode)
+	if err != nil {
+		return ast.NewEmptyItemNode(), err
+	}
+	return ast.NewUintNode(byteSize, values...), nil
+}
+
+// ReadMessage decodes a message whose 10 byte header has already been read.
+// The message text, length bytes, is read from r. Unless r fails, exactly
+// length bytes are consumed, also when the message is malformed, so the
+// next message can be read from r.
+func ReadMessage(header []byte, r io.Reader, length int) (ast.HSMSMessage, error) {
+	d := NewDecoder(r, length)
+	msg, err := decodeMessage(header, length, func() (ast.ItemNode, error) {
+		item, err := d.Decode()
+		if err == nil && d.remaining > 0 {
+			err = malformed("%d bytes after the data item", d.remaining)
+		}
+		return item, err
+	})
+	if err != nil && errors.Is(err, ErrMalformed) {
+		if skipErr := d.Skip(); skipErr != nil {
+			return nil, skipErr
+		}
+	}
+	return msg, err
+}
+
+// ReadLazyMessage is like ReadMessage, but reads the message text into memory
+// and gives data messages an ast.LazyItem, which decodes values on access.
+func ReadLazyMessage(header []byte, r io.Reader, length int) (ast.HSMSMessage, error) {
+	text := make([]byte, length)
+	if _, err := io.ReadFull(r, text); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return lazyMessage(header, text)
+}
+
+// ParseLazy parses the input bytes that represent a HSMS message, like Parse,
+// but the data item of a data message is an ast.LazyItem sharing input.
+//
+// If parsing fails, ok == false will be returned.
+func ParseLazy(input []byte) (msg ast.HSMSMessage, ok bool) {
+	if len(input) < 14 || int(binary.BigEndian.Uint32(input)) != len(input)-4 {
+		return nil, false
+	}
+	msg, err := lazyMessage(input[4:14], input[14:])
+	return msg, err == nil
+}
+
+func lazyMessage(header, text []byte) (ast.HSMSMessage, error) {
+	return decodeMessage(header, len(text), func() (ast.ItemNode, error) {
+		item, err := ast.NewLazyItem(text)
+		if err != nil {
+			return ast.NewEmptyItemNode(), fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		return item, nil
+	})
+}
+
+// decodeMessage creates the message for header; decodeItem is called for the
+// data item of a data message with text.
+func decodeMessage(header []byte, length int, decodeItem func() (ast.ItemNode, error)) (ast.HSMSMessage, error) {
+	if len(header) != 10 {
+		return nil, malformed("header of %d bytes", len(header))
+	}
+	if header[4] != 0 { // PType
+		return nil, malformed("not a SECS-II message, PType %d", header[4])
+	}
+
+	switch header[5] { // SType
+	case sTypeDataMessage:
+		stream := int(header[2] & 0b01111111)
+		function := int(header[3])
+		waitBit := int(header[2] >> 7)
+		sessionID := int(binary.BigEndian.Uint16(header[:2]))
+		systemBytes := append([]byte(nil), header[6:10]...)
+
+		dataItem := ast.NewEmptyItemNode()
+		if length > 0 {
+			var err error
+			if dataItem, err = decodeItem(); err != nil {
+				return nil, err
+			}
+		}
+		return ast.NewHSMSDataMessage("", stream, function, waitBit, "H<->E", dataItem, sessionID, systemBytes), nil
+
+	case sTypeSelectReq, sTypeSelectRsp, sTypeDeselectReq, sTypeDeselectRsp,
+		sTypeLinktestReq, sTypeLinktestRsp, sTypeRejectReq, sTypeSeparateReq:
+		if length > 0 {
+			return nil, malformed("control message with %d bytes of text", length)
+		}
+		return ast.NewHSMSControlMessage(header), nil
+
+	default:
+		return nil, malformed("undefined SType %d", header[5])
+	}
+}
@@ -0,0 +1,186 @@
+package hsms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// Tests the streaming decoder
+//
+// Testing Strategy:
+//
+// Encode messages with the ast package and decode them with ReadMessage;
+// the result must match Parse. Malformed text must fail with ErrMalformed
+// and leave the reader at the end of the message; a short stream must fail
+// with io.ErrUnexpectedEOF.
+
+// readFrame decodes a complete HSMS frame with ReadMessage.
+func readFrame(frame []byte, r io.Reader) (ast.HSMSMessage, error) {
+	return ReadMessage(frame[4:14], r, len(frame)-14)
+}
+
+func TestReadMessage_MatchesParse(t *testing.T) {
+	items := []ast.ItemNode{
+		ast.NewEmptyItemNode(),
+		ast.NewListNode(),
+		ast.NewASCIINode(strings.Repeat("recipe body ", 100)),
+		ast.NewJIS8Node("レシピ ABC"),
+		ast.NewUnicodeNode("레시피 😀"),
+		ast.NewUnicodeNode(""),
+		ast.NewListNode(ast.NewUnicodeNodeFromBytes([]byte{0, 2, 'U', 'T', 'F'}), ast.NewUintNode(4, 1)),
+		ast.NewBinaryNode(0, 1, 255),
+		ast.NewBooleanNode(true, false),
+		ast.NewIntNode(1, -128, 127),
+		ast.NewIntNode(2, -32768, 32767),
+		ast.NewIntNode(4, -1, 1),
+		ast.NewIntNode(8, -1, 1),
+		ast.NewUintNode(1, 0, 255),
+		ast.NewUintNode(2, 65535),
+		ast.NewUintNode(4, 1, 2, 3),
+		ast.NewUintNode(8, 1),
+		ast.NewFloatNode(4, 1.5, -2.25),
+		ast.NewFloatNode(8, 3.125),
+		ast.NewListNode(
+			ast.NewUintNode(4, 1001),
+			ast.NewListNode(ast.NewASCIINode("nested"), ast.NewBinaryNode(1)),
+		),
+	}
+	for _, item := range items {
+		frame := ast.NewHSMSDataMessage("", 6, 11, 1, "H<->E", item, 1, []byte{0, 0, 0, 7}).ToBytes()
+		want, ok := Parse(frame)
+		assert.True(t, ok)
+
+		r := bytes.NewReader(frame[14:])
+		got, err := readFrame(frame, r)
+		assert.NoError(t, err)
+		assert.Equal(t, want.(*ast.DataMessage).String(), got.(*ast.DataMessage).String())
+		assert.Equal(t, frame, got.ToBytes())
+		assert.Zero(t, r.Len())
+	}
+}
+
+func TestReadMessage_LargeList(t *testing.T) {
+	values := make([]interface{}, 20000)
+	for i := range values {
+		values[i] = ast.NewUintNode(4, i)
+	}
+	frame := ast.NewHSMSDataMessage("", 6, 11, 0, "H<->E", ast.NewListNode(values...), 1, []byte{0, 0, 0, 1}).ToBytes()
+
+	got, err := readFrame(frame, bytes.NewReader(frame[14:]))
+	assert.NoError(t, err)
+	assert.Equal(t, 20000, itemSize(t, got))
+}
+
+func TestReadMessage_ControlMessage(t *testing.T) {
+	frame := ast.NewHSMSMessageLinktestReq([]byte{0, 0, 0, 9}).ToBytes()
+	got, err := readFrame(frame, bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, LinktestReqStr, got.Type())
+}
+
+func TestReadMessage_Malformed(t *testing.T) {
+	header := []byte{0, 1, 0x86, 11, 0, 0, 0, 0, 0, 1}
+	tests := []struct {
+		description string
+		header      []byte
+		text        []byte
+	}{
+		{"list longer than the message", header, []byte{0o01, 200, 0o245, 1, 1}},
+		{"item longer than the message", header, []byte{0o101, 200, 'a'}},
+		{"item without length bytes", header, []byte{0o100, 'a'}},
+		{"unknown format code", header, []byte{0o175, 1, 0}},
+		{"uneven U4 length", header, []byte{0o261, 3, 0, 0, 1}},
+		{"W item without its character set", header, []byte{0o111, 1, 0}},
+		{"bytes after the item", header, []byte{0o245, 1, 1, 0xFF}},
+		{"text after a control message", []byte{0xFF, 0xFF, 0, 0, 0, 5, 0, 0, 0, 1}, []byte{1}},
+		{"undefined SType", []byte{0, 0, 0, 0, 0, 8, 0, 0, 0, 1}, nil},
+	}
+	for _, tt := range tests {
+		next := []byte{0xAA}
+		r := bytes.NewReader(append(append([]byte(nil), tt.text...), next...))
+		_, err := ReadMessage(tt.header, r, len(tt.text))
+		assert.True(t, errors.Is(err, ErrMalformed), "%s: %v", tt.description, err)
+		assert.Equal(t, 1, r.Len(), "%s: message not consumed", tt.description)
+	}
+}
+
+// nestedLists returns the message text of depth lists nested in each other.
+func nestedLists(depth int) []byte {
+	text := make([]byte, 0, 2*depth)
+	for i := 1; i < depth; i++ {
+		text = append(text, 0o001, 1)
+	}
+	return append(text, 0o001, 0)
+}
+
+func TestReadMessage_DeepNesting(t *testing.T) {
+	header := []byte{0, 1, 0x86, 11, 0, 0, 0, 0, 0, 1}
+
+	text := nestedLists(ast.MaxListDepth)
+	_, err := ReadMessage(header, bytes.NewReader(text), len(text))
+	assert.NoError(t, err)
+
+	// About 14 MiB of L[1] items, under the default max message size,
+	// would overflow the stack without the limit.
+	for _, depth := range []int{ast.MaxListDepth + 1, 7 << 20} {
+		text := nestedLists(depth)
+		r := bytes.NewReader(append(text, 0xAA))
+		_, err := ReadMessage(header, r, len(text))
+		assert.True(t, errors.Is(err, ErrMalformed), "depth %d: %v", depth, err)
+		assert.Equal(t, 1, r.Len(), "depth %d: message not consumed", depth)
+
+		frame := ast.NewHSMSDataMessage("", 6, 11, 1, "H<->E", ast.NewEmptyItemNode(), 1, []byte{0, 0, 0, 1}).ToBytes()
+		frame = append(frame, text...)
+		binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+		_, ok := Parse(frame)
+		assert.False(t, ok, "depth %d", depth)
+	}
+}
+
+func TestReadMessage_ShortStream(t *testing.T) {
+	frame := ast.NewHSMSDataMessage("", 1, 2, 0, "H<->E", ast.NewASCIINode("online"), 1, []byte{0, 0, 0, 1}).ToBytes()
+	_, err := readFrame(frame, bytes.NewReader(frame[14:len(frame)-2]))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func itemSize(t *testing.T, msg ast.HSMSMessage) int {
+	item, err := msg.(*ast.DataMessage).Get()
+	assert.NoError(t, err)
+	return item.Size()
+}
+
+func TestParseLazy(t *testing.T) {
+	item := ast.NewListNode(ast.NewUintNode(4, 1001), ast.NewListNode(ast.NewASCIINode("nested")))
+	frame := ast.NewHSMSDataMessage("", 6, 11, 1, "H<->E", item, 1, []byte{0, 0, 0, 7}).ToBytes()
+	want, _ := Parse(frame)
+
+	got, ok := ParseLazy(frame)
+	assert.True(t, ok)
+	lazy, err := got.(*ast.DataMessage).Get()
+	assert.NoError(t, err)
+	assert.IsType(t, &ast.LazyItem{}, lazy)
+	assert.Equal(t, want.(*ast.DataMessage).String(), got.(*ast.DataMessage).String())
+	assert.Equal(t, frame, got.ToBytes())
+
+	r := bytes.NewReader(frame[14:])
+	got, err = ReadLazyMessage(frame[4:14], r, len(frame)-14)
+	assert.NoError(t, err)
+	assert.Equal(t, frame, got.ToBytes())
+
+	control := ast.NewHSMSMessageLinktestReq([]byte{0, 0, 0, 9}).ToBytes()
+	got, ok = ParseLazy(control)
+	assert.True(t, ok)
+	assert.Equal(t, LinktestReqStr, got.Type())
+
+	_, ok = ParseLazy(frame[:len(frame)-1])
+	assert.False(t, ok)
+	_, err = ReadLazyMessage(frame[4:14], bytes.NewReader([]byte{0o001, 200, 0, 0}), 4)
+	assert.ErrorIs(t, err, ErrMalformed)
+}
@@ -32,6 +32,8 @@ const (
 	formatCodeBinary  = 0o10
 	formatCodeBoolean = 0o11
 	formatCodeASCII   = 0o20
+	formatCodeJIS8    = 0o21
+	formatCodeUnicode = 0o22
 	formatCodeI8      = 0o30
 	formatCodeI1      = 0o31
 	formatCodeI2      = 0o32
@@ -70,6 +72,7 @@ func Parse(input []byte) (msg ast.HSMSMessage, ok bool) {
 type parser struct {
 	input     []byte          // a HSMS input message in bytes
 	pos       int             // current position in input
+	depth     int             // number of lists being parsed
 	msgLength int             // message length (excluding length bytes)
 	msg       ast.HSMSMessage // parsed HSMS message
 }
@@ -143,12 +146,16 @@ func (p *parser) parseMessageText() (dataItem ast.ItemNode, ok bool) {
 	var length int
 	for i, b := range lengthBytes {
 		shift := (lengthBytesCount - i - 1) * 8
-		length += int(b << shift)
+		length += int(b) << shift
 	}
 	p.pos += lengthBytesCount
 
 	switch formatCode {
 	case formatCodeList:
+		if p.depth >= ast.MaxListDepth {
+			return ast.NewEmptyItemNode(), false
+		}
+		p.depth++
 		values := make([]interface{}, length)
 		for i := 0; i < length; i++ {
 			values[i], ok = p.parseMessageText()
@@ -156,6 +163,7 @@ func (p *parser) parseMessageText() (dataItem ast.ItemNode, ok bool) {
 				return ast.NewEmptyItemNode(), false
 			}
 		}
+		p.depth--
 		return ast.NewListNode(values...), true
 
 	case formatCodeASCII:
@@ -166,6 +174,16 @@ func (p *parser) parseMessageText() (dataItem ast.ItemNode, ok bool) {
 		p.pos += length
 		return ast.NewASCIINode(str), true
 
+	case formatCodeJIS8:
+		data := p.input[p.pos : p.pos+length]
+		p.pos += length
+		return ast.NewJIS8NodeFromBytes(data), true
+
+	case formatCodeUnicode:
+		data := p.input[p.pos : p.pos+length]
+		p.pos += length
+		return ast.NewUnicodeNodeFromBytes(data), true
+
 	case formatCodeBinary:
 		values := make([]interface{}, length)
 		for i, v := range p.input[p.pos : p.pos+length] {
@@ -2,6 +2,7 @@ package hsms
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -202,6 +203,18 @@ func TestParser_DataMessage(t *testing.T) {
 	}
 }
 
+func TestParser_MultiByteLength(t *testing.T) {
+	text := strings.Repeat("a", 600)
+	input := ast.NewHSMSDataMessage("", 1, 1, 0, "H<-E", ast.NewASCIINode(text), 0, []byte{0, 0, 0, 1}).ToBytes()
+
+	msg, ok := Parse(input)
+	assert.True(t, ok)
+	assert.Equal(t, input, msg.ToBytes())
+	value, err := msg.(*ast.DataMessage).GetAscii()
+	assert.NoError(t, err)
+	assert.Equal(t, text, value)
+}
+
 func TestParser_ControlMessage(t *testing.T) {
 	var tests = []struct {
 		input        []byte // input to the parser
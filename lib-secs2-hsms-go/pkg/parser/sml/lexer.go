@@ -266,7 +266,7 @@ func lexMessageText(l *lexer) stateFn {
 		re = regexp.MustCompile(`^[A-Za-z_]\w*`)
 		if loc := re.FindStringIndex(l.input[l.pos:]); loc != nil {
 			switch strings.ToUpper(l.input[l.pos : l.pos+loc[1]]) {
-			case "L", "A", "B", "BOOLEAN", "F4", "F8",
+			case "L", "A", "J", "W", "B", "BOOLEAN", "F4", "F8",
 				"I1", "I2", "I4", "I8", "U1", "U2", "U4", "U8":
 				l.pos += loc[1]
 				l.emitUppercase(tokenTypeDataItemType)
@@ -162,6 +162,14 @@ func TestLexer_DataType(t *testing.T) {
 			input:    "f8",
 			expected: []token{{tokenTypeDataItemType, "F8", 1, 1}},
 		},
+		{
+			input:    "j",
+			expected: []token{{tokenTypeDataItemType, "J", 1, 1}},
+		},
+		{
+			input:    "W",
+			expected: []token{{tokenTypeDataItemType, "W", 1, 1}},
+		},
 	}
 	for _, test := range tests {
 		tokens := doLex(test.input, lexMessageText)
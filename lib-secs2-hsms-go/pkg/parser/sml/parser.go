@@ -5,8 +5,10 @@ import (
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"golang.org/x/text/encoding/japanese"
 )
 
 // Parse parses the input string, and return parsed message nodes and parsing errors/warnings.
@@ -253,6 +255,10 @@ func (p *parser) parseDataItem() (item ast.ItemNode, ok bool) {
 		item, ok = p.parseList()
 	case "A":
 		item, ok = p.parseASCII(sizeStart, sizeEnd)
+	case "J":
+		item, ok = p.parseJIS8()
+	case "W":
+		item, ok = p.parseUnicode()
 	case "B":
 		item, ok = p.parseBinary()
 	case "BOOLEAN":
@@ -272,7 +278,12 @@ func (p *parser) parseDataItem() (item ast.ItemNode, ok bool) {
 	case "U1":
 		item, ok = p.parseUint1()
 	case "U2":
-		item, ok = p.parseUint2()
+		// U2 is also used for 2-byte character strings, e.g. <U2 "text">
+		if p.peek().typ == tokenTypeQuotedString {
+			item, ok = p.parseUnicode()
+		} else {
+			item, ok = p.parseUint2()
+		}
 	case "U4":
 		item, ok = p.parseUint4()
 	case "U8":
@@ -471,6 +482,90 @@ func (p *parser) parseASCII(minLength, maxLength int) (item ast.ItemNode, ok boo
 	return ast.NewASCIINode(literal), true
 }
 
+// parseJIS8 parses a JIS-8 data item.
+// Number codes are single-byte JIS-8 characters.
+// Returns ok == false when unexpected token is found, to stop parsing the message.
+// When some non-critical errors occurred, parsed values might be changed to
+// correct the error and continue parsing. The non-critical error will be
+// handled at the end of the parsing operation.
+func (p *parser) parseJIS8() (item ast.ItemNode, ok bool) {
+	var encoded []byte
+
+	for _, t := range p.getDataItemValueTokens() {
+		switch t.typ {
+		case tokenTypeQuotedString:
+			val, _ := strconv.Unquote(t.val)
+			b, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(val))
+			if err != nil {
+				p.errorf(t, "expected JIS-8 characters, found %s", t.val)
+			}
+			encoded = append(encoded, b...)
+
+		case tokenTypeNumber:
+			val, err := strconv.ParseUint(t.val, 0, 8)
+			if err != nil || (val > unicode.MaxASCII && !(0xA1 <= val && val <= 0xDF)) {
+				val = 0
+				p.errorf(t, "expected JIS-8 character code, found %q", t.val)
+			}
+			encoded = append(encoded, byte(val))
+
+		case tokenTypeVariable:
+			p.errorf(t, "variable is not supported in JIS-8 data item")
+			return ast.NewEmptyItemNode(), false
+
+		case tokenTypeError:
+			p.errorf(t, "syntax error: %s", t.val)
+			return ast.NewEmptyItemNode(), false
+
+		default:
+			p.errorf(t, "expected quoted string or JIS-8 character code, found %q", t.val)
+			return ast.NewEmptyItemNode(), false
+		}
+	}
+
+	return ast.NewJIS8NodeFromBytes(encoded), true
+}
+
+// parseUnicode parses a 2-byte character data item, written as <W ...> or <U2 "...">.
+// Number codes are Unicode code points.
+// Returns ok == false when unexpected token is found, to stop parsing the message.
+// When some non-critical errors occurred, parsed values might be changed to
+// correct the error and continue parsing. The non-critical error will be
+// handled at the end of the parsing operation.
+func (p *parser) parseUnicode() (item ast.ItemNode, ok bool) {
+	var literal string
+
+	for _, t := range p.getDataItemValueTokens() {
+		switch t.typ {
+		case tokenTypeQuotedString:
+			val, _ := strconv.Unquote(t.val)
+			literal += val
+
+		case tokenTypeNumber:
+			val, err := strconv.ParseUint(t.val, 0, 32)
+			if err != nil || !utf8.ValidRune(rune(val)) {
+				val = 0
+				p.errorf(t, "expected Unicode code point, found %q", t.val)
+			}
+			literal += string(rune(val))
+
+		case tokenTypeVariable:
+			p.errorf(t, "variable is not supported in 2-byte character data item")
+			return ast.NewEmptyItemNode(), false
+
+		case tokenTypeError:
+			p.errorf(t, "syntax error: %s", t.val)
+			return ast.NewEmptyItemNode(), false
+
+		default:
+			p.errorf(t, "expected quoted string or Unicode code point, found %q", t.val)
+			return ast.NewEmptyItemNode(), false
+		}
+	}
+
+	return ast.NewUnicodeNode(literal), true
+}
+
 // parseBinary parses a binary data item.
 // Returns ok == false when unexpected token is found, to stop parsing the message.
 // When some non-critical errors occurred, parsed values might be changed to
@@ -35,7 +35,7 @@ import (
 // - Message text:
 //   - '<': error when unexpected token found
 //   - '>': error when unexpected token found
-//   - Data item type: L, B, BOOLEAN, A, F4, F8, I1, I2, I4, I8, U1, U2, U4, U8
+//   - Data item type: L, B, BOOLEAN, A, J, W, F4, F8, I1, I2, I4, I8, U1, U2, U4, U8
 //                     error when unexpected token found
 //   - Data item size: not specified, fixed size, ranged size, e.g. [1..10], [1..], [..10]
 //                     error when number of values overflows the size
@@ -48,6 +48,10 @@ import (
 //     - Boolean: T, F
 //     - ASCII: quoted string, ASCII number code
 //              error when non-ASCII character is found
+//     - JIS-8: quoted string, JIS-8 number code
+//              error when character cannot be encoded in Shift_JIS
+//     - W, U2 with quoted string: quoted string, Unicode code point
+//                                 error when code point is invalid
 //     - F4, F8: decimal, binary, octal, hexadecimal number, possibly with scientific notation
 //               error when range overflow, error when number cannot be parsed
 //     - I1, I2, I4, I8: decimal, binary, octal, hexadecimal integer
@@ -668,6 +672,140 @@ func TestParser_ASCII_ErrorCases(t *testing.T) {
 	}
 }
 
+func TestParser_Text(t *testing.T) {
+	var tests = []struct {
+		description    string // Test case description
+		input          string // Input to the parser
+		expectedString string // expected string representation of the message
+		expectedBytes  []byte // expected message text
+	}{
+		{
+			description:    "JIS-8 with number codes",
+			input:          "S1F1\n<J \"日本\" 0xB1 65> .",
+			expectedString: "S1F1 H<->E\n<J \"日本ｱA\">\n.",
+			expectedBytes:  []byte{0x45, 6, 0x93, 0xFA, 0x96, 0x7B, 0xB1, 0x41},
+		},
+		{
+			description:    "Empty JIS-8",
+			input:          "S1F1\n<J> .",
+			expectedString: "S1F1 H<->E\n<J[0]>\n.",
+			expectedBytes:  []byte{0x45, 0},
+		},
+		{
+			description:    "W with number code",
+			input:          "S1F1\n<W[4] \"한日\" 0x1F600> .",
+			expectedString: "S1F1 H<->E\n<W \"한日😀\">\n.",
+			expectedBytes:  []byte{0x49, 10, 0, 1, 0xD5, 0x5C, 0x65, 0xE5, 0xD8, 0x3D, 0xDE, 0x00},
+		},
+		{
+			description:    "U2 with quoted string",
+			input:          "S1F1\n<U2 \"警報\"> .",
+			expectedString: "S1F1 H<->E\n<W \"警報\">\n.",
+			expectedBytes:  []byte{0x49, 6, 0, 1, 0x8B, 0x66, 0x58, 0x31},
+		},
+		{
+			description:    "U2 with numbers",
+			input:          "S1F1\n<U2 1 2> .",
+			expectedString: "S1F1 H<->E\n<U2[2] 1 2>\n.",
+			expectedBytes:  []byte{0xA9, 4, 0, 1, 0, 2},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test #%d: %s", i, test.description)
+		msgs, errs, warnings := Parse(test.input)
+		assert.Len(t, msgs, 1)
+		assert.Len(t, errs, 0)
+		assert.Len(t, warnings, 1) // direction is not specified
+		if len(msgs) != 1 {
+			continue
+		}
+		str := fmt.Sprint(msgs[0])
+		assert.Equal(t, test.expectedString, str)
+		item, _ := msgs[0].Get()
+		assert.Equal(t, test.expectedBytes, item.ToBytes())
+
+		reparsedMsgs, reparsedErrs, _ := Parse(str)
+		assert.Len(t, reparsedErrs, 0)
+		assert.Equal(t, msgs[0], reparsedMsgs[0])
+	}
+}
+
+func TestParser_Text_ErrorCases(t *testing.T) {
+	var tests = []struct {
+		description              string   // Test case description
+		input                    string   // Input to the parser
+		expectedNumberOfMessages int      // expected number of parsed messages
+		expectedNumberOfErrors   int      // expected number of parsing errors
+		expectedNumberOfWarnings int      // expected number of parsing warnings
+		expectedErrorString      []string // expected error strings in form of "line:col:subset of error text"
+		expectedWarningString    []string // expected warning strings, same form as expected error string
+	}{
+		{
+			description:              "non-JIS characters",
+			input:                    "S0F0 H->E TestMessage\n<J \"한국어\"> .",
+			expectedNumberOfMessages: 0,
+			expectedNumberOfErrors:   1,
+			expectedNumberOfWarnings: 0,
+			expectedErrorString:      []string{"2:4:expected JIS-8 characters"},
+			expectedWarningString:    []string{},
+		},
+		{
+			description:              "invalid JIS-8 number code",
+			input:                    "S0F0 H->E TestMessage\n<J 0x81> .",
+			expectedNumberOfMessages: 0,
+			expectedNumberOfErrors:   1,
+			expectedNumberOfWarnings: 0,
+			expectedErrorString:      []string{"2:4:JIS-8 character code"},
+			expectedWarningString:    []string{},
+		},
+		{
+			description:              "invalid Unicode code point",
+			input:                    "S0F0 H->E TestMessage\n<W 0xD800> .",
+			expectedNumberOfMessages: 0,
+			expectedNumberOfErrors:   1,
+			expectedNumberOfWarnings: 0,
+			expectedErrorString:      []string{"2:4:Unicode code point"},
+			expectedWarningString:    []string{},
+		},
+		{
+			description:              "variable",
+			input:                    "S0F0 H->E TestMessage\n<W var> .",
+			expectedNumberOfMessages: 0,
+			expectedNumberOfErrors:   1,
+			expectedNumberOfWarnings: 0,
+			expectedErrorString:      []string{"2:4:variable"},
+			expectedWarningString:    []string{},
+		},
+		{
+			description:              "size overflow",
+			input:                    "S0F0 H->E TestMessage\n<J[2] \"日本\"> .",
+			expectedNumberOfMessages: 0,
+			expectedNumberOfErrors:   1,
+			expectedNumberOfWarnings: 0,
+			expectedErrorString:      []string{"2:3:overflow"},
+			expectedWarningString:    []string{},
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test #%d: %s", i, test.description)
+		msgs, errs, warnings := Parse(test.input)
+		assert.Len(t, msgs, test.expectedNumberOfMessages)
+		assert.Len(t, errs, test.expectedNumberOfErrors)
+		assert.Len(t, warnings, test.expectedNumberOfWarnings)
+		for j, err := range errs {
+			s := strings.Split(test.expectedErrorString[j], ":")
+			lineCol := fmt.Sprintf("Ln %s, Col %s", s[0], s[1])
+			errTextSubset := s[2]
+			assert.Truef(
+				t, strings.HasPrefix(err, lineCol),
+				"Wrong error position, expected %s, got %s",
+				strings.Split(err, ":")[0], lineCol,
+			)
+			assert.Contains(t, err, errTextSubset)
+		}
+	}
+}
+
 func TestParser_Binary_ErrorCases(t *testing.T) {
 	var tests = []struct {
 		description              string   // Test case description
@@ -0,0 +1,290 @@
+package secs2
+
+import (
+	"reflect"
+	"unicode"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// Marshal returns the SECS-II data item of v; see the package documentation
+// for how Go values are converted. An ast.ItemNode in v is used as is.
+//
+// An *Error is returned when a value has an unsupported type, does not fit in
+// its format, or exceeds the max of its tag.
+func Marshal(v interface{}) (ast.ItemNode, error) {
+	return marshal(reflect.ValueOf(v), options{max: -1}, "")
+}
+
+func marshal(v reflect.Value, opts options, path string) (ast.ItemNode, error) {
+	for {
+		if !v.IsValid() {
+			return emptyItem(nil, opts, path)
+		}
+		isRef := v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface
+		if isRef && v.IsNil() {
+			return emptyItem(v.Type(), opts, path)
+		}
+		if v.Type().Implements(itemNodeType) {
+			return checkItem(v.Interface().(ast.ItemNode), opts, path)
+		}
+		if !isRef {
+			break
+		}
+		v = v.Elem()
+	}
+
+	format := opts.format
+	if format == "" {
+		format = defaultFormat(v.Type())
+		if format == "" {
+			return nil, errorf(path, "unsupported type %s", v.Type())
+		}
+	}
+
+	var item ast.ItemNode
+	var err error
+	switch format {
+	case "L":
+		item, err = marshalList(v, opts, path)
+	case "A", "J", "W":
+		item, err = marshalText(v, format, path)
+	case "B", "BOOLEAN":
+		item, err = marshalBytes(v, format, path)
+	default:
+		item, err = marshalNumbers(v, format, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, checkMax(item, opts, path)
+}
+
+// emptyItem returns an item without values, of the format of opts or type t.
+func emptyItem(t reflect.Type, opts options, path string) (ast.ItemNode, error) {
+	format := opts.format
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if format == "" && t != nil && !isAny(t) {
+		format = defaultFormat(t)
+	}
+
+	switch format {
+	case "", "L":
+		return ast.NewListNode(), nil
+	case "A":
+		return ast.NewASCIINode(""), nil
+	case "J":
+		return ast.NewJIS8Node(""), nil
+	case "W":
+		return ast.NewUnicodeNode(""), nil
+	case "B":
+		return ast.NewBinaryNode(), nil
+	case "BOOLEAN":
+		return ast.NewBooleanNode(), nil
+	}
+	return newItem(format, nil, path)
+}
+
+// checkItem checks an item given as an ast.ItemNode against opts.
+func checkItem(item ast.ItemNode, opts options, path string) (ast.ItemNode, error) {
+	if opts.format != "" && item.Type() != typeName(opts.format) {
+		return nil, errorf(path, "expected %s got %s", opts.format, formatName(item.Type()))
+	}
+	return item, checkMax(item, opts, path)
+}
+
+func checkMax(item ast.ItemNode, opts options, path string) error {
+	if opts.max >= 0 && item.Size() > opts.max {
+		return errorf(path, "%s size %d exceeds max %d", formatName(item.Type()), item.Size(), opts.max)
+	}
+	return nil
+}
+
+func marshalList(v reflect.Value, opts options, path string) (ast.ItemNode, error) {
+	var values []interface{}
+	switch v.Kind() {
+	case reflect.Struct:
+		fields, err := structFields(v.Type(), path)
+		if err != nil {
+			return nil, err
+		}
+		values = make([]interface{}, 0, len(fields))
+		for i, f := range fields {
+			item, err := marshal(v.Field(f.index), f.opts, childPath(path, i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, item)
+		}
+
+	case reflect.Slice, reflect.Array:
+		values = make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := marshal(v.Index(i), options{format: opts.elem, max: -1}, childPath(path, i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, item)
+		}
+
+	default:
+		return nil, errorf(path, "cannot marshal %s as L", v.Type())
+	}
+	return newItem("L", values, path)
+}
+
+func marshalText(v reflect.Value, format, path string) (ast.ItemNode, error) {
+	if v.Kind() != reflect.String {
+		return nil, errorf(path, "cannot marshal %s as %s", v.Type(), format)
+	}
+	str := v.String()
+	if format == "A" {
+		for _, r := range str {
+			if r > unicode.MaxASCII {
+				return nil, errorf(path, "non-ASCII character %q in A", r)
+			}
+		}
+	}
+	return newItem(format, []interface{}{str}, path)
+}
+
+// marshalBytes marshals a B or BOOLEAN item from a value or a slice of values.
+func marshalBytes(v reflect.Value, format, path string) (ast.ItemNode, error) {
+	elems := elements(v)
+	values := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		k := elem.Kind()
+		switch {
+		case format == "BOOLEAN" && k == reflect.Bool:
+			values = append(values, elem.Bool())
+		case format == "B" && isIntKind(k):
+			if elem.Int() < 0 || elem.Int() > 0xFF {
+				return nil, errorf(path, "value %d overflows B", elem.Int())
+			}
+			values = append(values, int(elem.Int()))
+		case format == "B" && isUintKind(k):
+			if elem.Uint() > 0xFF {
+				return nil, errorf(path, "value %d overflows B", elem.Uint())
+			}
+			values = append(values, int(elem.Uint()))
+		default:
+			return nil, errorf(path, "cannot marshal %s as %s", v.Type(), format)
+		}
+	}
+	return newItem(format, values, path)
+}
+
+// marshalNumbers marshals a numeric item from a number or a slice of numbers.
+func marshalNumbers(v reflect.Value, format, path string) (ast.ItemNode, error) {
+	elems := elements(v)
+	values := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		value, err := numberValue(elem, format, path)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return newItem(format, values, path)
+}
+
+// elements returns the elements of a slice or an array, or v itself.
+func elements(v reflect.Value) []reflect.Value {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []reflect.Value{v}
+	}
+	elems := make([]reflect.Value, v.Len())
+	for i := range elems {
+		elems[i] = v.Index(i)
+	}
+	return elems
+}
+
+// numberValue converts v to a value of numeric format: int64 for I formats,
+// uint64 for U formats and float64 for F formats.
+func numberValue(v reflect.Value, format, path string) (interface{}, error) {
+	bits := byteSize(format) * 8
+	k := v.Kind()
+	switch format[0] {
+	case 'I':
+		var x int64
+		switch {
+		case isIntKind(k):
+			x = v.Int()
+		case isUintKind(k) && v.Uint() > 1<<63-1:
+			return nil, errorf(path, "value %d overflows %s", v.Uint(), format)
+		case isUintKind(k):
+			x = int64(v.Uint())
+		default:
+			return nil, errorf(path, "cannot marshal %s as %s", v.Type(), format)
+		}
+		if x<<(64-bits)>>(64-bits) != x {
+			return nil, errorf(path, "value %d overflows %s", x, format)
+		}
+		return x, nil
+
+	case 'U':
+		var x uint64
+		switch {
+		case isUintKind(k):
+			x = v.Uint()
+		case isIntKind(k) && v.Int() >= 0:
+			x = uint64(v.Int())
+		case isIntKind(k):
+			return nil, errorf(path, "value %d overflows %s", v.Int(), format)
+		default:
+			return nil, errorf(path, "cannot marshal %s as %s", v.Type(), format)
+		}
+		if bits < 64 && x>>bits != 0 {
+			return nil, errorf(path, "value %d overflows %s", x, format)
+		}
+		return x, nil
+
+	default:
+		switch {
+		case isFloatKind(k):
+			return v.Float(), nil
+		case isIntKind(k):
+			return float64(v.Int()), nil
+		case isUintKind(k):
+			return float64(v.Uint()), nil
+		default:
+			return nil, errorf(path, "cannot marshal %s as %s", v.Type(), format)
+		}
+	}
+}
+
+// newItem creates an item of format with values; the panics of the item node
+// factory methods are returned as errors.
+func newItem(format string, values []interface{}, path string) (item ast.ItemNode, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			item, err = nil, errorf(path, "%v", r)
+		}
+	}()
+
+	switch format {
+	case "L":
+		return ast.NewListNode(values...), nil
+	case "A":
+		return ast.NewASCIINode(values[0].(string)), nil
+	case "J":
+		return ast.NewJIS8Node(values[0].(string)), nil
+	case "W":
+		return ast.NewUnicodeNode(values[0].(string)), nil
+	case "B":
+		return ast.NewBinaryNode(values...), nil
+	case "BOOLEAN":
+		return ast.NewBooleanNode(values...), nil
+	}
+	switch format[0] {
+	case 'I':
+		return ast.NewIntNode(byteSize(format), values...), nil
+	case 'U':
+		return ast.NewUintNode(byteSize(format), values...), nil
+	default:
+		return ast.NewFloatNode(byteSize(format), values...), nil
+	}
+}
@@ -0,0 +1,233 @@
+// Package secs2 converts between Go values and SECS-II data items, driven by
+// struct tags, like encoding/json does for JSON.
+//
+// A struct is a list item of its exported fields, in order. The format of each
+// field is given by its "secs" tag, for example
+//
+//	type ReportLink struct {
+//		RPTID uint32   `secs:"U4"`
+//		VIDs  []uint32 `secs:"L,elem=U4"`
+//		Text  string   `secs:"A,max=40"`
+//		Unit  *string  `secs:"A"` // optional
+//		Value interface{}        // any format
+//	}
+//
+// The first part of the tag is an SML format name: L, A, J, W, B, BOOLEAN,
+// I1, I2, I4, I8, U1, U2, U4, U8, F4 or F8. The options are max=N, the maximum
+// number of values, characters or list items, and elem=FORMAT, the format of
+// the items of a list a slice is marshaled to. The tag "-" skips a field.
+//
+// Without a format, it follows from the Go type: structs and slices are lists,
+// []byte is B, string is A, bool is BOOLEAN, int8 to int64 are I1 to I8, uint8
+// to uint64 are U1 to U8, and float32 and float64 are F4 and F8; int and uint
+// are I8 and U8. Such a field accepts any format of the same kind when it is
+// unmarshaled, e.g. an untagged uint32 accepts U1 to U8 values that fit, and a
+// string accepts A, J and W.
+//
+// A slice tagged with a format other than L is an array item, e.g. []uint32
+// tagged U4 is a single U4 item with several values.
+//
+// A nil pointer is marshaled as an item of its format without values, e.g.
+// <U4[0]>, and such an item, or a missing item at the end of a list, is
+// unmarshaled as a nil pointer. Fields of type interface{} or ast.ItemNode hold
+// an item of any format; they are unmarshaled to the item node itself.
+package secs2
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// Error describes a value that cannot be marshaled, or an item that cannot be
+// unmarshaled. Path is the position of the item, e.g. "[2][1]" for the second
+// item of the third item of the root list, or "" for the root item.
+type Error struct {
+	Path string
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return "secs2: " + e.Msg
+	}
+	return fmt.Sprintf("secs2: %s: %s", e.Path, e.Msg)
+}
+
+func errorf(path, format string, args ...interface{}) error {
+	return &Error{Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+func childPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// options are the options of a "secs" tag.
+type options struct {
+	format string // SML format name, "" means it follows from the Go type
+	max    int    // maximum size, -1 means no limit
+	elem   string // format of list items
+}
+
+func parseTag(tag, path string) (options, error) {
+	opts := options{max: -1}
+	parts := strings.Split(tag, ",")
+	opts.format = strings.ToUpper(strings.TrimSpace(parts[0]))
+	if opts.format != "" && typeName(opts.format) == "" {
+		return opts, errorf(path, "unknown format %q", parts[0])
+	}
+
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "max":
+			max, err := strconv.Atoi(value)
+			if err != nil || max < 0 {
+				return opts, errorf(path, "invalid max %q", value)
+			}
+			opts.max = max
+		case "elem":
+			opts.elem = strings.ToUpper(value)
+			if typeName(opts.elem) == "" {
+				return opts, errorf(path, "unknown format %q", value)
+			}
+		default:
+			return opts, errorf(path, "unknown tag option %q", part)
+		}
+	}
+	return opts, nil
+}
+
+// field is an exported struct field that is marshaled.
+type field struct {
+	index int
+	opts  options
+}
+
+// structFields returns the fields of struct type t that are items.
+func structFields(t reflect.Type, path string) ([]field, error) {
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("secs")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		opts, err := parseTag(tag, path)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field{index: i, opts: opts})
+	}
+	return fields, nil
+}
+
+var itemNodeType = reflect.TypeOf((*ast.ItemNode)(nil)).Elem()
+
+// isAny reports whether values of type t hold items of any format.
+func isAny(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && (t.NumMethod() == 0 || t == itemNodeType)
+}
+
+// typeName returns the item type name of an SML format name, as returned by
+// ast.ItemNode.Type(), or "" if format is unknown.
+func typeName(format string) string {
+	switch format {
+	case "L":
+		return "list"
+	case "A":
+		return "ascii"
+	case "J":
+		return "jis8"
+	case "W":
+		return "unicode"
+	case "B":
+		return "binary"
+	case "BOOLEAN":
+		return "boolean"
+	case "I1", "I2", "I4", "I8", "U1", "U2", "U4", "U8", "F4", "F8":
+		return strings.ToLower(format)
+	default:
+		return ""
+	}
+}
+
+// formatName returns the SML format name of an item type name.
+func formatName(typ string) string {
+	switch typ {
+	case "list":
+		return "L"
+	case "ascii":
+		return "A"
+	case "jis8":
+		return "J"
+	case "unicode":
+		return "W"
+	case "binary":
+		return "B"
+	case "boolean":
+		return "BOOLEAN"
+	default:
+		return strings.ToUpper(typ)
+	}
+}
+
+// defaultFormat returns the format of values of type t without a tag, or "".
+func defaultFormat(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct:
+		return "L"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "B"
+		}
+		return "L"
+	case reflect.String:
+		return "A"
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int8:
+		return "I1"
+	case reflect.Int16:
+		return "I2"
+	case reflect.Int32:
+		return "I4"
+	case reflect.Int, reflect.Int64:
+		return "I8"
+	case reflect.Uint8:
+		return "U1"
+	case reflect.Uint16:
+		return "U2"
+	case reflect.Uint32:
+		return "U4"
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return "U8"
+	case reflect.Float32:
+		return "F4"
+	case reflect.Float64:
+		return "F8"
+	default:
+		return ""
+	}
+}
+
+// byteSize returns the byte size of the values of a numeric format, e.g. 4 for U4.
+func byteSize(format string) int {
+	size, _ := strconv.Atoi(format[1:])
+	return size
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return reflect.Int <= k && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return reflect.Uint <= k && k <= reflect.Uintptr
+}
+
+func isFloatKind(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
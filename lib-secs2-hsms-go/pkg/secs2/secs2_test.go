@@ -0,0 +1,268 @@
+package secs2
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// Testing Strategy:
+//
+// Marshal Go values and compare the items with items built by the ast factory
+// methods; unmarshal those items back and compare with the Go values.
+//
+// Partitions:
+//
+// - Go type: struct, nested struct, slice, array, []byte, string, bool,
+//   signed, unsigned, float, pointer (nil, non-nil), interface{}, ast.ItemNode
+// - Tag: none, format, max, elem, "-"
+// - Item: eager item nodes, ast.LazyItem
+// - Errors: format mismatch, overflow, max exceeded, list size mismatch,
+//   unsupported type, path of the item
+
+type reportLink struct {
+	RPTID uint32   `secs:"U4"`
+	VIDs  []uint32 `secs:"L,elem=U4"`
+}
+
+type eventLink struct {
+	DATAID  uint32 `secs:"U4"`
+	Links   []reportLink
+	Comment string  `secs:"A,max=8"`
+	Skipped int     `secs:"-"`
+	Note    *string `secs:"W"`
+}
+
+func eventLinkItem() ast.ItemNode {
+	return ast.NewListNode(
+		ast.NewUintNode(4, 1),
+		ast.NewListNode(
+			ast.NewListNode(ast.NewUintNode(4, 10), ast.NewListNode(ast.NewUintNode(4, 100), ast.NewUintNode(4, 101))),
+			ast.NewListNode(ast.NewUintNode(4, 11), ast.NewListNode()),
+		),
+		ast.NewASCIINode("link"),
+		ast.NewUnicodeNode("備考"),
+	)
+}
+
+func TestMarshalUnmarshal_Struct(t *testing.T) {
+	note := "備考"
+	value := eventLink{
+		DATAID: 1,
+		Links: []reportLink{
+			{RPTID: 10, VIDs: []uint32{100, 101}},
+			{RPTID: 11, VIDs: []uint32{}},
+		},
+		Comment: "link",
+		Skipped: 7,
+		Note:    &note,
+	}
+
+	item, err := Marshal(value)
+	assert.NoError(t, err)
+	assert.Equal(t, eventLinkItem().ToBytes(), item.ToBytes())
+
+	var decoded eventLink
+	assert.NoError(t, Unmarshal(eventLinkItem(), &decoded))
+	value.Skipped = 0
+	assert.Equal(t, value, decoded)
+
+	// LazyItems are read through the ItemNode interface only
+	lazy, err := ast.NewLazyItem(eventLinkItem().ToBytes())
+	assert.NoError(t, err)
+	decoded = eventLink{}
+	assert.NoError(t, Unmarshal(lazy, &decoded))
+	assert.Equal(t, value, decoded)
+}
+
+func TestMarshalUnmarshal_OptionalItems(t *testing.T) {
+	// A nil pointer is an item without values
+	item, err := Marshal(eventLink{Comment: "x"})
+	assert.NoError(t, err)
+	note, _ := item.Get(3)
+	assert.Equal(t, "<W[0]>", fmt.Sprint(note))
+
+	var decoded eventLink
+	decoded.Note = new(string)
+	assert.NoError(t, Unmarshal(item, &decoded))
+	assert.Nil(t, decoded.Note)
+
+	// A missing item at the end of the list is a nil pointer
+	decoded.Note = new(string)
+	item = ast.NewListNode(ast.NewUintNode(4, 1), ast.NewListNode(), ast.NewASCIINode("x"))
+	assert.NoError(t, Unmarshal(item, &decoded))
+	assert.Nil(t, decoded.Note)
+}
+
+func TestMarshal_Formats(t *testing.T) {
+	var tests = []struct {
+		description string      // Test case description
+		input       interface{} // Input to Marshal
+		expected    ast.ItemNode
+	}{
+		{"string", "text", ast.NewASCIINode("text")},
+		{"bool", true, ast.NewBooleanNode(true)},
+		{"[]byte", []byte{1, 2}, ast.NewBinaryNode(1, 2)},
+		{"int8", int8(-1), ast.NewIntNode(1, -1)},
+		{"int", -5, ast.NewIntNode(8, -5)},
+		{"uint16", uint16(7), ast.NewUintNode(2, 7)},
+		{"float32", float32(1.5), ast.NewFloatNode(4, 1.5)},
+		{"[]uint32 is a list", []uint32{1, 2}, ast.NewListNode(ast.NewUintNode(4, 1), ast.NewUintNode(4, 2))},
+		{"nil", nil, ast.NewListNode()},
+		{"ItemNode", ast.NewJIS8Node("ｱ"), ast.NewJIS8Node("ｱ")},
+		{"tagged", struct {
+			ID     int      `secs:"U2"`
+			Values []uint32 `secs:"U4"`
+			Name   string   `secs:"J"`
+			Ack    uint8    `secs:"B"`
+			Value  interface{}
+		}{1, []uint32{2, 3}, "ｱ", 0, int16(4)}, ast.NewListNode(
+			ast.NewUintNode(2, 1),
+			ast.NewUintNode(4, 2, 3),
+			ast.NewJIS8Node("ｱ"),
+			ast.NewBinaryNode(0),
+			ast.NewIntNode(2, 4),
+		)},
+	}
+	for i, test := range tests {
+		t.Logf("Test #%d: %s", i, test.description)
+		item, err := Marshal(test.input)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected.ToBytes(), item.ToBytes())
+	}
+}
+
+func TestUnmarshal_Formats(t *testing.T) {
+	// Untagged values accept any format of the same kind
+	var untagged struct {
+		ID    uint32
+		Count int8
+		Name  string
+		Ack   uint8
+		Rate  float32
+		Flags []bool
+		Any   interface{}
+		Node  ast.ItemNode
+	}
+	item := ast.NewListNode(
+		ast.NewUintNode(1, 200),
+		ast.NewUintNode(8, 5),
+		ast.NewUnicodeNode("이름"),
+		ast.NewBinaryNode(3),
+		ast.NewFloatNode(8, 0.5),
+		ast.NewBooleanNode(true, false),
+		ast.NewASCIINode("any"),
+		ast.NewListNode(),
+	)
+	assert.NoError(t, Unmarshal(item, &untagged))
+	assert.Equal(t, uint32(200), untagged.ID)
+	assert.Equal(t, int8(5), untagged.Count)
+	assert.Equal(t, "이름", untagged.Name)
+	assert.Equal(t, uint8(3), untagged.Ack)
+	assert.Equal(t, float32(0.5), untagged.Rate)
+	assert.Equal(t, []bool{true, false}, untagged.Flags)
+	assert.Equal(t, ast.NewASCIINode("any"), untagged.Any)
+	assert.Equal(t, ast.NewListNode(), untagged.Node)
+
+	var array struct {
+		Values [3]uint16 `secs:"U2"`
+	}
+	assert.NoError(t, Unmarshal(ast.NewListNode(ast.NewUintNode(2, 1, 2, 3)), &array))
+	assert.Equal(t, [3]uint16{1, 2, 3}, array.Values)
+}
+
+func TestErrors(t *testing.T) {
+	var tests = []struct {
+		description string // Test case description
+		err         error  // error returned by Marshal or Unmarshal
+		expected    string // expected error text
+	}{
+		{
+			"list size mismatch",
+			Unmarshal(eventLinkItem(), new(struct {
+				DATAID uint32 `secs:"U4"`
+				Links  []struct {
+					RPTID string `secs:"A"`
+					VIDs  []uint32
+				}
+			})),
+			"secs2: expected L[2] got L[4]",
+		},
+		{
+			"format mismatch in nested item",
+			Unmarshal(ast.NewListNode(
+				ast.NewUintNode(4, 1),
+				ast.NewListNode(),
+				ast.NewListNode(ast.NewASCIINode("a"), ast.NewASCIINode("b")),
+			), new(struct {
+				A, B interface{}
+				C    []uint32 `secs:"L,elem=U4"`
+			})),
+			"secs2: [2][0]: expected U4 got A",
+		},
+		{
+			"overflow on unmarshal",
+			Unmarshal(ast.NewUintNode(4, 300), new(uint8)),
+			"secs2: value 300 overflows uint8",
+		},
+		{
+			"overflow on marshal",
+			func() error {
+				_, err := Marshal(struct {
+					ID int `secs:"U1"`
+				}{-1})
+				return err
+			}(),
+			"secs2: [0]: value -1 overflows U1",
+		},
+		{
+			"max exceeded",
+			func() error {
+				_, err := Marshal(eventLink{Comment: "too long text"})
+				return err
+			}(),
+			"secs2: [2]: A size 13 exceeds max 8",
+		},
+		{
+			"non-ASCII in A",
+			func() error {
+				_, err := Marshal("日本")
+				return err
+			}(),
+			`secs2: non-ASCII character '日' in A`,
+		},
+		{
+			"unsupported type",
+			func() error {
+				_, err := Marshal(map[string]int{})
+				return err
+			}(),
+			"secs2: unsupported type map[string]int",
+		},
+		{
+			"scalar from array",
+			Unmarshal(ast.NewUintNode(4, 1, 2), new(uint32)),
+			"secs2: U4 has 2 values, expected 1",
+		},
+		{
+			"kind mismatch",
+			Unmarshal(ast.NewListNode(ast.NewBooleanNode(true)), new([]string)),
+			"secs2: [0]: cannot unmarshal BOOLEAN into string",
+		},
+		{
+			"non-pointer",
+			Unmarshal(ast.NewListNode(), eventLink{}),
+			"secs2: Unmarshal(non-pointer secs2.eventLink)",
+		},
+	}
+	for i, test := range tests {
+		t.Logf("Test #%d: %s", i, test.description)
+		var secsErr *Error
+		assert.True(t, errors.As(test.err, &secsErr))
+		assert.EqualError(t, test.err, test.expected)
+	}
+}
@@ -0,0 +1,240 @@
+package secs2
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// Unmarshal stores the values of the SECS-II data item node in the value that
+// v points to; see the package documentation for how items are converted.
+//
+// The item is read through Type, Values and Get only, so node can also be an
+// ast.LazyItem. An *Error is returned when an item does not match the type or
+// the tag of its Go value, e.g. "secs2: [2][1]: expected U4 got A".
+func Unmarshal(node ast.ItemNode, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errorf("", "Unmarshal(non-pointer %T)", v)
+	}
+	return unmarshal(node, rv.Elem(), options{max: -1}, "")
+}
+
+func unmarshal(node ast.ItemNode, v reflect.Value, opts options, path string) error {
+	t := v.Type()
+	typ := node.Type()
+	if opts.format != "" && typ != typeName(opts.format) {
+		return errorf(path, "expected %s got %s", opts.format, formatName(typ))
+	}
+
+	switch {
+	case isAny(t):
+		if err := checkMax(node, opts, path); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(node))
+		return nil
+	case t.Kind() == reflect.Pointer:
+		if node.Size() == 0 {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return unmarshal(node, v.Elem(), opts, path)
+	}
+
+	if err := checkMax(node, opts, path); err != nil {
+		return err
+	}
+
+	switch typ {
+	case "list":
+		return unmarshalList(node, v, opts, path)
+	case "ascii", "jis8", "unicode":
+		if v.Kind() != reflect.String {
+			return cannotUnmarshal(typ, t, path)
+		}
+		v.SetString(node.Values().(string))
+		return nil
+	}
+
+	values := itemValues(node)
+	if values == nil {
+		return cannotUnmarshal(typ, t, path)
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(t, len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value, typ, path); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		if len(values) != v.Len() {
+			return errorf(path, "%s has %d values, expected %d", formatName(typ), len(values), v.Len())
+		}
+		for i, value := range values {
+			if err := setValue(v.Index(i), value, typ, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if len(values) != 1 {
+			return errorf(path, "%s has %d values, expected 1", formatName(typ), len(values))
+		}
+		return setValue(v, values[0], typ, path)
+	}
+}
+
+func unmarshalList(node ast.ItemNode, v reflect.Value, opts options, path string) error {
+	size := node.Size()
+	switch v.Kind() {
+	case reflect.Struct:
+		fields, err := structFields(v.Type(), path)
+		if err != nil {
+			return err
+		}
+		// Pointer fields at the end are optional.
+		required := len(fields)
+		for required > 0 && v.Field(fields[required-1].index).Kind() == reflect.Pointer {
+			required--
+		}
+		if size < required || size > len(fields) {
+			if required == len(fields) {
+				return errorf(path, "expected L[%d] got L[%d]", len(fields), size)
+			}
+			return errorf(path, "expected L[%d..%d] got L[%d]", required, len(fields), size)
+		}
+
+		for i, f := range fields {
+			fv := v.Field(f.index)
+			if i >= size {
+				fv.Set(reflect.Zero(fv.Type()))
+				continue
+			}
+			if err := unmarshalChild(node, i, fv, f.opts, path); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), size, size))
+		} else if size != v.Len() {
+			return errorf(path, "expected L[%d] got L[%d]", v.Len(), size)
+		}
+		for i := 0; i < size; i++ {
+			if err := unmarshalChild(node, i, v.Index(i), options{format: opts.elem, max: -1}, path); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return cannotUnmarshal("list", v.Type(), path)
+	}
+}
+
+func unmarshalChild(node ast.ItemNode, index int, v reflect.Value, opts options, path string) error {
+	child, err := node.Get(index)
+	if err != nil {
+		return errorf(childPath(path, index), "%v", err)
+	}
+	return unmarshal(child, v, opts, childPath(path, index))
+}
+
+func cannotUnmarshal(typ string, t reflect.Type, path string) error {
+	return errorf(path, "cannot unmarshal %s into %s", formatName(typ), t)
+}
+
+// itemValues returns the values of a binary, boolean or numeric item as
+// uint64, bool, int64 or float64, or nil for other items.
+func itemValues(node ast.ItemNode) []interface{} {
+	var values []interface{}
+	switch v := node.Values().(type) {
+	case []int: // binary
+		values = make([]interface{}, len(v))
+		for i, b := range v {
+			values[i] = uint64(b)
+		}
+	case []bool:
+		values = make([]interface{}, len(v))
+		for i, b := range v {
+			values[i] = b
+		}
+	case []int64:
+		values = make([]interface{}, len(v))
+		for i, x := range v {
+			values[i] = x
+		}
+	case []uint64:
+		values = make([]interface{}, len(v))
+		for i, x := range v {
+			values[i] = x
+		}
+	case []float64:
+		values = make([]interface{}, len(v))
+		for i, x := range v {
+			values[i] = x
+		}
+	}
+	return values
+}
+
+// setValue stores a value of an item of type typ in v, which should be able
+// to hold it without overflow.
+func setValue(v reflect.Value, value interface{}, typ, path string) error {
+	k := v.Kind()
+	switch x := value.(type) {
+	case bool:
+		if k == reflect.Bool {
+			v.SetBool(x)
+			return nil
+		}
+	case int64:
+		switch {
+		case isIntKind(k) && !v.OverflowInt(x):
+			v.SetInt(x)
+			return nil
+		case isUintKind(k) && x >= 0 && !v.OverflowUint(uint64(x)):
+			v.SetUint(uint64(x))
+			return nil
+		case isIntKind(k) || isUintKind(k):
+			return errorf(path, "value %d overflows %s", x, v.Type())
+		case isFloatKind(k):
+			v.SetFloat(float64(x))
+			return nil
+		}
+	case uint64:
+		switch {
+		case isUintKind(k) && !v.OverflowUint(x):
+			v.SetUint(x)
+			return nil
+		case isIntKind(k) && x <= math.MaxInt64 && !v.OverflowInt(int64(x)):
+			v.SetInt(int64(x))
+			return nil
+		case isIntKind(k) || isUintKind(k):
+			return errorf(path, "value %d overflows %s", x, v.Type())
+		case isFloatKind(k):
+			v.SetFloat(float64(x))
+			return nil
+		}
+	case float64:
+		if isFloatKind(k) {
+			if v.OverflowFloat(x) {
+				return errorf(path, "value %g overflows %s", x, v.Type())
+			}
+			v.SetFloat(x)
+			return nil
+		}
+	}
+	return cannotUnmarshal(typ, v.Type(), path)
+}
@@ -0,0 +1,147 @@
+package secs1
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/parser/hsms"
+)
+
+// Line control characters.
+const (
+	ENQ byte = 0x05
+	EOT byte = 0x04
+	ACK byte = 0x06
+	NAK byte = 0x15
+)
+
+const (
+	// HeaderSize is the size of the block header.
+	HeaderSize = 10
+	// MaxBlockData is the maximum number of data bytes in one block.
+	MaxBlockData = 244
+	// MaxBlocks is the maximum number of blocks in one message.
+	MaxBlocks = 0x7FFF
+
+	minBlockLength = HeaderSize
+	maxBlockLength = HeaderSize + MaxBlockData
+)
+
+var (
+	// ErrMessageTooLong is returned for a message that does not fit in MaxBlocks blocks.
+	ErrMessageTooLong = errors.New("secs1: message too long")
+	// ErrInvalidBlock is returned for a block with a bad length or checksum.
+	ErrInvalidBlock = errors.New("secs1: invalid block")
+)
+
+// header is the 10 byte block header:
+//
+//	byte 0-1  R bit, device ID
+//	byte 2    W bit, stream
+//	byte 3    function
+//	byte 4-5  E bit, block number
+//	byte 6-9  system bytes
+type header []byte
+
+func (h header) deviceID() uint16 {
+	return binary.BigEndian.Uint16(h[0:2]) & 0x7FFF
+}
+
+func (h header) reverse() bool {
+	return h[0]&0x80 != 0
+}
+
+func (h header) last() bool {
+	return h[4]&0x80 != 0
+}
+
+func (h header) blockNumber() int {
+	return int(binary.BigEndian.Uint16(h[4:6]) & 0x7FFF)
+}
+
+func (h header) systemBytes() []byte {
+	return h[6:10]
+}
+
+// sameMessage reports whether two blocks belong to the same message, i.e.
+// their headers match apart from the E bit and block number.
+func (h header) sameMessage(other header) bool {
+	return string(h[0:4]) == string(other[0:4]) && string(h[6:10]) == string(other[6:10])
+}
+
+// checksum is the 16 bit sum of the header and data bytes.
+func checksum(b []byte) uint16 {
+	var sum uint16
+	for _, c := range b {
+		sum += uint16(c)
+	}
+	return sum
+}
+
+// encodeBlocks splits message into blocks. Each block is the length byte,
+// header, data and checksum, ready to be written to the line.
+func encodeBlocks(message *ast.DataMessage, deviceID int, reverse bool) ([][]byte, error) {
+	frame := message.ToBytes()
+	if len(frame) < 14 {
+		return nil, fmt.Errorf("secs1: message %s can not be encoded", message.Header())
+	}
+	body := frame[14:]
+
+	count := (len(body) + MaxBlockData - 1) / MaxBlockData
+	if count == 0 {
+		count = 1
+	}
+	if count > MaxBlocks {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLong, len(body))
+	}
+
+	head := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint16(head[0:2], uint16(deviceID)&0x7FFF)
+	if reverse {
+		head[0] |= 0x80
+	}
+	head[2] = frame[6]
+	head[3] = frame[7]
+	copy(head[6:10], frame[10:14])
+
+	blocks := make([][]byte, 0, count)
+	for idx := 0; idx < count; idx++ {
+		data := body[min(idx*MaxBlockData, len(body)):min((idx+1)*MaxBlockData, len(body))]
+		block := make([]byte, 0, 1+HeaderSize+len(data)+2)
+		block = append(block, byte(HeaderSize+len(data)))
+		block = append(block, head...)
+		number := uint16(idx + 1)
+		if idx == count-1 {
+			number |= 0x8000
+		}
+		binary.BigEndian.PutUint16(block[5:7], number)
+		block = append(block, data...)
+		block = binary.BigEndian.AppendUint16(block, checksum(block[1:]))
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// decodeMessage parses the header of the first block and the joined data of
+// all blocks of a message.
+func decodeMessage(head header, data []byte) (*ast.DataMessage, error) {
+	frame := make([]byte, 14+len(data))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(HeaderSize+len(data)))
+	binary.BigEndian.PutUint16(frame[4:6], head.deviceID())
+	frame[6] = head[2]
+	frame[7] = head[3]
+	copy(frame[10:14], head.systemBytes())
+	copy(frame[14:], data)
+
+	message, ok := hsms.Parse(frame)
+	if !ok {
+		return nil, fmt.Errorf("secs1: malformed message S%dF%d", head[2]&0x7F, head[3])
+	}
+	dataMessage, ok := message.(*ast.DataMessage)
+	if !ok {
+		return nil, fmt.Errorf("secs1: unexpected message type %s", message.Type())
+	}
+	return dataMessage, nil
+}
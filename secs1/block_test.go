@@ -0,0 +1,89 @@
+package secs1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func TestEncodeBlocksRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xA5}, 600)
+	message := ast.NewHSMSDataMessage("", 6, 11, 1, "H<-E", ast.NewBinaryNode(toValues(payload)...), 7, []byte{1, 2, 3, 4})
+
+	blocks, err := encodeBlocks(message, 7, true)
+	if err != nil {
+		t.Fatalf("encodeBlocks: %v", err)
+	}
+	// 600 data bytes plus a 3 byte item header need three blocks.
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(blocks))
+	}
+
+	var data []byte
+	for idx, block := range blocks {
+		length := int(block[0])
+		if len(block) != length+3 {
+			t.Fatalf("block %d: length byte %d for %d bytes", idx, length, len(block))
+		}
+		body := block[1 : 1+length]
+		if sum := binary.BigEndian.Uint16(block[1+length:]); sum != checksum(body) {
+			t.Fatalf("block %d: bad checksum", idx)
+		}
+		head := header(body[:HeaderSize])
+		if !head.reverse() || head.deviceID() != 7 {
+			t.Fatalf("block %d: unexpected R bit or device ID % x", idx, head)
+		}
+		if head.blockNumber() != idx+1 || head.last() != (idx == len(blocks)-1) {
+			t.Fatalf("block %d: unexpected block number %d (last %v)", idx, head.blockNumber(), head.last())
+		}
+		data = append(data, body[HeaderSize:]...)
+	}
+
+	decoded, err := decodeMessage(header(blocks[0][1:11]), data)
+	if err != nil {
+		t.Fatalf("decodeMessage: %v", err)
+	}
+	if decoded.StreamCode() != 6 || decoded.FunctionCode() != 11 || decoded.WaitBit() != "true" || decoded.SessionID() != 7 {
+		t.Fatalf("unexpected header %s", decoded.Header())
+	}
+	if !bytes.Equal(decoded.SystemBytes(), []byte{1, 2, 3, 4}) {
+		t.Fatalf("unexpected system bytes % x", decoded.SystemBytes())
+	}
+	if !bytes.Equal(decoded.ToBytes(), message.ToBytes()) {
+		t.Fatal("decoded message differs from the original")
+	}
+}
+
+func TestEncodeBlocksHeaderOnly(t *testing.T) {
+	message := ast.NewHSMSDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode(), 1, []byte{0, 0, 0, 1})
+	blocks, err := encodeBlocks(message, 1, false)
+	if err != nil {
+		t.Fatalf("encodeBlocks: %v", err)
+	}
+	if len(blocks) != 1 || blocks[0][0] != HeaderSize {
+		t.Fatalf("expected a single header-only block, got %d blocks", len(blocks))
+	}
+	if head := header(blocks[0][1:11]); head.reverse() || !head.last() || head.blockNumber() != 1 {
+		t.Fatalf("unexpected header % x", head)
+	}
+}
+
+func TestEncodeBlocksTooLong(t *testing.T) {
+	payload := strings.Repeat("x", MaxBlockData*MaxBlocks)
+	message := ast.NewHSMSDataMessage("", 6, 11, 0, "H<-E", ast.NewASCIINode(payload), 1, []byte{0, 0, 0, 1})
+	if _, err := encodeBlocks(message, 1, true); !errors.Is(err, ErrMessageTooLong) {
+		t.Fatalf("expected ErrMessageTooLong, got %v", err)
+	}
+}
+
+func toValues(b []byte) []interface{} {
+	values := make([]interface{}, len(b))
+	for idx, c := range b {
+		values[idx] = c
+	}
+	return values
+}
@@ -0,0 +1,393 @@
+package secs1
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/younglifestyle/secs4go/common"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+var (
+	// ErrRetryLimit is returned when a block is not accepted within the retry limit.
+	ErrRetryLimit = errors.New("secs1: retry limit exceeded")
+	// ErrClosed is returned when the line is closed.
+	ErrClosed = errors.New("secs1: line closed")
+
+	errTimeout    = errors.New("secs1: timeout")
+	errContention = errors.New("secs1: line contention")
+)
+
+// outgoing is a message waiting for the line.
+type outgoing struct {
+	blocks [][]byte
+	result chan error
+}
+
+// partial is a multi-block message being received.
+type partial struct {
+	head     header
+	data     []byte
+	next     int
+	deadline time.Time
+}
+
+// line runs the E4 block transfer protocol on a port. One goroutine owns the
+// line: it sends queued messages block by block and receives blocks whenever
+// the other side asks for the line with ENQ.
+type line struct {
+	port     io.ReadWriteCloser
+	timeouts *BlockTimeouts
+	master   bool
+	logger   common.Logger
+	deliver  func(head header, message *ast.DataMessage)
+
+	rx      chan byte
+	readErr error
+	sendQ   chan *outgoing
+	done    chan struct{}
+	once    sync.Once
+
+	open       map[string]*partial
+	lastHeader header
+}
+
+func newLine(port io.ReadWriteCloser, timeouts *BlockTimeouts, master bool, logger common.Logger, deliver func(header, *ast.DataMessage)) *line {
+	return &line{
+		port:     port,
+		timeouts: timeouts,
+		master:   master,
+		logger:   logger,
+		deliver:  deliver,
+		rx:       make(chan byte, 1024),
+		sendQ:    make(chan *outgoing),
+		done:     make(chan struct{}),
+		open:     make(map[string]*partial),
+	}
+}
+
+// send queues blocks and waits until the last one is acknowledged.
+func (l *line) send(blocks [][]byte) error {
+	out := &outgoing{blocks: blocks, result: make(chan error, 1)}
+	select {
+	case l.sendQ <- out:
+	case <-l.done:
+		return ErrClosed
+	}
+	select {
+	case err := <-out.result:
+		return err
+	case <-l.done:
+		return ErrClosed
+	}
+}
+
+// close stops the line and closes the port.
+func (l *line) close() {
+	l.once.Do(func() {
+		close(l.done)
+		_ = l.port.Close()
+	})
+}
+
+// run serves the line until it is closed or the port fails.
+func (l *line) run() error {
+	go l.pump()
+	defer l.close()
+
+	var pending *outgoing
+	next := 0
+	for {
+		if pending == nil {
+			select {
+			case pending = <-l.sendQ:
+				next = 0
+			default:
+			}
+		}
+
+		if pending != nil {
+			err := l.sendBlock(pending.blocks[next])
+			switch {
+			case err == nil:
+				next++
+				if next == len(pending.blocks) {
+					pending.result <- nil
+					pending = nil
+				}
+			case errors.Is(err, errContention):
+				// The slave gives way and receives the master's block first.
+				if err := l.receiveBlock(); err != nil {
+					pending.result <- err
+					return err
+				}
+			case errors.Is(err, ErrRetryLimit):
+				l.logger.Warn("secs1 send aborted", "error", err)
+				pending.result <- err
+				pending = nil
+			default:
+				pending.result <- err
+				return err
+			}
+			continue
+		}
+
+		if err := l.idle(&pending); err != nil {
+			return err
+		}
+		next = 0
+	}
+}
+
+// idle waits for the other side to ask for the line, for a message to send
+// or for the T4 timeout of a partly received message.
+func (l *line) idle(pending **outgoing) error {
+	var expire <-chan time.Time
+	if deadline, ok := l.nextDeadline(); ok {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expire = timer.C
+	}
+
+	select {
+	case c, ok := <-l.rx:
+		if !ok {
+			return l.readErr
+		}
+		if c != ENQ {
+			l.logger.Debug("secs1 ignoring unexpected character", "char", c)
+			return nil
+		}
+		return l.receiveBlock()
+	case *pending = <-l.sendQ:
+		return nil
+	case <-expire:
+		l.expire(time.Now())
+		return nil
+	case <-l.done:
+		return ErrClosed
+	}
+}
+
+// pump copies bytes from the port to rx.
+func (l *line) pump() {
+	buf := make([]byte, 256)
+	for {
+		n, err := l.port.Read(buf)
+		for _, c := range buf[:n] {
+			select {
+			case l.rx <- c:
+			case <-l.done:
+				return
+			}
+		}
+		if err != nil {
+			l.readErr = err
+			close(l.rx)
+			return
+		}
+	}
+}
+
+func (l *line) readByte(timeout time.Duration) (byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c, ok := <-l.rx:
+		if !ok {
+			return 0, l.readErr
+		}
+		return c, nil
+	case <-timer.C:
+		return 0, errTimeout
+	case <-l.done:
+		return 0, ErrClosed
+	}
+}
+
+func (l *line) write(b ...byte) error {
+	_, err := l.port.Write(b)
+	return err
+}
+
+// sendBlock asks for the line with ENQ, sends block after EOT and waits for
+// ACK, retrying up to the retry limit.
+func (l *line) sendBlock(block []byte) error {
+	for attempt := 0; ; attempt++ {
+		if attempt > l.timeouts.RetryLimit() {
+			return ErrRetryLimit
+		}
+		if attempt > 0 {
+			l.logger.Debug("secs1 retrying block", "attempt", attempt)
+		}
+		if err := l.write(ENQ); err != nil {
+			return err
+		}
+
+		granted, err := l.awaitEOT()
+		if err != nil {
+			return err
+		}
+		if !granted {
+			continue
+		}
+
+		if err := l.write(block...); err != nil {
+			return err
+		}
+		c, err := l.readByte(l.timeouts.T2())
+		if err != nil && !errors.Is(err, errTimeout) {
+			return err
+		}
+		if err == nil && c == ACK {
+			return nil
+		}
+	}
+}
+
+// awaitEOT waits T2 for the line to be granted. A master ignores the ENQ of
+// the other side; a slave reports errContention.
+func (l *line) awaitEOT() (bool, error) {
+	deadline := time.Now().Add(l.timeouts.T2())
+	for {
+		c, err := l.readByte(time.Until(deadline))
+		if errors.Is(err, errTimeout) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch c {
+		case EOT:
+			return true, nil
+		case ENQ:
+			if !l.master {
+				return false, errContention
+			}
+		}
+	}
+}
+
+// receiveBlock grants the line with EOT and reads one block. Bad blocks are
+// answered with NAK once the line is quiet; the sender retries them.
+func (l *line) receiveBlock() error {
+	if err := l.write(EOT); err != nil {
+		return err
+	}
+
+	length, err := l.readByte(l.timeouts.T2())
+	if errors.Is(err, errTimeout) {
+		l.logger.Warn("secs1 no block after EOT")
+		return l.write(NAK)
+	}
+	if err != nil {
+		return err
+	}
+	if length < minBlockLength || length > maxBlockLength {
+		l.logger.Warn("secs1 invalid block length", "length", length)
+		return l.reject()
+	}
+
+	block := make([]byte, int(length)+2)
+	for idx := range block {
+		c, err := l.readByte(l.timeouts.T1())
+		if errors.Is(err, errTimeout) {
+			l.logger.Warn("secs1 T1 timeout within block")
+			return l.write(NAK)
+		}
+		if err != nil {
+			return err
+		}
+		block[idx] = c
+	}
+
+	body := block[:length]
+	if checksum(body) != binary.BigEndian.Uint16(block[length:]) {
+		l.logger.Warn("secs1 block checksum mismatch")
+		return l.reject()
+	}
+	if err := l.write(ACK); err != nil {
+		return err
+	}
+	l.accept(header(body[:HeaderSize]), body[HeaderSize:])
+	return nil
+}
+
+// reject waits until nothing has been received for T1 and sends NAK.
+func (l *line) reject() error {
+	for {
+		_, err := l.readByte(l.timeouts.T1())
+		if errors.Is(err, errTimeout) {
+			return l.write(NAK)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// accept adds a block to its message and delivers complete messages.
+func (l *line) accept(head header, data []byte) {
+	if l.lastHeader != nil && string(head) == string(l.lastHeader) {
+		// The sender missed our ACK and sent the block again.
+		l.logger.Debug("secs1 discarding duplicate block", "block", head.blockNumber())
+		return
+	}
+	l.lastHeader = append(l.lastHeader[:0], head...)
+
+	key := string(head[0:4]) + string(head[6:10])
+	number := head.blockNumber()
+
+	msg, ok := l.open[key]
+	switch {
+	case ok && number == msg.next:
+		msg.data = append(msg.data, data...)
+	case ok:
+		l.logger.Warn("secs1 block out of sequence, message discarded", "expected", msg.next, "got", number)
+		delete(l.open, key)
+		return
+	case number > 1:
+		l.logger.Warn("secs1 block without first block, discarded", "block", number)
+		return
+	default:
+		msg = &partial{head: append(header(nil), head...), data: append([]byte(nil), data...)}
+		l.open[key] = msg
+	}
+
+	if !head.last() {
+		msg.next = number + 1
+		msg.deadline = time.Now().Add(l.timeouts.T4())
+		return
+	}
+	delete(l.open, key)
+
+	message, err := decodeMessage(msg.head, msg.data)
+	if err != nil {
+		l.logger.Warn("secs1 dropping message", "error", err)
+		return
+	}
+	l.deliver(msg.head, message)
+}
+
+func (l *line) nextDeadline() (time.Time, bool) {
+	var next time.Time
+	for _, msg := range l.open {
+		if next.IsZero() || msg.deadline.Before(next) {
+			next = msg.deadline
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// expire drops multi-block messages whose next block did not arrive within T4.
+func (l *line) expire(now time.Time) {
+	for key, msg := range l.open {
+		if !now.Before(msg.deadline) {
+			l.logger.Warn("secs1 T4 timeout, message discarded", "block", msg.next)
+			delete(l.open, key)
+		}
+	}
+}
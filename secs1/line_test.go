@@ -0,0 +1,180 @@
+package secs1
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/common"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// scriptedPeer plays the other end of a line byte by byte.
+type scriptedPeer struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (p *scriptedPeer) expect(want byte) {
+	p.t.Helper()
+	got := p.read(1)[0]
+	if got != want {
+		p.t.Errorf("expected 0x%02x, got 0x%02x", want, got)
+	}
+}
+
+func (p *scriptedPeer) read(n int) []byte {
+	p.t.Helper()
+	buf := make([]byte, n)
+	_ = p.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(p.conn, buf); err != nil {
+		p.t.Errorf("read: %v", err)
+	}
+	return buf
+}
+
+// readBlock reads a block after the line was granted.
+func (p *scriptedPeer) readBlock() []byte {
+	p.t.Helper()
+	length := p.read(1)[0]
+	return p.read(int(length) + 2)
+}
+
+func (p *scriptedPeer) write(b ...byte) {
+	p.t.Helper()
+	if _, err := p.conn.Write(b); err != nil {
+		p.t.Errorf("write: %v", err)
+	}
+}
+
+func newTestLine(t *testing.T, master bool) (*line, *scriptedPeer, chan *ast.DataMessage) {
+	t.Helper()
+	local, remote := net.Pipe()
+	timeouts := NewBlockTimeouts()
+	timeouts.SetT1(100 * time.Millisecond)
+	timeouts.SetT2(500 * time.Millisecond)
+
+	received := make(chan *ast.DataMessage, 4)
+	l := newLine(local, timeouts, master, common.NopLogger(), func(_ header, message *ast.DataMessage) {
+		received <- message
+	})
+	go l.run()
+	t.Cleanup(func() {
+		l.close()
+		remote.Close()
+	})
+	return l, &scriptedPeer{t: t, conn: remote}, received
+}
+
+func testBlocks(t *testing.T, deviceID int, reverse bool) [][]byte {
+	t.Helper()
+	message := ast.NewHSMSDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode(), deviceID, []byte{0, 0, 0, 9})
+	blocks, err := encodeBlocks(message, deviceID, reverse)
+	if err != nil {
+		t.Fatalf("encodeBlocks: %v", err)
+	}
+	return blocks
+}
+
+func TestLineRetriesAfterNAK(t *testing.T) {
+	l, peer, _ := newTestLine(t, true)
+	blocks := testBlocks(t, 1, true)
+
+	go func() {
+		for _, reply := range []byte{NAK, ACK} {
+			peer.expect(ENQ)
+			peer.write(EOT)
+			peer.readBlock()
+			peer.write(reply)
+		}
+	}()
+
+	if err := l.send(blocks); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+func TestLineRetryLimit(t *testing.T) {
+	l, peer, _ := newTestLine(t, true)
+	l.timeouts.SetRetryLimit(1)
+
+	go func() {
+		for attempt := 0; attempt < 2; attempt++ {
+			peer.expect(ENQ)
+			peer.write(EOT)
+			peer.readBlock()
+			peer.write(NAK)
+		}
+	}()
+
+	if err := l.send(testBlocks(t, 1, true)); err != ErrRetryLimit {
+		t.Fatalf("expected ErrRetryLimit, got %v", err)
+	}
+}
+
+func TestLineSlaveYieldsOnContention(t *testing.T) {
+	l, peer, received := newTestLine(t, false)
+	masterBlock := testBlocks(t, 1, true)[0]
+
+	go func() {
+		// Both sides ask for the line; the slave must grant it.
+		peer.expect(ENQ)
+		peer.write(ENQ)
+		peer.expect(EOT)
+		peer.write(masterBlock...)
+		peer.expect(ACK)
+
+		// Then the slave retries its own block.
+		peer.expect(ENQ)
+		peer.write(EOT)
+		peer.readBlock()
+		peer.write(ACK)
+	}()
+
+	if err := l.send(testBlocks(t, 1, false)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case message := <-received:
+		if message.StreamCode() != 1 || message.FunctionCode() != 1 {
+			t.Fatalf("unexpected message %s", message.Header())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("master block not received")
+	}
+}
+
+func TestLineRejectsBadChecksum(t *testing.T) {
+	_, peer, received := newTestLine(t, true)
+	block := testBlocks(t, 1, false)[0]
+	corrupt := append([]byte(nil), block...)
+	corrupt[len(corrupt)-1]++
+
+	peer.write(ENQ)
+	peer.expect(EOT)
+	peer.write(corrupt...)
+	peer.expect(NAK)
+
+	peer.write(ENQ)
+	peer.expect(EOT)
+	peer.write(block...)
+	peer.expect(ACK)
+
+	// A repeated block (lost ACK) is acknowledged but not delivered twice.
+	peer.write(ENQ)
+	peer.expect(EOT)
+	peer.write(block...)
+	peer.expect(ACK)
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("block not delivered")
+	}
+	select {
+	case <-received:
+		t.Fatal("duplicate block delivered")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
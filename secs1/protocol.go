@@ -0,0 +1,570 @@
+// Package secs1 implements SECS-I (SEMI E4): SECS-II messages sent as
+// checksummed blocks over a serial line with ENQ/EOT/ACK/NAK line control.
+//
+// Protocol offers the same message API as hsms.HsmsProtocol (SendAndWait,
+// SendDataMessage, RegisterHandler), so application code does not depend on
+// the transport.
+package secs1
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/younglifestyle/secs4go/common"
+	"github.com/younglifestyle/secs4go/hsms"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+	"github.com/younglifestyle/secs4go/utils"
+	"go.uber.org/atomic"
+)
+
+var (
+	// ErrNotConnected is returned when a message is sent while the line is down.
+	ErrNotConnected = errors.New("secs1: not connected")
+	// ErrPortClosed is returned when a port that was closed by Disable is enabled again.
+	ErrPortClosed = errors.New("secs1: port closed")
+)
+
+// Protocol runs SECS-I on a port. The equipment side sets the R bit on the
+// messages it sends and is the master when both sides ask for the line at
+// the same time.
+type Protocol struct {
+	deviceID  int
+	equipment bool
+	name      string
+	// open returns the next port; it gives up when stop is closed.
+	// reconnect is set when open can be called again after the port fails.
+	open      func(stop <-chan struct{}) (io.ReadWriteCloser, error)
+	reconnect bool
+
+	master        *atomic.Bool
+	timeouts      *hsms.SecsTimeout
+	blockTimeouts *BlockTimeouts
+	logger        common.Logger
+
+	enabled       *atomic.Bool
+	connected     *atomic.Bool
+	systemCounter *atomic.Uint32
+
+	lineMu sync.Mutex
+	line   *line
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	queueMu sync.Mutex
+	pending map[uint32]chan *ast.DataMessage
+
+	handlerMu      sync.RWMutex
+	handlers       map[string]hsms.DataMessageHandler
+	defaultHandler hsms.DataMessageHandler
+
+	listenerMu sync.RWMutex
+	listeners  []func(hsms.ConnectionEvent)
+}
+
+// NewProtocol runs SECS-I on port, e.g. a serial device opened with
+// OpenSerial or one end of a pty. equipment selects the R bit and the
+// default master role; deviceID is the device ID of the equipment.
+// Disable closes port, so the protocol can be enabled only once.
+func NewProtocol(port io.ReadWriteCloser, equipment bool, deviceID int, name string) *Protocol {
+	var used atomic.Bool
+	open := func(<-chan struct{}) (io.ReadWriteCloser, error) {
+		if used.Swap(true) {
+			return nil, ErrPortClosed
+		}
+		return port, nil
+	}
+	return newProtocol(open, false, equipment, deviceID, name)
+}
+
+func newProtocol(open func(stop <-chan struct{}) (io.ReadWriteCloser, error), reconnect bool, equipment bool, deviceID int, name string) *Protocol {
+	return &Protocol{
+		deviceID:      deviceID,
+		equipment:     equipment,
+		name:          name,
+		open:          open,
+		reconnect:     reconnect,
+		master:        atomic.NewBool(equipment),
+		timeouts:      hsms.NewSecsTimeout(),
+		blockTimeouts: NewBlockTimeouts(),
+		logger:        common.NopLogger(),
+		enabled:       atomic.NewBool(false),
+		connected:     atomic.NewBool(false),
+		systemCounter: atomic.NewUint32(rand.Uint32()),
+		pending:       make(map[uint32]chan *ast.DataMessage),
+		handlers:      make(map[string]hsms.DataMessageHandler),
+	}
+}
+
+// SetMaster overrides the master role used to resolve line contention. By
+// default the equipment is the master. Set it before Enable.
+func (p *Protocol) SetMaster(master bool) {
+	p.master.Store(master)
+}
+
+// Timeouts returns the message level timeouts; SECS-I uses T3.
+func (p *Protocol) Timeouts() *hsms.SecsTimeout {
+	return p.timeouts
+}
+
+// BlockTimeouts returns the block transfer parameters T1, T2, T4 and the retry limit.
+func (p *Protocol) BlockTimeouts() *BlockTimeouts {
+	return p.blockTimeouts
+}
+
+// SetLogger replaces the internal logger used for protocol events.
+// If logger is nil, a silent NopLogger is used.
+func (p *Protocol) SetLogger(logger common.Logger) {
+	if logger == nil {
+		logger = common.NopLogger()
+	}
+	p.logger = logger
+}
+
+// Enable opens the port and starts serving the line.
+func (p *Protocol) Enable() {
+	if p.enabled.Swap(true) {
+		return
+	}
+	p.lineMu.Lock()
+	p.stop = make(chan struct{})
+	stop := p.stop
+	p.lineMu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.serve(stop)
+	}()
+}
+
+// Disable stops the line, closes the port and fails waiting requests.
+func (p *Protocol) Disable() {
+	if !p.enabled.Swap(false) {
+		return
+	}
+	p.lineMu.Lock()
+	close(p.stop)
+	if p.line != nil {
+		p.line.close()
+	}
+	p.lineMu.Unlock()
+	p.wg.Wait()
+}
+
+// serve opens the port and runs the line until stop is closed. A protocol
+// that can reconnect retries failed opens with the SecsTimeout backoff and
+// reopens the port T5 after the line went down.
+func (p *Protocol) serve(stop chan struct{}) {
+	attempts := 0
+	for {
+		port, err := p.open(stop)
+		if err != nil {
+			if isClosed(stop) {
+				return
+			}
+			p.logger.Error("secs1 open port failed", "name", p.name, "error", err)
+			if !p.reconnect || !p.timeouts.AutoReconnect() {
+				return
+			}
+			attempts++
+			if maxAttempts := p.timeouts.MaxReconnectAttempts(); maxAttempts > 0 && attempts > maxAttempts {
+				p.logger.Warn("max reconnect attempts reached, stopping", "maxAttempts", maxAttempts)
+				return
+			}
+			delay := p.timeouts.ReconnectDelay(attempts)
+			p.logger.Info("reconnecting", "attempt", attempts, "delay", delay)
+			p.publish(hsms.ConnectionEvent{Type: hsms.EventReconnectScheduled, Attempt: attempts, Delay: delay})
+			if !sleep(delay, stop) {
+				return
+			}
+			continue
+		}
+		attempts = 0
+
+		p.runLine(port, stop)
+		if !p.reconnect || !sleep(time.Duration(p.timeouts.T5ConnSeparateTimeout())*time.Second, stop) {
+			return
+		}
+	}
+}
+
+func isClosed(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d and reports false when stop is closed first.
+func sleep(d time.Duration, stop <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// runLine serves one opened port until the line fails or stop is closed.
+func (p *Protocol) runLine(port io.ReadWriteCloser, stop chan struct{}) error {
+	inbox := utils.NewDeque()
+	l := newLine(port, p.blockTimeouts, p.master.Load(), p.logger, func(head header, message *ast.DataMessage) {
+		p.receive(head, message, inbox)
+	})
+
+	p.lineMu.Lock()
+	select {
+	case <-stop:
+		p.lineMu.Unlock()
+		_ = port.Close()
+		return ErrClosed
+	default:
+	}
+	p.line = l
+	p.lineMu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		p.dispatch(ctx, inbox)
+	}()
+
+	p.connected.Store(true)
+	p.logger.Info("secs1 line ready", "name", p.name)
+	connected := hsms.ConnectionEvent{Type: hsms.EventConnected}
+	if conn, ok := port.(net.Conn); ok {
+		connected.LocalAddr, connected.RemoteAddr = conn.LocalAddr(), conn.RemoteAddr()
+	}
+	p.publish(connected)
+	p.publish(hsms.ConnectionEvent{Type: hsms.EventSelected})
+
+	err := l.run()
+	p.connected.Store(false)
+	p.logger.Info("secs1 line closed", "name", p.name, "error", err)
+	reason := disconnectReason(err)
+	if isClosed(stop) {
+		reason = hsms.DisconnectReasonLocal
+	}
+	p.publish(hsms.ConnectionEvent{Type: hsms.EventDisconnected, Reason: reason, Err: err})
+
+	cancel()
+	<-dispatched
+
+	p.lineMu.Lock()
+	p.line = nil
+	p.lineMu.Unlock()
+	p.failPending()
+	return err
+}
+
+// failPending wakes every SendAndWait call; a closed reply channel means the
+// line went down.
+func (p *Protocol) failPending() {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	for systemID, reply := range p.pending {
+		close(reply)
+		delete(p.pending, systemID)
+	}
+}
+
+// receive runs on the line goroutine. Replies complete their request at
+// once; primary messages are dispatched in order on another goroutine so
+// handlers may send messages themselves.
+func (p *Protocol) receive(head header, message *ast.DataMessage, inbox *utils.Deque) {
+	if message.FunctionCode()%2 == 0 {
+		systemID := binary.BigEndian.Uint32(message.SystemBytes())
+		p.queueMu.Lock()
+		reply, ok := p.pending[systemID]
+		delete(p.pending, systemID)
+		p.queueMu.Unlock()
+		if ok {
+			reply <- message
+		} else {
+			p.logger.Warn("secs1 unexpected reply", "stream", message.StreamCode(), "function", message.FunctionCode())
+		}
+		return
+	}
+	if head.reverse() == p.equipment {
+		p.logger.Warn("secs1 message with unexpected R bit", "stream", message.StreamCode(), "function", message.FunctionCode())
+	}
+	inbox.Put(message)
+}
+
+func (p *Protocol) dispatch(ctx context.Context, inbox *utils.Deque) {
+	for {
+		item, err := inbox.GetContext(ctx)
+		if err != nil {
+			return
+		}
+		p.handle(item.(*ast.DataMessage))
+	}
+}
+
+func (p *Protocol) handle(message *ast.DataMessage) {
+	if message.SessionID() != p.deviceID {
+		p.logger.Warn("secs1 unrecognized device ID", "device", message.SessionID())
+		if p.equipment {
+			p.sendS9(hsms.BuildS9F1(byte(message.SessionID()), message.SystemBytes()))
+		}
+		return
+	}
+
+	handler := p.lookupHandler(message.StreamCode(), message.FunctionCode())
+	if handler == nil {
+		p.handlerMu.RLock()
+		handler = p.defaultHandler
+		p.handlerMu.RUnlock()
+	}
+	if handler == nil {
+		p.sendS9ErrorForUnrecognized(message)
+		return
+	}
+
+	response, err := handler(message)
+	if err != nil {
+		p.logger.Error("handler error", "stream", message.StreamCode(), "function", message.FunctionCode(), "error", err)
+		return
+	}
+	if response == nil {
+		return
+	}
+	response = response.SetSessionIDAndSystemBytes(p.deviceID, message.SystemBytes())
+	if response.WaitBit() == "optional" {
+		response = response.SetWaitBit(false)
+	}
+	if err := p.send(response); err != nil {
+		p.logger.Error("secs1 send reply failed", "stream", response.StreamCode(), "function", response.FunctionCode(), "error", err)
+	}
+}
+
+// sendS9ErrorForUnrecognized answers a primary message nobody handles with
+// S9F3 when no handler knows its stream and S9F5 otherwise.
+func (p *Protocol) sendS9ErrorForUnrecognized(message *ast.DataMessage) {
+	if message.StreamCode() == 9 || message.FunctionCode()%2 == 0 {
+		return
+	}
+	prefix := fmt.Sprintf("S%02dF", message.StreamCode())
+	knownStream := false
+	p.handlerMu.RLock()
+	for key := range p.handlers {
+		if strings.HasPrefix(key, prefix) {
+			knownStream = true
+			break
+		}
+	}
+	p.handlerMu.RUnlock()
+
+	if knownStream {
+		p.sendS9(hsms.BuildS9F5(byte(message.FunctionCode()), message.SystemBytes()))
+	} else {
+		p.sendS9(hsms.BuildS9F3(byte(message.StreamCode()), message.SystemBytes()))
+	}
+}
+
+// sendS9F9 reports the T3 timeout of message with S9F9, which carries the
+// header of its first block.
+func (p *Protocol) sendS9F9(message *ast.DataMessage) {
+	blocks, err := encodeBlocks(message, p.deviceID, p.equipment)
+	if err != nil {
+		return
+	}
+	_, systemBytes := p.nextSystemBytes()
+	p.logger.Info("T3 timeout, sending S9F9", "stream", message.StreamCode(), "function", message.FunctionCode())
+	p.sendS9(hsms.BuildS9F9(blocks[0][1:1+HeaderSize], systemBytes))
+}
+
+func (p *Protocol) sendS9(message *ast.DataMessage) {
+	message = message.SetSessionIDAndSystemBytes(p.deviceID, message.SystemBytes()).SetWaitBit(false)
+	if err := p.send(message); err != nil {
+		p.logger.Error("failed to send S9 error message", "error", err)
+	}
+}
+
+// send writes a message with its session ID and system bytes already set.
+func (p *Protocol) send(message *ast.DataMessage) error {
+	blocks, err := encodeBlocks(message, p.deviceID, p.equipment)
+	if err != nil {
+		return err
+	}
+	p.lineMu.Lock()
+	l := p.line
+	p.lineMu.Unlock()
+	if l == nil {
+		return ErrNotConnected
+	}
+	return l.send(blocks)
+}
+
+func (p *Protocol) nextSystemBytes() (uint32, []byte) {
+	systemID := p.systemCounter.Inc()
+	systemBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(systemBytes, systemID)
+	return systemID, systemBytes
+}
+
+// SendDataMessage sends a message without waiting for a reply.
+func (p *Protocol) SendDataMessage(message *ast.DataMessage) error {
+	if message == nil {
+		return errors.New("secs1: nil message")
+	}
+	if !p.connected.Load() {
+		return ErrNotConnected
+	}
+	_, systemBytes := p.nextSystemBytes()
+	outgoing := message.SetSessionIDAndSystemBytes(p.deviceID, systemBytes)
+	if outgoing.WaitBit() == "optional" {
+		outgoing = outgoing.SetWaitBit(false)
+	}
+	return p.send(outgoing)
+}
+
+// SendAndWait sends a message and waits up to T3 for its reply.
+func (p *Protocol) SendAndWait(message *ast.DataMessage) (*ast.DataMessage, error) {
+	return p.SendAndWaitContext(context.Background(), message)
+}
+
+// SendAndWaitContext is like SendAndWait but gives up with ctx.Err() when ctx
+// is done. A deadline on ctx replaces T3 for this transaction.
+func (p *Protocol) SendAndWaitContext(ctx context.Context, message *ast.DataMessage) (*ast.DataMessage, error) {
+	if message == nil {
+		return nil, errors.New("secs1: nil message")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !p.connected.Load() {
+		return nil, ErrNotConnected
+	}
+
+	waitCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, time.Duration(p.timeouts.T3ReplyTimeout())*time.Second)
+		defer cancel()
+	}
+
+	systemID, systemBytes := p.nextSystemBytes()
+	outgoing := message.SetSessionIDAndSystemBytes(p.deviceID, systemBytes)
+	if outgoing.WaitBit() == "optional" {
+		outgoing = outgoing.SetWaitBit(true)
+	}
+
+	reply := make(chan *ast.DataMessage, 1)
+	p.queueMu.Lock()
+	p.pending[systemID] = reply
+	p.queueMu.Unlock()
+	defer func() {
+		p.queueMu.Lock()
+		delete(p.pending, systemID)
+		p.queueMu.Unlock()
+	}()
+
+	if err := p.send(outgoing); err != nil {
+		return nil, err
+	}
+
+	select {
+	case response, ok := <-reply:
+		if !ok {
+			return nil, ErrNotConnected
+		}
+		return response, nil
+	case <-waitCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p.sendS9F9(outgoing)
+		return nil, hsms.ErrT3Timeout
+	}
+}
+
+// RegisterHandler registers a handler for a stream/function pair. A nil
+// handler removes the registration.
+func (p *Protocol) RegisterHandler(stream, function int, handler hsms.DataMessageHandler) {
+	key := fmt.Sprintf("S%02dF%02d", stream, function)
+	p.handlerMu.Lock()
+	defer p.handlerMu.Unlock()
+	if handler == nil {
+		delete(p.handlers, key)
+		return
+	}
+	p.handlers[key] = handler
+}
+
+// RegisterDefaultHandler registers a fallback handler invoked when no specific handler exists.
+func (p *Protocol) RegisterDefaultHandler(handler hsms.DataMessageHandler) {
+	p.handlerMu.Lock()
+	p.defaultHandler = handler
+	p.handlerMu.Unlock()
+}
+
+func (p *Protocol) lookupHandler(stream, function int) hsms.DataMessageHandler {
+	p.handlerMu.RLock()
+	defer p.handlerMu.RUnlock()
+	return p.handlers[fmt.Sprintf("S%02dF%02d", stream, function)]
+}
+
+// AddConnectionListener registers fn to receive connection events:
+// EventConnected and EventSelected when the line comes up, EventDisconnected
+// when it goes down and EventReconnectScheduled before a reconnect attempt.
+// Listeners run synchronously in registration order and must not block.
+func (p *Protocol) AddConnectionListener(fn func(hsms.ConnectionEvent)) {
+	if fn == nil {
+		return
+	}
+	p.listenerMu.Lock()
+	p.listeners = append(p.listeners, fn)
+	p.listenerMu.Unlock()
+}
+
+func (p *Protocol) publish(event hsms.ConnectionEvent) {
+	event.Time = time.Now()
+
+	p.listenerMu.RLock()
+	listeners := p.listeners
+	p.listenerMu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+func disconnectReason(err error) hsms.DisconnectReason {
+	switch {
+	case errors.Is(err, ErrClosed):
+		return hsms.DisconnectReasonLocal
+	case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+		return hsms.DisconnectReasonPeerClosed
+	default:
+		return hsms.DisconnectReasonError
+	}
+}
+
+// Connected reports whether the line is being served.
+func (p *Protocol) Connected() bool {
+	return p.connected.Load()
+}
+
+// CurrentState maps the line to the HSMS state names: SECS-I has no
+// selection, so a served line counts as selected.
+func (p *Protocol) CurrentState() string {
+	if p.connected.Load() {
+		return hsms.StateConnectedSelected
+	}
+	return hsms.StateNotConnected
+}
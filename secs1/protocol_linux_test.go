@@ -0,0 +1,211 @@
+package secs1
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/younglifestyle/secs4go/hsms"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+// openPty returns both ends of a new pseudo terminal, the slave in raw mode.
+func openPty(t *testing.T) (master, slave *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("pty not available: %v", err)
+	}
+	conn, err := master.SyscallConn()
+	if err != nil {
+		t.Fatalf("syscall conn: %v", err)
+	}
+	var number uint32
+	var ioctlErr error
+	_ = conn.Control(func(fd uintptr) {
+		var unlock int32
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+			ioctlErr = errno
+			return
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); errno != 0 {
+			ioctlErr = errno
+		}
+	})
+	if ioctlErr != nil {
+		master.Close()
+		t.Skipf("pty not available: %v", ioctlErr)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", number), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("pty not available: %v", err)
+	}
+	if err := makeRaw(slave, 0); err != nil {
+		t.Fatalf("raw mode: %v", err)
+	}
+	return master, slave
+}
+
+func newPtyPair(t *testing.T) (equipment, host *Protocol) {
+	t.Helper()
+	master, slave := openPty(t)
+	equipment = NewProtocol(master, true, 1, "equipment")
+	host = NewProtocol(slave, false, 1, "host")
+	for _, p := range []*Protocol{equipment, host} {
+		p.Timeouts().SetT3ReplyTimeout(5)
+		p.Enable()
+		t.Cleanup(p.Disable)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !equipment.Connected() || !host.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("lines not ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return equipment, host
+}
+
+func TestProtocolOverPty(t *testing.T) {
+	equipment, host := newPtyPair(t)
+	equipment.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewListNode(ast.NewASCIINode("MDLN"), ast.NewASCIINode("REV"))), nil
+	})
+
+	reply, err := host.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+	if err != nil {
+		t.Fatalf("S1F1: %v", err)
+	}
+	if model, _ := reply.GetAscii(0); model != "MDLN" {
+		t.Fatalf("unexpected S1F2 %s", reply)
+	}
+}
+
+func TestProtocolMultiBlockOverPty(t *testing.T) {
+	equipment, host := newPtyPair(t)
+	report := strings.Repeat("r", 1000)
+	host.RegisterHandler(6, 11, func(message *ast.DataMessage) (*ast.DataMessage, error) {
+		text, err := message.GetAscii()
+		if err != nil || text != report {
+			return ast.NewDataMessage("", 6, 12, 0, "H->E", ast.NewBinaryNode(1)), nil
+		}
+		return ast.NewDataMessage("", 6, 12, 0, "H->E", ast.NewBinaryNode(0)), nil
+	})
+
+	reply, err := equipment.SendAndWait(ast.NewDataMessage("", 6, 11, 1, "H<-E", ast.NewASCIINode(report)))
+	if err != nil {
+		t.Fatalf("S6F11: %v", err)
+	}
+	if ack, _ := reply.GetByte(0); ack != 0 {
+		t.Fatalf("host rejected the multi-block report (ACKC6 %d)", ack)
+	}
+}
+
+func TestProtocolConcurrentSendersOverPty(t *testing.T) {
+	equipment, host := newPtyPair(t)
+	echo := func(reply int, direction string) func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return func(message *ast.DataMessage) (*ast.DataMessage, error) {
+			item, _ := message.Get()
+			return ast.NewDataMessage("", 2, reply, 0, direction, item), nil
+		}
+	}
+	equipment.RegisterHandler(2, 25, echo(26, "H<-E"))
+	host.RegisterHandler(2, 25, echo(26, "H->E"))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for idx := 0; idx < 5; idx++ {
+		for _, sender := range []*Protocol{equipment, host} {
+			wg.Add(1)
+			go func(sender *Protocol, idx int) {
+				defer wg.Done()
+				payload := strings.Repeat(fmt.Sprint(idx), 300)
+				reply, err := sender.SendAndWait(ast.NewDataMessage("", 2, 25, 1, "H<->E", ast.NewASCIINode(payload)))
+				if err != nil {
+					errs <- fmt.Errorf("%s: %w", sender.name, err)
+					return
+				}
+				if text, _ := reply.GetAscii(); text != payload {
+					errs <- fmt.Errorf("%s: echo mismatch", sender.name)
+				}
+			}(sender, idx)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestProtocolUnknownFunctionOverPty(t *testing.T) {
+	equipment, host := newPtyPair(t)
+	equipment.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) { return nil, nil })
+
+	s9 := make(chan *ast.DataMessage, 1)
+	host.RegisterHandler(9, 5, func(message *ast.DataMessage) (*ast.DataMessage, error) {
+		s9 <- message
+		return nil, nil
+	})
+
+	if err := host.SendDataMessage(ast.NewDataMessage("", 1, 99, 0, "H->E", ast.NewEmptyItemNode())); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case <-s9:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected S9F5 for an unknown function")
+	}
+}
+
+func TestProtocolDisableFailsWaitingRequest(t *testing.T) {
+	equipment, host := newPtyPair(t)
+	equipment.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	})
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		host.Disable()
+	}()
+	start := time.Now()
+	if _, err := host.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode())); err != ErrNotConnected {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("waiting request failed only after %s", elapsed)
+	}
+}
+
+func TestProtocolT3TimeoutSendsS9F9OverPty(t *testing.T) {
+	equipment, host := newPtyPair(t)
+	host.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) { return nil, nil })
+	s9 := make(chan *ast.DataMessage, 1)
+	host.RegisterHandler(9, 9, func(message *ast.DataMessage) (*ast.DataMessage, error) {
+		s9 <- message
+		return nil, nil
+	})
+	equipment.Timeouts().SetT3ReplyTimeout(1)
+
+	request := ast.NewDataMessage("", 1, 1, 1, "H<-E", ast.NewEmptyItemNode())
+	if _, err := equipment.SendAndWait(request); err != hsms.ErrT3Timeout {
+		t.Fatalf("expected ErrT3Timeout, got %v", err)
+	}
+	select {
+	case message := <-s9:
+		item, _ := message.Get()
+		if shead, ok := item.Values().([]int); !ok || len(shead) != HeaderSize || shead[2] != 0x81 || shead[3] != 1 {
+			t.Fatalf("unexpected S9F9 header %v", item)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected S9F9 after T3")
+	}
+}
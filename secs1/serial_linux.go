@@ -0,0 +1,76 @@
+package secs1
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// cbaud masks the baud rate bits of the control flags; syscall does not export it.
+const cbaud = 0o010017
+
+var baudRates = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+}
+
+// OpenSerial opens a serial device in raw 8N1 mode at baud, ready for NewProtocol.
+func OpenSerial(path string, baud int) (*os.File, error) {
+	speed, ok := baudRates[baud]
+	if !ok {
+		return nil, fmt.Errorf("secs1: unsupported baud rate %d", baud)
+	}
+	port, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := makeRaw(port, speed); err != nil {
+		port.Close()
+		return nil, fmt.Errorf("secs1: configure %s: %w", path, err)
+	}
+	return port, nil
+}
+
+// makeRaw puts a terminal into raw 8N1 mode; speed 0 keeps the current baud rate.
+func makeRaw(port *os.File, speed uint32) error {
+	conn, err := port.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		var termios syscall.Termios
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+			ioctlErr = errno
+			return
+		}
+		termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+			syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF
+		termios.Oflag &^= syscall.OPOST
+		termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+		termios.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.CSTOPB
+		termios.Cflag |= syscall.CS8 | syscall.CLOCAL | syscall.CREAD
+		// TCSETS takes the speed from the baud bits of Cflag; the Ispeed and
+		// Ospeed fields are not part of the kernel termios, and missing on mips64.
+		if speed != 0 {
+			termios.Cflag &^= cbaud
+			termios.Cflag |= speed
+		}
+		termios.Cc[syscall.VMIN] = 1
+		termios.Cc[syscall.VTIME] = 0
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+			ioctlErr = errno
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package secs1
+
+import (
+	"errors"
+	"os"
+)
+
+// OpenSerial opens a serial device in raw 8N1 mode at baud, ready for NewProtocol.
+// It is only implemented on Linux; elsewhere pass a port opened by a serial library.
+func OpenSerial(path string, baud int) (*os.File, error) {
+	return nil, errors.New("secs1: OpenSerial is not supported on this platform")
+}
@@ -0,0 +1,71 @@
+package secs1
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// NewTCPProtocol runs SECS-I over a raw TCP stream, e.g. through a
+// serial-to-Ethernet converter in TCP server or client mode. An active
+// protocol dials address:port, a passive one listens on it and serves one
+// connection at a time. Lost connections are reopened using the reconnect
+// settings of Timeouts(), the same as for HSMS: failed connects back off
+// exponentially and a dropped connection is reopened after T5.
+//
+// The arguments mirror hsms.NewHsmsProtocol, so switching a tool between
+// HSMS and SECS-I over TCP only changes the constructor.
+func NewTCPProtocol(address string, port int, active bool, equipment bool, deviceID int, name string) *Protocol {
+	target := net.JoinHostPort(address, strconv.Itoa(port))
+	if active {
+		return newProtocol(dialer(target), true, equipment, deviceID, name)
+	}
+	return newProtocol(listener(target), true, equipment, deviceID, name)
+}
+
+func dialer(target string) func(stop <-chan struct{}) (io.ReadWriteCloser, error) {
+	return func(stop <-chan struct{}) (io.ReadWriteCloser, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", target)
+	}
+}
+
+// listener opens the listening socket on first use and closes it when the
+// protocol is disabled.
+func listener(target string) func(stop <-chan struct{}) (io.ReadWriteCloser, error) {
+	var mu sync.Mutex
+	var current net.Listener
+	return func(stop <-chan struct{}) (io.ReadWriteCloser, error) {
+		mu.Lock()
+		l := current
+		if l == nil {
+			var err error
+			l, err = net.Listen("tcp", target)
+			if err != nil {
+				mu.Unlock()
+				return nil, err
+			}
+			current = l
+			go func() {
+				<-stop
+				mu.Lock()
+				current = nil
+				mu.Unlock()
+				l.Close()
+			}()
+		}
+		mu.Unlock()
+		return l.Accept()
+	}
+}
@@ -0,0 +1,126 @@
+package secs1
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/younglifestyle/secs4go/hsms"
+	"github.com/younglifestyle/secs4go/lib-secs2-hsms-go/pkg/ast"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func waitConnected(t *testing.T, timeout time.Duration, protocols ...*Protocol) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for _, p := range protocols {
+		for !p.Connected() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not connected", p.name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func newTCPPair(t *testing.T) (equipment, host *Protocol) {
+	t.Helper()
+	port := freePort(t)
+	equipment = NewTCPProtocol("127.0.0.1", port, false, true, 1, "equipment")
+	host = NewTCPProtocol("127.0.0.1", port, true, false, 1, "host")
+	for _, p := range []*Protocol{equipment, host} {
+		p.Timeouts().SetT3ReplyTimeout(5)
+		p.Timeouts().SetT5ConnSeparateTimeout(1)
+		p.Timeouts().SetReconnectBackoffBase(1)
+		p.Timeouts().SetReconnectBackoffMax(1)
+	}
+	equipment.RegisterHandler(1, 1, func(*ast.DataMessage) (*ast.DataMessage, error) {
+		return ast.NewDataMessage("", 1, 2, 0, "H<-E", ast.NewASCIINode("online")), nil
+	})
+	equipment.Enable()
+	t.Cleanup(equipment.Disable)
+	host.Enable()
+	t.Cleanup(host.Disable)
+	waitConnected(t, 3*time.Second, equipment, host)
+	return equipment, host
+}
+
+func areYouThere(t *testing.T, host *Protocol) {
+	t.Helper()
+	reply, err := host.SendAndWait(ast.NewDataMessage("", 1, 1, 1, "H->E", ast.NewEmptyItemNode()))
+	if err != nil {
+		t.Fatalf("S1F1: %v", err)
+	}
+	item, _ := reply.Get()
+	if got := item.Values(); got != "online" {
+		t.Fatalf("unexpected reply %v", got)
+	}
+}
+
+func TestTCPProtocol(t *testing.T) {
+	_, host := newTCPPair(t)
+	areYouThere(t, host)
+}
+
+func TestTCPProtocolReconnects(t *testing.T) {
+	equipment, host := newTCPPair(t)
+	events := make(chan hsms.ConnectionEvent, 16)
+	host.AddConnectionListener(func(event hsms.ConnectionEvent) {
+		events <- event
+	})
+	areYouThere(t, host)
+
+	equipment.Disable()
+	deadline := time.Now().Add(time.Second)
+	for host.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("host did not notice the dropped connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	equipment.Enable()
+	waitConnected(t, 5*time.Second, equipment, host)
+	areYouThere(t, host)
+
+	want := []hsms.ConnectionEventType{hsms.EventDisconnected, hsms.EventConnected, hsms.EventSelected}
+	for _, typ := range want {
+		event := <-events
+		if event.Type != typ {
+			t.Fatalf("expected %s, got %s", typ, event.Type)
+		}
+		if typ == hsms.EventDisconnected && event.Reason != hsms.DisconnectReasonPeerClosed {
+			t.Fatalf("expected peer closed, got %s: %v", event.Reason, event.Err)
+		}
+		if typ == hsms.EventConnected && event.RemoteAddr == nil {
+			t.Fatal("EventConnected without remote address")
+		}
+	}
+}
+
+func TestTCPProtocolWithoutAutoReconnect(t *testing.T) {
+	host := NewTCPProtocol("127.0.0.1", freePort(t), true, false, 1, "host")
+	host.Timeouts().SetAutoReconnect(false)
+	host.Enable()
+
+	done := make(chan struct{})
+	go func() {
+		host.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("protocol kept dialing with auto reconnect disabled")
+	}
+	host.Disable()
+}
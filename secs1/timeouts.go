@@ -0,0 +1,80 @@
+package secs1
+
+import (
+	"sync"
+	"time"
+)
+
+// BlockTimeouts holds the SEMI E4 block transfer parameters. The reply
+// timeout T3 and the reconnect settings live in the protocol's
+// hsms.SecsTimeout, shared with HSMS.
+type BlockTimeouts struct {
+	mu sync.RWMutex
+	// T1 is the inter-character timeout within a block (default 0.5s).
+	t1 time.Duration
+	// T2 is the protocol timeout: ENQ to EOT and block to ACK (default 10s).
+	t2 time.Duration
+	// T4 is the inter-block timeout within a multi-block message (default 45s).
+	t4 time.Duration
+	// retryLimit is the number of times a block is sent again after a
+	// missing EOT, a NAK or a missing ACK (default 3).
+	retryLimit int
+}
+
+// NewBlockTimeouts returns the E4 default parameters.
+func NewBlockTimeouts() *BlockTimeouts {
+	return &BlockTimeouts{
+		t1:         500 * time.Millisecond,
+		t2:         10 * time.Second,
+		t4:         45 * time.Second,
+		retryLimit: 3,
+	}
+}
+
+func (t *BlockTimeouts) T1() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.t1
+}
+
+func (t *BlockTimeouts) SetT1(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.t1 = d
+}
+
+func (t *BlockTimeouts) T2() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.t2
+}
+
+func (t *BlockTimeouts) SetT2(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.t2 = d
+}
+
+func (t *BlockTimeouts) T4() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.t4
+}
+
+func (t *BlockTimeouts) SetT4(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.t4 = d
+}
+
+func (t *BlockTimeouts) RetryLimit() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.retryLimit
+}
+
+func (t *BlockTimeouts) SetRetryLimit(limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retryLimit = limit
+}
@@ -44,12 +44,18 @@ func (server *Server) Serve() error {
 		}
 
 		go func() {
+			if err := handshake(conn); err != nil {
+				conn.Close()
+				return
+			}
 			codec, err := server.protocol.NewCodec(conn)
 			if err != nil {
 				conn.Close()
 				return
 			}
 			session := server.manager.NewSession(codec, server.sendChanSize)
+			session.remoteAddr = conn.RemoteAddr()
+			session.localAddr = conn.LocalAddr()
 			server.handler.HandleSession(session)
 		}()
 	}
@@ -60,6 +66,10 @@ func (server *Server) SingleServe() error {
 	if err != nil {
 		return err
 	}
+	if err := handshake(conn); err != nil {
+		conn.Close()
+		return err
+	}
 
 	codec, err := server.protocol.NewCodec(conn)
 	if err != nil {
@@ -67,6 +77,8 @@ func (server *Server) SingleServe() error {
 		return err
 	}
 	session := server.manager.NewSession(codec, server.sendChanSize)
+	session.remoteAddr = conn.RemoteAddr()
+	session.localAddr = conn.LocalAddr()
 	server.handler.HandleSession(session)
 
 	return nil
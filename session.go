@@ -2,6 +2,7 @@ package link
 
 import (
 	"errors"
+	"net"
 	"sync"
 	"sync/atomic"
 )
@@ -19,6 +20,9 @@ type Session struct {
 	recvMutex sync.Mutex
 	sendMutex sync.RWMutex
 
+	localAddr  net.Addr
+	remoteAddr net.Addr
+
 	closeFlag          int32
 	closeChan          chan int
 	closeMutex         sync.Mutex
@@ -68,6 +72,18 @@ func (session *Session) ID() uint64 {
 	return session.id
 }
 
+// RemoteAddr returns the peer address of the underlying connection, or nil
+// when the session was not created from a network connection.
+func (session *Session) RemoteAddr() net.Addr {
+	return session.remoteAddr
+}
+
+// LocalAddr returns the local address of the underlying connection, or nil
+// when the session was not created from a network connection.
+func (session *Session) LocalAddr() net.Addr {
+	return session.localAddr
+}
+
 func (session *Session) IsClosed() bool {
 	return atomic.LoadInt32(&session.closeFlag) == 1
 }
@@ -108,7 +124,7 @@ func (session *Session) Receive() (interface{}, error) {
 	defer session.recvMutex.Unlock()
 
 	msg, err := session.codec.Receive()
-	if err != nil {
+	if err != nil && !isRecoverable(err) {
 		session.Close()
 	}
 	return msg, err
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -14,7 +15,7 @@ type Deque struct {
 }
 
 func NewDeque() *Deque {
-	return &Deque{container: list.New(), notEmptyNotify: make(chan struct{})}
+	return &Deque{container: list.New(), notEmptyNotify: make(chan struct{}, 1)}
 }
 
 func (s *Deque) Put(item interface{}) {
@@ -53,3 +54,23 @@ func (s *Deque) Get(timeout int) (interface{}, error) {
 	s.Unlock()
 	return item, nil
 }
+
+// GetContext removes and returns the oldest item, blocking until one is
+// available or ctx is done, in which case ctx.Err() is returned.
+func (s *Deque) GetContext(ctx context.Context) (interface{}, error) {
+	for {
+		s.Lock()
+		if back := s.container.Back(); back != nil {
+			item := s.container.Remove(back)
+			s.Unlock()
+			return item, nil
+		}
+		s.Unlock()
+
+		select {
+		case <-s.notEmptyNotify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}